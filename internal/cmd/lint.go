@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/patrickhoefler/dockerfilegraph/pkg/dockerfilegraph"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+// lintFlags holds the flag values of the lint command.
+type lintFlags struct {
+	buildArg      []string
+	buildContext  []string
+	buildPlatform string
+	filename      string
+	output        enum
+	platform      []string
+	target        []string
+}
+
+// newLintCmd creates the lint command, which checks the build graph of a
+// Dockerfile for problems and fails if it finds any.
+func newLintCmd(w io.Writer, inputFS afero.Fs) *cobra.Command {
+	f := lintFlags{}
+
+	lintCmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check the build graph of a Dockerfile for problems",
+		Long: `lint checks the build graph of a Dockerfile for problems, like stages
+that no target needs or images without a digest, and exits with a non-zero
+status if it finds any.`,
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			buildArgs, err := parseBuildArgs(f.buildArg)
+			if err != nil {
+				return err
+			}
+			contexts, err := parseBuildContexts(f.buildContext)
+			if err != nil {
+				return err
+			}
+
+			// The targets only select the stages that are reachable, the
+			// others are still parsed so that they can be reported.
+			parseOpts := dockerfilegraph.ParseOptions{
+				BuildArgs:      buildArgs,
+				BuildPlatform:  f.buildPlatform,
+				Contexts:       contexts,
+				MaxLabelLength: defaultMaxLabelLength,
+			}
+			// Like docker build, the target platform is the build platform
+			// by default, so that FROM base-${TARGETARCH} selects a stage.
+			switch len(f.platform) {
+			case 0:
+				parseOpts.Platform = cmp.Or(f.buildPlatform, dockerfilegraph.DefaultBuildPlatform())
+			case 1:
+				parseOpts.Platform = f.platform[0]
+			default:
+				parseOpts.Platforms = f.platform
+			}
+			dockerfile, err := loadDockerfile(c, inputFS, cliFlags{filename: f.filename}, parseOpts)
+			if err != nil {
+				return err
+			}
+			findings, err := dockerfilegraph.Lint(dockerfile, f.target)
+			if err != nil {
+				return err
+			}
+			if f.filename != "-" {
+				for i := range findings {
+					if findings[i].File == "" {
+						findings[i].File = f.filename
+					}
+				}
+			}
+
+			if err := writeFindings(w, f.output.String(), findings); err != nil {
+				return err
+			}
+			if len(findings) > 0 {
+				// The findings are the result, not a wrong invocation.
+				c.SilenceUsage = true
+				return fmt.Errorf("found %d problem(s)", len(findings))
+			}
+			return nil
+		},
+	}
+
+	lintCmd.Flags().StringArrayVar(
+		&f.buildArg,
+		"build-arg",
+		nil,
+		"set a build-time variable like docker build, e.g. --build-arg GO_VERSION=1.22 (can be repeated)",
+	)
+
+	lintCmd.Flags().StringArrayVar(
+		&f.buildContext,
+		"build-context",
+		nil,
+		"replace an image or stage with a named build context like docker buildx build (can be repeated)",
+	)
+
+	lintCmd.Flags().StringVar(
+		&f.buildPlatform,
+		"build-platform",
+		"",
+		"platform of the builder (default linux and the architecture of this machine)",
+	)
+
+	lintCmd.Flags().StringVarP(
+		&f.filename,
+		"filename",
+		"f",
+		"Dockerfile",
+		"name of the Dockerfile, or - to read it from stdin",
+	)
+
+	f.output = newEnum("text", "json", "sarif")
+	lintCmd.Flags().VarP(
+		&f.output,
+		"output",
+		"o",
+		"output format, one of: "+strings.Join(f.output.AllowedValues(), ", "),
+	)
+
+	lintCmd.Flags().StringSliceVar(
+		&f.platform,
+		"platform",
+		nil,
+		"target platform(s) that set the automatic platform ARGs, a stage is needed if any platform needs it "+
+			"(default the build platform)",
+	)
+
+	lintCmd.Flags().StringSliceVar(
+		&f.target,
+		"target",
+		nil,
+		"the target(s) that stages must be needed by (default the last stage)",
+	)
+
+	return lintCmd
+}
+
+// writeFindings writes the findings to w in the given output format.
+func writeFindings(w io.Writer, output string, findings []dockerfilegraph.Finding) error {
+	switch output {
+	case "json":
+		content, err := dockerfilegraph.BuildLintJSONFile(findings)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, content)
+		return err
+	case "sarif":
+		content, err := dockerfilegraph.BuildSARIFFile(findings, gitVersion)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, content)
+		return err
+	}
+
+	for _, finding := range findings {
+		location := fmt.Sprintf("line %d", finding.Source.StartLine)
+		if finding.File != "" {
+			location = fmt.Sprintf("%s:%d", finding.File, finding.Source.StartLine)
+		}
+		fmt.Fprintf(
+			w, "%s: %s: %s (%s)\n",
+			location, dockerfilegraph.LintRuleLevel(finding.Rule), finding.Message, finding.Rule,
+		)
+	}
+	return nil
+}
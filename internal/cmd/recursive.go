@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/patrickhoefler/dockerfilegraph/pkg/dockerfilegraph"
+	"github.com/spf13/afero"
+)
+
+// renderRecursive parses every Dockerfile below f.recursive concurrently and
+// writes one output file per Dockerfile. The output files are written next
+// to the Dockerfiles, or to the same relative paths below f.outputDir.
+func renderRecursive(
+	ctx context.Context,
+	errW io.Writer,
+	inputFS afero.Fs,
+	dotCmd string,
+	f cliFlags,
+	parseOpts dockerfilegraph.ParseOptions,
+	buildOpts dockerfilegraph.BuildOptions,
+) error {
+	dockerfiles, err := findDockerfiles(inputFS, f.recursive, f.output.AllowedValues())
+	if err != nil {
+		return err
+	}
+	if len(dockerfiles) == 0 {
+		return fmt.Errorf("could not find any Dockerfiles in %s", f.recursive)
+	}
+
+	// Keep the messages of each Dockerfile together, and print them in a
+	// stable order once all of them are done.
+	messages := make([]bytes.Buffer, len(dockerfiles))
+	errs := make([]error, len(dockerfiles))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i, dockerfilePath := range dockerfiles {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			err := renderDockerfile(
+				ctx, &messages[i], inputFS, dotCmd, f, parseOpts, buildOpts, dockerfilePath,
+			)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", dockerfilePath, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range messages {
+		if _, err := messages[i].WriteTo(errW); err != nil {
+			return err
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// renderCombined parses every Dockerfile below f.recursive and writes a
+// single graph of all of them. The images built by the Dockerfiles are taken
+// from --image and --image-file.
+func renderCombined(
+	ctx context.Context,
+	w io.Writer,
+	errW io.Writer,
+	inputFS afero.Fs,
+	dotCmd string,
+	f cliFlags,
+	parseOpts dockerfilegraph.ParseOptions,
+	buildOpts dockerfilegraph.BuildOptions,
+) error {
+	images, err := parseImages(inputFS, f.image, f.imageFile)
+	if err != nil {
+		return err
+	}
+
+	dockerfiles, err := findDockerfiles(inputFS, f.recursive, f.output.AllowedValues())
+	if err != nil {
+		return err
+	}
+	if len(dockerfiles) == 0 {
+		return fmt.Errorf("could not find any Dockerfiles in %s", f.recursive)
+	}
+
+	// The targets are applied to the combined graph, because they are
+	// usually defined by only some of the Dockerfiles.
+	targets := parseOpts.Targets
+	parseOpts.Targets = nil
+
+	inputs := make([]dockerfilegraph.CombineInput, 0, len(dockerfiles))
+	for _, dockerfilePath := range dockerfiles {
+		dockerfile, err := dockerfilegraph.LoadAndParseDockerfile(ctx, inputFS, dockerfilePath, parseOpts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dockerfilePath, err)
+		}
+		relPath, err := filepath.Rel(f.recursive, dockerfilePath)
+		if err != nil {
+			return err
+		}
+		input := dockerfilegraph.CombineInput{File: relPath, Dockerfile: dockerfile, Path: relPath}
+		if image, ok := images[relPath]; ok {
+			input.Images = []string{image}
+			delete(images, relPath)
+		}
+		inputs = append(inputs, input)
+	}
+	// A mapping that matches no Dockerfile is most likely a typo.
+	if len(images) > 0 {
+		return fmt.Errorf(
+			"could not find the Dockerfiles of the image mappings in %s: %s",
+			f.recursive, strings.Join(slices.Sorted(maps.Keys(images)), ", "),
+		)
+	}
+
+	combined := dockerfilegraph.CombineDockerfiles(inputs)
+	switch {
+	case parseOpts.HighlightUnused:
+		combined, err = dockerfilegraph.MarkUnusedStages(combined, targets)
+	case len(targets) > 0:
+		combined, err = dockerfilegraph.FilterToTargets(combined, targets)
+	}
+	if err != nil {
+		return err
+	}
+
+	filename := f.outputFile
+	if filename == "" {
+		filename = "Dockerfile." + f.output.String()
+	}
+
+	return renderGraph(w, errW, dotCmd, f, combined, buildOpts, filename)
+}
+
+// parseImages converts the DOCKERFILE=IMAGE pairs of --image and
+// --image-file into a map from the cleaned Dockerfile path, relative to the
+// --recursive directory, to the image.
+// Empty lines and lines starting with # are ignored in the file, and the
+// flags take precedence over it.
+func parseImages(inputFS afero.Fs, flagValues []string, imageFile string) (map[string]string, error) {
+	var values []string
+	if imageFile != "" {
+		content, err := afero.ReadFile(inputFS, imageFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			values = append(values, line)
+		}
+	}
+
+	values = append(values, flagValues...)
+
+	images := make(map[string]string, len(values))
+	for _, value := range values {
+		dockerfilePath, image, ok := strings.Cut(value, "=")
+		if !ok || dockerfilePath == "" || image == "" {
+			return nil, fmt.Errorf("invalid image mapping %q, expected DOCKERFILE=IMAGE", value)
+		}
+		images[filepath.Clean(dockerfilePath)] = image
+	}
+	return images, nil
+}
+
+// renderDockerfile parses a single Dockerfile and writes its graph.
+func renderDockerfile(
+	ctx context.Context,
+	errW io.Writer,
+	inputFS afero.Fs,
+	dotCmd string,
+	f cliFlags,
+	parseOpts dockerfilegraph.ParseOptions,
+	buildOpts dockerfilegraph.BuildOptions,
+	dockerfilePath string,
+) error {
+	dockerfile, err := dockerfilegraph.LoadAndParseDockerfile(ctx, inputFS, dockerfilePath, parseOpts)
+	if err != nil {
+		return err
+	}
+
+	relPath, err := filepath.Rel(f.recursive, dockerfilePath)
+	if err != nil {
+		return err
+	}
+	filename := dockerfilePath + "." + f.output.String()
+	if f.outputDir != "" {
+		filename = filepath.Join(f.outputDir, relPath) + "." + f.output.String()
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+
+	// The warnings name the Dockerfile, and the link prefix is the URL of
+	// the --recursive directory.
+	f.filename = dockerfilePath
+	buildOpts.LinkPrefix = joinLinkPrefix(buildOpts.LinkPrefix, relPath)
+	return renderGraph(io.Discard, errW, dotCmd, f, dockerfile, buildOpts, filename)
+}
+
+// joinLinkPrefix appends the path of a Dockerfile to the link prefix of its
+// directory, or returns an empty link prefix unchanged.
+func joinLinkPrefix(linkPrefix, relPath string) string {
+	if linkPrefix == "" {
+		return ""
+	}
+	return strings.TrimSuffix(linkPrefix, "/") + "/" + filepath.ToSlash(relPath)
+}
+
+// notDockerfileExtensions are the extensions of files next to Dockerfiles
+// that are named like them, e.g. Dockerfile.md or Dockerfile.bak.
+var notDockerfileExtensions = []string{"bak", "dockerignore", "md", "orig", "swp", "txt"}
+
+// findDockerfiles returns the paths of all Dockerfiles below root, sorted by
+// path. Hidden directories like .git are skipped, and so are the files that
+// dockerfilegraph creates itself, like Dockerfile.svg, and the files with
+// one of the notDockerfileExtensions.
+func findDockerfiles(inputFS afero.Fs, root string, outputFormats []string) ([]string, error) {
+	var dockerfiles []string
+	err := afero.Walk(inputFS, root, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(name, ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ext := strings.TrimPrefix(filepath.Ext(name), ".")
+		if slices.Contains(notDockerfileExtensions, ext) || slices.Contains(outputFormats, ext) {
+			return nil
+		}
+		if name == "Dockerfile" || name == "Containerfile" ||
+			strings.HasSuffix(name, ".Dockerfile") || strings.HasPrefix(name, "Dockerfile.") {
+			dockerfiles = append(dockerfiles, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(dockerfiles)
+	return dockerfiles, nil
+}
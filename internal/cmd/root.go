@@ -2,35 +2,60 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
 
-	"github.com/patrickhoefler/dockerfilegraph/internal/dockerfile2dot"
+	"github.com/patrickhoefler/dockerfilegraph/pkg/dockerfilegraph"
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 )
 
+// defaultMaxLabelLength is the maximum length of the node labels unless
+// --max-label-length is set.
+const defaultMaxLabelLength = 20
+
 // cliFlags holds all flag values for a single command invocation.
 type cliFlags struct {
-	concentrate    bool
-	dpi            uint
-	edgestyle      enum
-	filename       string
-	layers         bool
-	legend         bool
-	maxLabelLength uint
-	nodesep        float64
-	output         enum
-	ranksep        float64
-	scratch        enum
-	separate       []string
-	target         []string
-	unflatten      uint
-	version        bool
+	bake            string
+	buildArg        []string
+	buildContext    []string
+	buildPlatform   string
+	combine         bool
+	compose         string
+	concentrate     bool
+	copyDetails     bool
+	dpi             uint
+	edgestyle       enum
+	filename        string
+	highlightUnused bool
+	image           []string
+	imageDigest     enum
+	imageFile       string
+	imageName       enum
+	layers          bool
+	legend          bool
+	linkPrefix      string
+	maxLabelLength  uint
+	nodesep         float64
+	output          enum
+	outputDir       string
+	outputFile      string
+	platform        []string
+	ranksep         float64
+	recursive       string
+	renderer        enum
+	scratch         enum
+	separate        []string
+	showContext     bool
+	target          []string
+	unflatten       uint
+	version         bool
 }
 
 // dfgWriter is a writer that prints to stdout. When testing, we
@@ -55,119 +80,128 @@ func NewRootCmd(
 It creates a visual graph representation of the build process.`,
 		Args: cobra.NoArgs,
 		PreRunE: func(_ *cobra.Command, _ []string) error {
-			return checkFlags(f.maxLabelLength)
+			return checkFlags(f)
 		},
-		RunE: func(_ *cobra.Command, _ []string) (err error) {
+		RunE: func(c *cobra.Command, _ []string) (err error) {
 			if f.version {
 				return printVersion(w)
 			}
 
-			// Make sure that graphviz is installed.
-			_, err = exec.LookPath(dotCmd)
-			if err != nil {
-				return
+			// Make sure that graphviz is installed, unless it isn't needed.
+			if !slices.Contains([]string{"json", "mermaid"}, f.output.String()) &&
+				f.renderer.String() != "builtin" {
+				_, err = exec.LookPath(dotCmd)
+				if err != nil {
+					return
+				}
 			}
 
-			// Load and parse the Dockerfile.
-			dockerfile, err := dockerfile2dot.LoadAndParseDockerfile(
-				inputFS,
-				f.filename,
-				dockerfile2dot.ParseOptions{
-					MaxLabelLength: int(f.maxLabelLength),
-					ScratchMode:    dockerfile2dot.ScratchModeFromString(f.scratch.String()),
-					SeparateImages: f.separate,
-					Targets:        f.target,
-				},
-			)
+			buildArgs, err := parseBuildArgs(f.buildArg)
 			if err != nil {
 				return
 			}
 
-			dotFile, err := os.CreateTemp("", "dockerfile.*.dot")
-			if err != nil {
-				return
-			}
-			defer os.Remove(dotFile.Name())
-
-			dotFileContent, err := dockerfile2dot.BuildDotFile(
-				dockerfile,
-				dockerfile2dot.BuildOptions{
-					Concentrate:    f.concentrate,
-					EdgeStyle:      f.edgestyle.String(),
-					Layers:         f.layers,
-					Legend:         f.legend,
-					MaxLabelLength: int(f.maxLabelLength),
-					NodeSep:        f.nodesep,
-					RankSep:        f.ranksep,
-				},
-			)
+			contexts, err := parseBuildContexts(f.buildContext)
 			if err != nil {
 				return
 			}
 
-			_, err = dotFile.Write([]byte(dotFileContent))
-			if err != nil {
-				return
+			parseOpts := dockerfilegraph.ParseOptions{
+				BuildArgs:       buildArgs,
+				BuildPlatform:   f.buildPlatform,
+				Contexts:        contexts,
+				HighlightUnused: f.highlightUnused,
+				MaxLabelLength:  int(f.maxLabelLength),
+				ScratchMode:     dockerfilegraph.ScratchModeFromString(f.scratch.String()),
+				SeparateImages:  f.separate,
+				ShowContext:     f.showContext,
+				Targets:         f.target,
 			}
-
-			err = dotFile.Close()
-			if err != nil {
-				return
-			}
-
-			if f.unflatten > 0 {
-				err = runUnflatten(dotFile.Name(), w, f.unflatten)
-				if err != nil {
-					return
-				}
-				var b []byte
-				b, err = os.ReadFile(dotFile.Name())
-				if err != nil {
-					return
-				}
-				dotFileContent = string(b)
+			if len(f.platform) == 1 {
+				parseOpts.Platform = f.platform[0]
+			} else {
+				parseOpts.Platforms = f.platform
 			}
 
-			filename := "Dockerfile." + f.output.String()
-
-			if f.output.String() == "raw" {
-				err = os.Rename(dotFile.Name(), filename)
-				if err != nil {
-					return
-				}
-				fmt.Fprintf(w, "Successfully created %s\n", filename)
-				return
+			buildOpts := dockerfilegraph.BuildOptions{
+				Concentrate:    f.concentrate,
+				CopyDetails:    f.copyDetails,
+				EdgeStyle:      f.edgestyle.String(),
+				ImageDigest:    f.imageDigest.String(),
+				ImageName:      f.imageName.String(),
+				Layers:         f.layers,
+				Legend:         f.legend,
+				LinkPrefix:     f.linkPrefix,
+				MaxLabelLength: int(f.maxLabelLength),
+				NodeSep:        f.nodesep,
+				RankSep:        f.ranksep,
 			}
 
-			dotArgs := []string{
-				"-T" + f.output.String(),
-				"-o" + filename,
+			if f.combine {
+				return renderCombined(c.Context(), w, c.ErrOrStderr(), inputFS, dotCmd, f, parseOpts, buildOpts)
 			}
-			if f.output.String() == "png" {
-				dotArgs = append(dotArgs, "-Gdpi="+fmt.Sprint(f.dpi))
+			if f.recursive != "" {
+				return renderRecursive(c.Context(), c.ErrOrStderr(), inputFS, dotCmd, f, parseOpts, buildOpts)
 			}
-			dotArgs = append(dotArgs, dotFile.Name())
 
-			out, err := exec.Command(dotCmd, dotArgs...).CombinedOutput()
+			dockerfile, err := loadDockerfile(c, inputFS, f, parseOpts)
 			if err != nil {
-				fmt.Fprintf(w,
-					"Oh no, something went wrong while generating the graph!\n\n"+
-						"This is the Graphviz file that was generated:\n\n"+
-						"%s\n"+
-						"The following error was reported by Graphviz:\n\n"+
-						"%s",
-					dotFileContent, string(out),
-				)
 				return
 			}
 
-			fmt.Fprintf(w, "Successfully created %s\n", filename)
+			filename := f.outputFile
+			if filename == "" {
+				filename = "Dockerfile." + f.output.String()
+			}
 
-			return
+			return renderGraph(w, c.ErrOrStderr(), dotCmd, f, dockerfile, buildOpts, filename)
 		},
 	}
 
 	// Flags
+	rootCmd.Flags().StringVar(
+		&f.bake,
+		"bake",
+		"",
+		"graph the targets of a docker-bake.hcl or docker-bake.json file, --target then selects bake targets and groups",
+	)
+
+	rootCmd.Flags().StringArrayVar(
+		&f.buildArg,
+		"build-arg",
+		nil,
+		"set a build-time variable like docker build, e.g. --build-arg GO_VERSION=1.22 (can be repeated)",
+	)
+
+	rootCmd.Flags().StringArrayVar(
+		&f.buildContext,
+		"build-context",
+		nil,
+		"replace an image or stage with a named build context like docker buildx build, "+
+			"e.g. --build-context alpine=docker-image://alpine:3.20 or src=./src (can be repeated)",
+	)
+
+	rootCmd.Flags().StringVar(
+		&f.buildPlatform,
+		"build-platform",
+		"",
+		"platform of the builder for --platform (default linux and the architecture of this machine)",
+	)
+
+	rootCmd.Flags().BoolVar(
+		&f.combine,
+		"combine",
+		false,
+		"draw the Dockerfiles found by --recursive as one graph, linking the images they build (default false)",
+	)
+
+	rootCmd.Flags().StringVar(
+		&f.compose,
+		"compose",
+		"",
+		"graph the services with a build section in a Compose file, --target then selects services",
+	)
+
 	rootCmd.Flags().BoolVarP(
 		&f.concentrate,
 		"concentrate",
@@ -176,6 +210,13 @@ It creates a visual graph representation of the build process.`,
 		"concentrate the edges (default false)",
 	)
 
+	rootCmd.Flags().BoolVar(
+		&f.copyDetails,
+		"copy-details",
+		false,
+		"label the COPY and ADD edges with their paths and flags, e.g. --link and --chmod (default false)",
+	)
+
 	rootCmd.Flags().UintVarP(
 		&f.dpi,
 		"dpi",
@@ -197,7 +238,45 @@ It creates a visual graph representation of the build process.`,
 		"filename",
 		"f",
 		"Dockerfile",
-		"name of the Dockerfile",
+		"name of the Dockerfile, or - to read it from stdin",
+	)
+
+	rootCmd.Flags().BoolVar(
+		&f.highlightUnused,
+		"highlight-unused",
+		false,
+		"grey out the stages that none of the targets needs instead of hiding them, and report them (default false)",
+	)
+
+	rootCmd.Flags().StringArrayVar(
+		&f.image,
+		"image",
+		nil,
+		"the image built by a Dockerfile for --combine, relative to --recursive, e.g. --image base/Dockerfile=ourorg/base "+
+			"(can be repeated)",
+	)
+
+	f.imageDigest = newEnum("full", "fingerprint", "hide")
+	rootCmd.Flags().Var(
+		&f.imageDigest,
+		"image-digest",
+		"how to show the digests of external images, one of: "+strings.Join(f.imageDigest.AllowedValues(), ", ")+
+			" (fingerprint shows the first digits below the name)",
+	)
+
+	rootCmd.Flags().StringVar(
+		&f.imageFile,
+		"image-file",
+		"",
+		"file with one DOCKERFILE=IMAGE mapping per line for --combine",
+	)
+
+	f.imageName = newEnum("full", "short")
+	rootCmd.Flags().Var(
+		&f.imageName,
+		"image-name",
+		"how to show the names of external images, one of: "+strings.Join(f.imageName.AllowedValues(), ", ")+
+			" (short omits the registry and the path)",
 	)
 
 	rootCmd.Flags().BoolVar(
@@ -214,11 +293,19 @@ It creates a visual graph representation of the build process.`,
 		"add a legend (default false)",
 	)
 
+	rootCmd.Flags().StringVar(
+		&f.linkPrefix,
+		"link-prefix",
+		"",
+		"link the nodes to their lines in the Dockerfile, e.g. --link-prefix https://github.com/org/repo/blob/main/Dockerfile, "+
+			"or with --recursive, --bake or --compose the URL of their directory",
+	)
+
 	rootCmd.Flags().UintVarP(
 		&f.maxLabelLength,
 		"max-label-length",
 		"m",
-		20,
+		defaultMaxLabelLength,
 		"maximum length of the node labels, must be at least 4",
 	)
 
@@ -230,7 +317,7 @@ It creates a visual graph representation of the build process.`,
 		"minimum space between two adjacent nodes in the same rank",
 	)
 
-	f.output = newEnum("pdf", "canon", "dot", "png", "raw", "svg")
+	f.output = newEnum("pdf", "canon", "dot", "json", "mermaid", "png", "raw", "svg")
 	rootCmd.Flags().VarP(
 		&f.output,
 		"output",
@@ -238,6 +325,29 @@ It creates a visual graph representation of the build process.`,
 		"output file format, one of: "+strings.Join(f.output.AllowedValues(), ", "),
 	)
 
+	rootCmd.Flags().StringVar(
+		&f.outputDir,
+		"output-dir",
+		"",
+		"directory for the output files of --recursive, mirroring the directory tree (default next to each Dockerfile)",
+	)
+
+	rootCmd.Flags().StringVarP(
+		&f.outputFile,
+		"output-file",
+		"O",
+		"",
+		"path of the output file, or - for stdout (default \"Dockerfile.\" + output format)",
+	)
+
+	rootCmd.Flags().StringSliceVar(
+		&f.platform,
+		"platform",
+		nil,
+		"target platform that sets the automatic platform ARGs and is shown for each stage, e.g. --platform linux/arm64, "+
+			"several platforms are drawn in one graph that marks what differs (e.g. --platform linux/amd64,linux/arm64)",
+	)
+
 	rootCmd.Flags().Float64VarP(
 		&f.ranksep,
 		"ranksep",
@@ -246,6 +356,20 @@ It creates a visual graph representation of the build process.`,
 		"minimum separation between ranks",
 	)
 
+	rootCmd.Flags().StringVar(
+		&f.recursive,
+		"recursive",
+		"",
+		"graph every Dockerfile, *.Dockerfile, Dockerfile.* and Containerfile in this directory tree",
+	)
+
+	f.renderer = newEnum("graphviz", "builtin")
+	rootCmd.Flags().Var(
+		&f.renderer,
+		"renderer",
+		"how to lay out the graph, one of: "+strings.Join(f.renderer.AllowedValues(), ", "),
+	)
+
 	f.scratch = newEnum("collapsed", "separated", "hidden")
 	rootCmd.Flags().Var(
 		&f.scratch,
@@ -260,6 +384,13 @@ It creates a visual graph representation of the build process.`,
 		"external images to display as separate nodes per usage (e.g. --separate ubuntu,alpine)",
 	)
 
+	rootCmd.Flags().BoolVar(
+		&f.showContext,
+		"show-context",
+		false,
+		"draw the build context with the paths that COPY and ADD read from it (default false)",
+	)
+
 	rootCmd.Flags().StringSliceVar(
 		&f.target,
 		"target",
@@ -282,9 +413,186 @@ It creates a visual graph representation of the build process.`,
 		"display the version of dockerfilegraph",
 	)
 
+	rootCmd.MarkFlagsMutuallyExclusive("bake", "compose", "filename", "recursive")
+
+	// Subcommands
+	rootCmd.AddCommand(newLintCmd(w, inputFS))
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+
 	return rootCmd
 }
 
+// loadDockerfile parses the input selected by the flags: a bake file, a
+// Compose file, or a single Dockerfile, which is read from stdin if the
+// filename is "-", just like docker build -f -.
+func loadDockerfile(
+	c *cobra.Command, inputFS afero.Fs, f cliFlags, parseOpts dockerfilegraph.ParseOptions,
+) (dockerfilegraph.SimplifiedDockerfile, error) {
+	switch {
+	case f.bake != "":
+		return dockerfilegraph.LoadBakeFile(c.Context(), inputFS, f.bake, parseOpts)
+	case f.compose != "":
+		return dockerfilegraph.LoadComposeFile(c.Context(), inputFS, f.compose, parseOpts)
+	case f.filename == "-":
+		return dockerfilegraph.ParseDockerfileInContext(c.Context(), inputFS, c.InOrStdin(), parseOpts)
+	default:
+		return dockerfilegraph.LoadAndParseDockerfile(c.Context(), inputFS, f.filename, parseOpts)
+	}
+}
+
+// printWarnings writes the problems found in the instructions, and the
+// stages that no target needs with --highlight-unused, to errW, with the
+// Dockerfile and the line of each instruction or stage.
+func printWarnings(errW io.Writer, f cliFlags, dockerfile dockerfilegraph.SimplifiedDockerfile) {
+	for stageIndex, stage := range dockerfile.Stages {
+		// The Dockerfile of bake targets and Compose services is only known
+		// when they are combined.
+		file := stage.File
+		if file == "" && f.bake == "" && f.compose == "" && f.filename != "-" {
+			file = f.filename
+		}
+		locate := func(source dockerfilegraph.SourceRange) string {
+			if file == "" {
+				return fmt.Sprintf("line %d", source.StartLine)
+			}
+			return fmt.Sprintf("%s:%d", file, source.StartLine)
+		}
+
+		if stage.Unused {
+			name := stage.Name
+			if name == "" {
+				name = strconv.Itoa(stageIndex)
+			}
+			fmt.Fprintf(errW, "Warning: %s: stage %s is not needed by any target\n", locate(stage.Source), name)
+		}
+		for _, layer := range stage.Layers {
+			location := locate(layer.Source)
+			for _, warning := range layer.Warnings {
+				fmt.Fprintf(errW, "Warning: %s: %s\n", location, warning)
+			}
+		}
+	}
+}
+
+// renderGraph writes the graph in the requested output format to filename,
+// or to w if the filename is "-". Messages are written to errW.
+func renderGraph(
+	w io.Writer,
+	errW io.Writer,
+	dotCmd string,
+	f cliFlags,
+	dockerfile dockerfilegraph.SimplifiedDockerfile,
+	buildOpts dockerfilegraph.BuildOptions,
+	filename string,
+) (err error) {
+	printWarnings(errW, f, dockerfile)
+
+	// JSON describes the graph without any layout information.
+	if f.output.String() == "json" {
+		var jsonFileContent string
+		jsonFileContent, err = dockerfilegraph.BuildJSONFile(dockerfile)
+		if err != nil {
+			return
+		}
+		return writeOutput(w, errW, filename, []byte(jsonFileContent))
+	}
+
+	// Mermaid is rendered by the viewer, so Graphviz is not involved.
+	if f.output.String() == "mermaid" {
+		var mermaidFileContent string
+		mermaidFileContent, err = dockerfilegraph.BuildMermaidFile(dockerfile, buildOpts)
+		if err != nil {
+			return
+		}
+		return writeOutput(w, errW, filename, []byte(mermaidFileContent))
+	}
+
+	// The builtin renderer lays out the graph without Graphviz.
+	if f.renderer.String() == "builtin" && f.output.String() == "svg" {
+		var svgFileContent string
+		svgFileContent, err = dockerfilegraph.BuildSVGFile(dockerfile, buildOpts)
+		if err != nil {
+			return
+		}
+		return writeOutput(w, errW, filename, []byte(svgFileContent))
+	}
+
+	dotFile, err := os.CreateTemp("", "dockerfile.*.dot")
+	if err != nil {
+		return
+	}
+	defer os.Remove(dotFile.Name())
+
+	dotFileContent, err := dockerfilegraph.BuildDotFile(dockerfile, buildOpts)
+	if err != nil {
+		return
+	}
+
+	_, err = dotFile.Write([]byte(dotFileContent))
+	if err != nil {
+		return
+	}
+
+	err = dotFile.Close()
+	if err != nil {
+		return
+	}
+
+	if f.unflatten > 0 {
+		err = runUnflatten(dotFile.Name(), errW, f.unflatten)
+		if err != nil {
+			return
+		}
+		var b []byte
+		b, err = os.ReadFile(dotFile.Name())
+		if err != nil {
+			return
+		}
+		dotFileContent = string(b)
+	}
+
+	if f.output.String() == "raw" {
+		return writeOutput(w, errW, filename, []byte(dotFileContent))
+	}
+
+	dotArgs := []string{"-T" + f.output.String()}
+	if filename != "-" {
+		dotArgs = append(dotArgs, "-o"+filename)
+	}
+	if f.output.String() == "png" {
+		dotArgs = append(dotArgs, "-Gdpi="+fmt.Sprint(f.dpi))
+	}
+	dotArgs = append(dotArgs, dotFile.Name())
+
+	// Keep the rendered graph and the Graphviz messages apart, so
+	// that errors don't end up in the piped output.
+	var stdout, stderr bytes.Buffer
+	dot := exec.Command(dotCmd, dotArgs...)
+	dot.Stdout = &stdout
+	dot.Stderr = &stderr
+	err = dot.Run()
+	if err != nil {
+		fmt.Fprintf(errW,
+			"Oh no, something went wrong while generating the graph!\n\n"+
+				"This is the Graphviz file that was generated:\n\n"+
+				"%s\n"+
+				"The following error was reported by Graphviz:\n\n"+
+				"%s",
+			dotFileContent, stderr.String()+stdout.String(),
+		)
+		return
+	}
+
+	if filename == "-" {
+		_, err = w.Write(stdout.Bytes())
+		return
+	}
+
+	fmt.Fprintf(errW, "Successfully created %s\n", filename)
+
+	return
+}
+
 func runUnflatten(dotPath string, w io.Writer, maxStagger uint) (err error) {
 	unflattenFile, err := os.CreateTemp("", "dockerfile.*.dot")
 	if err != nil {
@@ -331,6 +639,59 @@ func runUnflatten(dotPath string, w io.Writer, maxStagger uint) (err error) {
 	return
 }
 
+// parseBuildArgs converts KEY=VALUE pairs into a map. Like docker build, a
+// KEY without a value takes its value from the environment, and is ignored
+// if the environment variable is not set.
+func parseBuildArgs(values []string) (map[string]string, error) {
+	buildArgs := make(map[string]string, len(values))
+	for _, value := range values {
+		key, val, hasValue := strings.Cut(value, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid --build-arg %q, expected KEY=VALUE", value)
+		}
+		if !hasValue {
+			var ok bool
+			val, ok = os.LookupEnv(key)
+			if !ok {
+				continue
+			}
+		}
+		buildArgs[key] = val
+	}
+	return buildArgs, nil
+}
+
+// parseBuildContexts converts NAME=VALUE pairs into a map of named build
+// contexts.
+func parseBuildContexts(values []string) (map[string]string, error) {
+	contexts := make(map[string]string, len(values))
+	for _, value := range values {
+		name, source, ok := strings.Cut(value, "=")
+		if name == "" || !ok || source == "" {
+			return nil, fmt.Errorf("invalid --build-context %q, expected NAME=VALUE", value)
+		}
+		contexts[name] = source
+	}
+	return contexts, nil
+}
+
+// writeOutput writes content to the output file, or to w if the filename is
+// "-". The success message goes to errW, so that it never mixes with the
+// graph when the graph is written to stdout.
+func writeOutput(w io.Writer, errW io.Writer, filename string, content []byte) error {
+	if filename == "-" {
+		_, err := w.Write(content)
+		return err
+	}
+
+	err := os.WriteFile(filename, content, 0o644)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(errW, "Successfully created %s\n", filename)
+	return nil
+}
+
 // Execute executes the root command.
 func Execute() {
 	err := NewRootCmd(
@@ -342,9 +703,46 @@ func Execute() {
 	}
 }
 
-func checkFlags(maxLabelLength uint) error {
-	if maxLabelLength < 4 {
+func checkFlags(f cliFlags) error {
+	if f.maxLabelLength < 4 {
 		return fmt.Errorf("--max-label-length must be at least 4")
 	}
+	if err := checkRecursiveFlags(f); err != nil {
+		return err
+	}
+	if f.buildPlatform != "" && len(f.platform) == 0 {
+		return fmt.Errorf("--build-platform requires --platform")
+	}
+	if f.renderer.String() == "builtin" {
+		switch f.output.String() {
+		case "json", "mermaid", "raw", "svg":
+		default:
+			return fmt.Errorf("--renderer builtin does not support --output %s", f.output.String())
+		}
+		if f.unflatten > 0 {
+			return fmt.Errorf("--unflatten requires --renderer graphviz")
+		}
+	}
+	return nil
+}
+
+// checkRecursiveFlags checks the flags that only work together with
+// --recursive.
+func checkRecursiveFlags(f cliFlags) error {
+	if f.outputDir != "" && f.recursive == "" {
+		return fmt.Errorf("--output-dir requires --recursive")
+	}
+	if f.combine && f.recursive == "" {
+		return fmt.Errorf("--combine requires --recursive")
+	}
+	if f.combine && f.outputDir != "" {
+		return fmt.Errorf("--output-dir cannot be used with --combine, use --output-file instead")
+	}
+	if f.outputFile != "" && f.recursive != "" && !f.combine {
+		return fmt.Errorf("--output-file cannot be used with --recursive, unless --combine is set")
+	}
+	if (len(f.image) > 0 || f.imageFile != "") && !f.combine {
+		return fmt.Errorf("--image and --image-file require --combine")
+	}
 	return nil
 }
@@ -2,8 +2,11 @@ package cmd_test
 
 import (
 	"bytes"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -16,6 +19,7 @@ type test struct {
 	cliArgs            []string
 	dockerfileContent  string
 	dotCmd             string
+	stdin              string
 	wantErr            bool
 	wantOut            string
 	wantOutRegex       string
@@ -25,24 +29,50 @@ type test struct {
 
 var usage = `Usage:
   dockerfilegraph [flags]
+  dockerfilegraph [command]
+
+Available Commands:
+  help        Help about any command
+  lint        Check the build graph of a Dockerfile for problems
 
 Flags:
-  -c, --concentrate             concentrate the edges (default false)
-  -d, --dpi uint                dots per inch of the PNG export (default 96)
-  -e, --edgestyle               style of the graph edges, one of: default, solid (default default)
-  -f, --filename string         name of the Dockerfile (default "Dockerfile")
-  -h, --help                    help for dockerfilegraph
-      --layers                  display all layers (default false)
-      --legend                  add a legend (default false)
-  -m, --max-label-length uint   maximum length of the node labels, must be at least 4 (default 20)
-  -n, --nodesep float           minimum space between two adjacent nodes in the same rank (default 1)
-  -o, --output                  output file format, one of: canon, dot, pdf, png, raw, svg (default pdf)
-  -r, --ranksep float           minimum separation between ranks (default 0.5)
-      --scratch                 how to handle scratch images, one of: collapsed, hidden, separated (default collapsed)
-      --separate strings        external images to display as separate nodes per usage (e.g. --separate ubuntu,alpine)
-      --target strings          only show stages required to build the given target(s) (e.g. --target release,app)
-  -u, --unflatten uint          stagger length of leaf edges between [1,u] (default 0)
-      --version                 display the version of dockerfilegraph
+      --bake string                 graph the targets of a docker-bake.hcl or docker-bake.json file, --target then selects bake targets and groups
+      --build-arg stringArray       set a build-time variable like docker build, e.g. --build-arg GO_VERSION=1.22 (can be repeated)
+      --build-context stringArray   replace an image or stage with a named build context like docker buildx build, e.g. --build-context alpine=docker-image://alpine:3.20 or src=./src (can be repeated)
+      --build-platform string       platform of the builder for --platform (default linux and the architecture of this machine)
+      --combine                     draw the Dockerfiles found by --recursive as one graph, linking the images they build (default false)
+      --compose string              graph the services with a build section in a Compose file, --target then selects services
+  -c, --concentrate                 concentrate the edges (default false)
+      --copy-details                label the COPY and ADD edges with their paths and flags, e.g. --link and --chmod (default false)
+  -d, --dpi uint                    dots per inch of the PNG export (default 96)
+  -e, --edgestyle                   style of the graph edges, one of: default, solid (default default)
+  -f, --filename string             name of the Dockerfile, or - to read it from stdin (default "Dockerfile")
+  -h, --help                        help for dockerfilegraph
+      --highlight-unused            grey out the stages that none of the targets needs instead of hiding them, and report them (default false)
+      --image stringArray           the image built by a Dockerfile for --combine, relative to --recursive, e.g. --image base/Dockerfile=ourorg/base (can be repeated)
+      --image-digest                how to show the digests of external images, one of: fingerprint, full, hide (fingerprint shows the first digits below the name) (default full)
+      --image-file string           file with one DOCKERFILE=IMAGE mapping per line for --combine
+      --image-name                  how to show the names of external images, one of: full, short (short omits the registry and the path) (default full)
+      --layers                      display all layers (default false)
+      --legend                      add a legend (default false)
+      --link-prefix string          link the nodes to their lines in the Dockerfile, e.g. --link-prefix https://github.com/org/repo/blob/main/Dockerfile, or with --recursive, --bake or --compose the URL of their directory
+  -m, --max-label-length uint       maximum length of the node labels, must be at least 4 (default 20)
+  -n, --nodesep float               minimum space between two adjacent nodes in the same rank (default 1)
+  -o, --output                      output file format, one of: canon, dot, json, mermaid, pdf, png, raw, svg (default pdf)
+      --output-dir string           directory for the output files of --recursive, mirroring the directory tree (default next to each Dockerfile)
+  -O, --output-file string          path of the output file, or - for stdout (default "Dockerfile." + output format)
+      --platform strings            target platform that sets the automatic platform ARGs and is shown for each stage, e.g. --platform linux/arm64, several platforms are drawn in one graph that marks what differs (e.g. --platform linux/amd64,linux/arm64)
+  -r, --ranksep float               minimum separation between ranks (default 0.5)
+      --recursive string            graph every Dockerfile, *.Dockerfile, Dockerfile.* and Containerfile in this directory tree
+      --renderer                    how to lay out the graph, one of: builtin, graphviz (default graphviz)
+      --scratch                     how to handle scratch images, one of: collapsed, hidden, separated (default collapsed)
+      --separate strings            external images to display as separate nodes per usage (e.g. --separate ubuntu,alpine)
+      --show-context                draw the build context with the paths that COPY and ADD read from it (default false)
+      --target strings              only show stages required to build the given target(s) (e.g. --target release,app)
+  -u, --unflatten uint              stagger length of leaf edges between [1,u] (default 0)
+      --version                     display the version of dockerfilegraph
+
+Use "dockerfilegraph [command] --help" for more information about a command.
 `
 
 var dockerfileContent = `
@@ -105,6 +135,177 @@ It creates a visual graph representation of the build process.
 			wantErr: true,
 			wantOut: "Error: exec: \"dot-not-found-in-path\": executable file not found in $PATH\n" + usage + "\n",
 		},
+		{
+			name:              "build-arg flag",
+			cliArgs:           []string{"--build-arg", "BASE=alpine:3.20", "--build-arg", "STAGE", "-o", "mermaid", "-O", "-"},
+			dockerfileContent: "ARG BASE=alpine\nARG STAGE\nFROM $BASE AS base\n",
+			wantOut: `flowchart LR
+    external_image_0("alpine:3.20")
+    stage_0("base")
+    external_image_0 --> stage_0
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0 externalImage
+    class stage_0 defaultTarget
+`,
+		},
+		{
+			name:    "build-arg flag without key",
+			cliArgs: []string{"--build-arg", "=value"},
+			wantErr: true,
+			wantOut: "Error: invalid --build-arg \"=value\", expected KEY=VALUE\n" + usage + "\n",
+		},
+		{
+			name: "build-context flag",
+			cliArgs: []string{
+				"--build-context", "alpine=docker-image://alpine:3.20", "--build-context", "base=./base",
+				"-o", "mermaid", "-O", "-",
+			},
+			dockerfileContent: "FROM alpine AS base\nFROM alpine AS app\nCOPY --from=base / /\n",
+			wantOut: `flowchart LR
+    external_image_0("alpine:3.20")
+    external_image_1[/"./base"/]
+    stage_0("base")
+    external_image_0 --> stage_0
+    stage_1("app")
+    external_image_0 --> stage_1
+    external_image_1 -.-> stage_1
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0,external_image_1 externalImage
+    class stage_1 defaultTarget
+`,
+		},
+		{
+			name:              "show-context flag",
+			cliArgs:           []string{"--show-context", "-o", "mermaid", "-O", "-"},
+			dockerfileContent: "FROM golang AS build\nCOPY go.mod go.sum ./\nFROM alpine\nADD config/ /etc/app/\n",
+			wantOut: `flowchart LR
+    external_image_0("golang")
+    external_image_1[/"build context"/]
+    external_image_2("alpine")
+    stage_0("build")
+    external_image_0 --> stage_0
+    external_image_1 -.->|"go.mod go.sum"| stage_0
+    stage_1("1")
+    external_image_2 --> stage_1
+    external_image_1 -.->|"config/"| stage_1
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0,external_image_1,external_image_2 externalImage
+    class stage_1 defaultTarget
+`,
+		},
+		{
+			name:    "platform flag",
+			cliArgs: []string{"--platform", "linux/arm64", "--build-platform", "linux/amd64", "-o", "mermaid", "-O", "-"},
+			dockerfileContent: "FROM --platform=$BUILDPLATFORM golang AS build\n" +
+				"FROM alpine AS base-amd64\nFROM alpine AS base-arm64\n" +
+				"FROM base-${TARGETARCH}\nCOPY --from=build /app /app\n",
+			wantOut: `flowchart LR
+    external_image_0("golang")
+    external_image_1("alpine")
+    stage_0("build<br><small>linux/amd64</small>")
+    external_image_0 --> stage_0
+    stage_1("base-amd64<br><small>linux/arm64, emulated</small>")
+    external_image_1 --> stage_1
+    stage_2("base-arm64<br><small>linux/arm64, emulated</small>")
+    external_image_1 --> stage_2
+    stage_3("3<br><small>linux/arm64, emulated</small>")
+    stage_2 --> stage_3
+    stage_0 -.-> stage_3
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0,external_image_1 externalImage
+    class stage_3 defaultTarget
+`,
+		},
+		{
+			name: "platform flag with several platforms",
+			cliArgs: []string{
+				"--platform", "linux/amd64,linux/arm64", "--build-platform", "linux/amd64", "-o", "mermaid", "-O", "-",
+			},
+			dockerfileContent: "FROM --platform=$BUILDPLATFORM golang AS build\n" +
+				"FROM alpine AS base-amd64\nFROM alpine AS base-arm64\n" +
+				"FROM base-${TARGETARCH}\nCOPY --from=build /app /app\n",
+			wantOut: `flowchart LR
+    external_image_0("golang")
+    external_image_1("alpine")
+    stage_0("build<br><small>linux/amd64</small>")
+    external_image_0 --> stage_0
+    stage_1("base-amd64<br><small>linux/amd64, only for linux/amd64</small>")
+    external_image_1 --> stage_1
+    stage_2("base-arm64<br><small>linux/arm64, emulated, only for linux/arm64</small>")
+    external_image_1 --> stage_2
+    stage_3("3<br><small>linux/amd64, linux/arm64, emulated on linux/arm64</small>")
+    stage_1 -->|"only for linux/amd64"| stage_3
+    stage_2 -->|"only for linux/arm64"| stage_3
+    stage_0 -.-> stage_3
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0,external_image_1 externalImage
+    class stage_3 defaultTarget
+`,
+		},
+		{
+			name:    "build-platform flag without platform",
+			cliArgs: []string{"--build-platform", "linux/amd64"},
+			wantErr: true,
+			wantOut: "Error: --build-platform requires --platform\n" + usage + "\n",
+		},
+		{
+			name:    "platform flag with invalid platform",
+			cliArgs: []string{"--platform", "arm64", "-o", "json"},
+			wantErr: true,
+			wantOut: "Error: invalid platform \"arm64\", expected os/arch[/variant], e.g. linux/arm64\n" + usage + "\n",
+		},
+		{
+			name:    "image-name and image-digest flags",
+			cliArgs: []string{"--image-name", "short", "--image-digest", "fingerprint", "-o", "mermaid", "-O", "-"},
+			dockerfileContent: "FROM alpine:3.23@sha256:4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1 AS base\n" +
+				"FROM ghcr.io/org/team/app:1.0\nCOPY --from=base / /\n",
+			wantOut: `flowchart LR
+    external_image_0("alpine:3.23<br><small>sha256:4bcff63911fc</small>")
+    external_image_1("app:1.0")
+    stage_0("base")
+    external_image_0 --> stage_0
+    stage_1("1")
+    external_image_1 --> stage_1
+    stage_0 -.-> stage_1
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0,external_image_1 externalImage
+    class stage_1 defaultTarget
+`,
+		},
+		{
+			name:    "highlight-unused flag",
+			cliArgs: []string{"--highlight-unused", "--target", "test", "-o", "mermaid", "-O", "-"},
+			dockerfileContent: "FROM alpine:3.23 AS build\nRUN make\n\nFROM build AS test\nRUN make test\n\n" +
+				"FROM build AS lint\nRUN make lint\n",
+			wantOut: `Warning: Dockerfile:7: stage lint is not needed by any target
+flowchart LR
+    external_image_0("alpine:3.23")
+    stage_0("build")
+    external_image_0 --> stage_0
+    stage_1("test")
+    stage_0 --> stage_1
+    stage_2("lint<br><small>unused</small>")
+    stage_0 --> stage_2
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0 externalImage
+    classDef unused stroke:#999999,color:#999999
+    class stage_2 unused
+    class stage_2 defaultTarget
+`,
+		},
+		{
+			name:    "build-context flag without value",
+			cliArgs: []string{"--build-context", "src"},
+			wantErr: true,
+			wantOut: "Error: invalid --build-context \"src\", expected NAME=VALUE\n" + usage + "\n",
+		},
 		{
 			name:    "--max-label-length too small",
 			cliArgs: []string{"--max-label-length", "3"},
@@ -135,18 +336,225 @@ It creates a visual graph representation of the build process.
 			wantOut:     "Successfully created Dockerfile.png\n",
 			wantOutFile: "Dockerfile.png",
 		},
+		{
+			name:              "output flag json",
+			cliArgs:           []string{"--output", "json", "-O", "-"},
+			dockerfileContent: "FROM golang AS build\nFROM scratch\nCOPY --from=build /app /app\n",
+			dotCmd:            "dot-not-found-in-path",
+			wantOut: `{
+  "schemaVersion": 2,
+  "beforeFirstStage": [],
+  "stages": [
+    {
+      "index": 0,
+      "name": "build",
+      "defaultTarget": false,
+      "layers": [
+        {
+          "label": "FROM golang AS build",
+          "waitFors": [
+            {
+              "id": "golang",
+              "type": "from",
+              "kind": "externalImage"
+            }
+          ],
+          "source": {
+            "startLine": 1,
+            "endLine": 1
+          }
+        }
+      ],
+      "source": {
+        "startLine": 1,
+        "endLine": 1
+      }
+    },
+    {
+      "index": 1,
+      "defaultTarget": true,
+      "layers": [
+        {
+          "label": "FROM scratch",
+          "waitFors": [
+            {
+              "id": "scratch",
+              "type": "from",
+              "kind": "externalImage"
+            }
+          ],
+          "source": {
+            "startLine": 2,
+            "endLine": 2
+          }
+        },
+        {
+          "label": "COPY --from=build...",
+          "waitFors": [
+            {
+              "id": "build",
+              "type": "copy",
+              "kind": "stage",
+              "stage": 0,
+              "copy": {
+                "sources": [
+                  "/app"
+                ],
+                "destination": "/app"
+              }
+            }
+          ],
+          "source": {
+            "startLine": 3,
+            "endLine": 3
+          }
+        }
+      ],
+      "source": {
+        "startLine": 2,
+        "endLine": 3
+      }
+    }
+  ],
+  "externalImages": [
+    {
+      "id": "golang",
+      "name": "golang",
+      "type": "image",
+      "registry": "docker.io",
+      "repository": "library/golang"
+    },
+    {
+      "id": "scratch",
+      "name": "scratch",
+      "type": "image"
+    }
+  ]
+}
+`,
+		},
+		{
+			name:        "output flag mermaid",
+			cliArgs:     []string{"--output", "mermaid"},
+			dotCmd:      "dot-not-found-in-path",
+			wantOut:     "Successfully created Dockerfile.mermaid\n",
+			wantOutFile: "Dockerfile.mermaid",
+			wantOutFileContent: `flowchart LR
+    external_image_0("ubuntu:latest")
+    external_image_1("golang:1.19")
+    external_image_2("buildcache")
+    external_image_3("scratch")
+    stage_0("ubuntu")
+    external_image_0 --> stage_0
+    stage_1("build-tool-depend...")
+    external_image_1 --> stage_1
+    external_image_2 -.-o stage_1
+    stage_2("release")
+    external_image_3 --> stage_2
+    stage_0 -.-> stage_2
+    stage_1 -.-> stage_2
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0,external_image_1,external_image_2,external_image_3 externalImage
+    class stage_2 defaultTarget
+`,
+		},
 		{
 			name:        "output flag svg",
 			cliArgs:     []string{"--output", "svg"},
 			wantOut:     "Successfully created Dockerfile.svg\n",
 			wantOutFile: "Dockerfile.svg",
 		},
+		{
+			name:        "renderer flag builtin",
+			cliArgs:     []string{"--renderer", "builtin", "-o", "svg"},
+			dotCmd:      "dot-not-found-in-path",
+			wantOut:     "Successfully created Dockerfile.svg\n",
+			wantOutFile: "Dockerfile.svg",
+		},
+		{
+			name:    "renderer flag builtin with unsupported output",
+			cliArgs: []string{"--renderer", "builtin", "-o", "pdf"},
+			wantErr: true,
+			wantOut: "Error: --renderer builtin does not support --output pdf\n" + usage + "\n",
+		},
+		{
+			name:        "output-file flag",
+			cliArgs:     []string{"--output", "raw", "--output-file", "graph.gv"},
+			wantOut:     "Successfully created graph.gv\n",
+			wantOutFile: "graph.gv",
+		},
+		{
+			name:              "output-file flag with stdout",
+			cliArgs:           []string{"-o", "raw", "-O", "-"},
+			dockerfileContent: "FROM scratch",
+			wantOut: `digraph G {
+	compound=true;
+	nodesep=1.00;
+	rankdir=LR;
+	ranksep=0.50;
+	external_image_0->stage_0;
+	external_image_0 [ color=grey20, fontcolor=grey20, label="scratch", shape=box, style="dashed,rounded", width=2 ];
+	stage_0 [ fillcolor=grey90, label="0", shape=box, style="filled,rounded", width=2 ];
+
+}
+`,
+		},
+		{
+			name:              "link-prefix flag",
+			cliArgs:           []string{"-o", "raw", "-O", "-", "--link-prefix", "https://example.com/Dockerfile"},
+			dockerfileContent: "FROM scratch",
+			wantOut: `digraph G {
+	compound=true;
+	nodesep=1.00;
+	rankdir=LR;
+	ranksep=0.50;
+	external_image_0->stage_0;
+	external_image_0 [ color=grey20, fontcolor=grey20, label="scratch", shape=box, style="dashed,rounded", width=2 ];
+	stage_0 [ URL="https://example.com/Dockerfile#L1", fillcolor=grey90, label="0", shape=box, ` +
+				`style="filled,rounded", tooltip="https://example.com/Dockerfile#L1", width=2 ];
+
+}
+`,
+		},
+		{
+			name:              "output-file flag with stdout and mermaid",
+			cliArgs:           []string{"-o", "mermaid", "-O", "-"},
+			dockerfileContent: "FROM scratch",
+			wantOut: `flowchart LR
+    external_image_0("scratch")
+    stage_0("0")
+    external_image_0 --> stage_0
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0 externalImage
+    class stage_0 defaultTarget
+`,
+		},
 		{
 			name:        "filename flag",
 			cliArgs:     []string{"--filename", "subdir/../Dockerfile"},
 			wantOut:     "Successfully created Dockerfile.pdf\n",
 			wantOutFile: "Dockerfile.pdf",
 		},
+		{
+			name:    "filename flag with stdin",
+			cliArgs: []string{"--filename", "-", "-o", "mermaid", "-O", "-"},
+			stdin:   "FROM golang AS build\nFROM scratch\nCOPY --from=build /app /app\n",
+			wantOut: `flowchart LR
+    external_image_0("golang")
+    external_image_1("scratch")
+    stage_0("build")
+    external_image_0 --> stage_0
+    stage_1("1")
+    external_image_1 --> stage_1
+    stage_0 -.-> stage_1
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0,external_image_1 externalImage
+    class stage_1 defaultTarget
+`,
+		},
 		{
 			name:         "filename flag with missing Dockerfile",
 			cliArgs:      []string{"--filename", "Dockerfile.missing"},
@@ -347,7 +755,7 @@ It creates a visual graph representation of the build process.
 			label=<<table border="0" cellpadding="2" cellspacing="0" cellborder="0">
 	<tr><td align="right" port="i0">FROM&nbsp;...&nbsp;</td></tr>
 	<tr><td align="right" port="i1">COPY --from=...&nbsp;</td></tr>
-	<tr><td align="right" port="i2">RUN --mount=(.*)from=...&nbsp;</td></tr>
+	<tr><td align="right" port="i2">RUN --mount=...&nbsp;</td></tr>
 </table>>,
 			shape=plaintext];
 		key2	[fontname=monospace,
@@ -432,7 +840,7 @@ It creates a visual graph representation of the build process.
 			label=<<table border="0" cellpadding="2" cellspacing="0" cellborder="0">
 	<tr><td align="right" port="i0">FROM&nbsp;...&nbsp;</td></tr>
 	<tr><td align="right" port="i1">COPY --from=...&nbsp;</td></tr>
-	<tr><td align="right" port="i2">RUN --mount=(.*)from=...&nbsp;</td></tr>
+	<tr><td align="right" port="i2">RUN --mount=...&nbsp;</td></tr>
 </table>>,
 			shape=plaintext];
 		key2	[fontname=monospace,
@@ -682,6 +1090,7 @@ It creates a visual graph representation of the build process.
 			}
 			command := cmd.NewRootCmd(buf, inputFS, tt.dotCmd)
 			command.SetArgs(tt.cliArgs)
+			command.SetIn(strings.NewReader(tt.stdin))
 
 			// Redirect Cobra output
 			command.SetOut(buf)
@@ -744,3 +1153,494 @@ func checkWantOut(t *testing.T, tt test, buf *bytes.Buffer) {
 		}
 	}
 }
+
+func TestRootCmdRecursive(t *testing.T) {
+	inputFS := afero.NewMemMapFs()
+	for path, content := range map[string]string{
+		"repo/Dockerfile":                  "FROM alpine\n",
+		"repo/Containerfile":               "FROM alpine\n",
+		"repo/services/api/Dockerfile.dev": "FROM golang AS build\nFROM scratch\nCOPY --from=build / /\n",
+		"repo/web/app.Dockerfile":          "FROM node\n",
+		"repo/web/README.md":               "not a Dockerfile\n",
+		"repo/.git/Dockerfile":             "FROM hidden\n",
+		"repo/Dockerfile.mermaid":          "previous output\n",
+		"repo/Dockerfile.dockerignore":     "node_modules\n",
+		"repo/Dockerfile.md":               "# Notes\n",
+		"repo/Dockerfile.bak":              "FROM alpine\n",
+		"repo/web/Dockerfile.orig":         "FROM node\n",
+	} {
+		_ = afero.WriteFile(inputFS, filepath.FromSlash(path), []byte(content), 0o644)
+	}
+
+	outputDir := t.TempDir()
+	buf := new(bytes.Buffer)
+	command := cmd.NewRootCmd(buf, inputFS, "dot-not-found-in-path")
+	command.SetArgs([]string{
+		"--recursive", "repo", "--output-dir", outputDir, "-o", "mermaid",
+		"--link-prefix", "https://github.com/org/repo/blob/main/",
+	})
+	command.SetOut(buf)
+	command.SetErr(buf)
+
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	wantFiles := []string{
+		"Containerfile.mermaid",
+		"Dockerfile.mermaid",
+		"services/api/Dockerfile.dev.mermaid",
+		"web/app.Dockerfile.mermaid",
+	}
+	wantOut := ""
+	for _, file := range wantFiles {
+		wantOut += "Successfully created " + filepath.Join(outputDir, filepath.FromSlash(file)) + "\n"
+	}
+	if diff := cmp.Diff(wantOut, buf.String()); diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+
+	var gotFiles []string
+	_ = filepath.WalkDir(outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			relPath, _ := filepath.Rel(outputDir, path)
+			gotFiles = append(gotFiles, filepath.ToSlash(relPath))
+		}
+		return err
+	})
+	if diff := cmp.Diff(wantFiles, gotFiles); diff != "" {
+		t.Errorf("Output files mismatch (-want +got):\n%s", diff)
+	}
+
+	content, err := os.ReadFile(filepath.Join(outputDir, "services", "api", "Dockerfile.dev.mermaid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "stage_0 -.-> stage_1") {
+		t.Errorf("Dockerfile.dev.mermaid = %s, did not contain the COPY edge", content)
+	}
+	link := `click stage_0 href "https://github.com/org/repo/blob/main/services/api/Dockerfile.dev#L1"`
+	if !strings.Contains(string(content), link) {
+		t.Errorf("Dockerfile.dev.mermaid = %s, did not contain the link %s", content, link)
+	}
+}
+
+func TestRootCmdRecursiveCombine(t *testing.T) {
+	inputFS := afero.NewMemMapFs()
+	for path, content := range map[string]string{
+		"repo/base/Dockerfile":     "FROM alpine AS build\nFROM build\n",
+		"repo/api/Dockerfile":      "FROM ourorg/base\n",
+		"repo/web/Dockerfile":      "FROM ourorg/web-base:1.0\nCOPY --from=alpine / /\n",
+		"repo/web/base.Dockerfile": "FROM alpine\n",
+		"images.txt":               "# Dockerfile=image\n\nweb/base.Dockerfile=ourorg/web-base:1.0\n",
+	} {
+		_ = afero.WriteFile(inputFS, filepath.FromSlash(path), []byte(content), 0o644)
+	}
+
+	buf := new(bytes.Buffer)
+	command := cmd.NewRootCmd(buf, inputFS, "dot-not-found-in-path")
+	command.SetArgs([]string{
+		"--recursive", "repo", "--combine", "-o", "mermaid", "-O", "-",
+		"--image", "./base/Dockerfile=ourorg/base:latest", "--image-file", "images.txt",
+	})
+	command.SetOut(buf)
+	command.SetErr(buf)
+
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	want := `flowchart LR
+    external_image_0("alpine")
+    subgraph cluster_file_0 ["api/Dockerfile"]
+        stage_0("0")
+    end
+    subgraph cluster_file_1 ["base/Dockerfile"]
+        stage_1("build")
+        stage_2("1")
+    end
+    subgraph cluster_file_2 ["web/Dockerfile"]
+        stage_3("0")
+    end
+    subgraph cluster_file_3 ["web/base.Dockerfile"]
+        stage_4("0")
+    end
+    stage_2 --> stage_0
+    external_image_0 --> stage_1
+    stage_1 --> stage_2
+    stage_4 --> stage_3
+    external_image_0 -.-> stage_3
+    external_image_0 --> stage_4
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0 externalImage
+    class stage_0 defaultTarget
+    class stage_2 defaultTarget
+    class stage_3 defaultTarget
+    class stage_4 defaultTarget
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRootCmdRecursiveCombineTarget(t *testing.T) {
+	inputFS := afero.NewMemMapFs()
+	for path, content := range map[string]string{
+		"repo/base/Dockerfile": "FROM alpine AS build\nFROM build AS test\nFROM build\n",
+		"repo/api/Dockerfile":  "FROM ourorg/base AS test\nFROM ourorg/base\n",
+		"repo/web/Dockerfile":  "FROM node\n",
+	} {
+		_ = afero.WriteFile(inputFS, filepath.FromSlash(path), []byte(content), 0o644)
+	}
+
+	buf := new(bytes.Buffer)
+	command := cmd.NewRootCmd(buf, inputFS, "dot-not-found-in-path")
+	command.SetArgs([]string{
+		"--recursive", "repo", "--combine", "--image", "base/Dockerfile=ourorg/base", "--target", "test",
+		"-o", "mermaid", "-O", "-",
+	})
+	command.SetOut(buf)
+	command.SetErr(buf)
+
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	// The target is only defined by two of the Dockerfiles, and the test
+	// stage of api/Dockerfile needs the final stage of base/Dockerfile.
+	want := `flowchart LR
+    external_image_0("alpine")
+    subgraph cluster_file_0 ["api/Dockerfile"]
+        stage_0("test")
+    end
+    subgraph cluster_file_1 ["base/Dockerfile"]
+        stage_1("build")
+        stage_2("test")
+        stage_3("2")
+    end
+    stage_3 --> stage_0
+    external_image_0 --> stage_1
+    stage_1 --> stage_2
+    stage_1 --> stage_3
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0 externalImage
+    class stage_0 defaultTarget
+    class stage_3 defaultTarget
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRootCmdBake(t *testing.T) {
+	inputFS := afero.NewMemMapFs()
+	_ = afero.WriteFile(inputFS, "Dockerfile", []byte("ARG BASE=alpine\nFROM $BASE AS base\nFROM base AS app\n"), 0o644)
+	_ = afero.WriteFile(inputFS, "docker-bake.hcl", []byte(`
+target "app" {
+  target = "app"
+  args = {
+    BASE = "debian"
+  }
+}
+`), 0o644)
+
+	buf := new(bytes.Buffer)
+	command := cmd.NewRootCmd(buf, inputFS, "dot-not-found-in-path")
+	command.SetArgs([]string{"--bake", "docker-bake.hcl", "--target", "app", "-o", "mermaid", "-O", "-"})
+	command.SetOut(buf)
+	command.SetErr(buf)
+
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	want := `flowchart LR
+    external_image_0("debian")
+    stage_0("base")
+    external_image_0 --> stage_0
+    stage_1("app")
+    stage_0 --> stage_1
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0 externalImage
+    class stage_1 defaultTarget
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRootCmdDockerignore(t *testing.T) {
+	inputFS := afero.NewMemMapFs()
+	_ = afero.WriteFile(inputFS, "Dockerfile", []byte("FROM alpine\nCOPY docs/ /docs\nCOPY src/ /src\n"), 0o644)
+	_ = afero.WriteFile(inputFS, ".dockerignore", []byte("docs\n**/*_test.go\n"), 0o644)
+	_ = afero.WriteFile(inputFS, "docs/README.md", []byte("docs"), 0o644)
+	_ = afero.WriteFile(inputFS, "src/main.go", []byte("package main"), 0o644)
+	_ = afero.WriteFile(inputFS, "src/main_test.go", []byte("package main"), 0o644)
+
+	buf := new(bytes.Buffer)
+	command := cmd.NewRootCmd(buf, inputFS, "dot-not-found-in-path")
+	command.SetArgs([]string{"--show-context", "--max-label-length", "40", "-o", "mermaid", "-O", "-"})
+	command.SetOut(buf)
+	command.SetErr(buf)
+
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	want := `Warning: Dockerfile:2: "docs/" is excluded by .dockerignore, so nothing is copied
+flowchart LR
+    external_image_0("alpine")
+    external_image_1[/"build context"/]
+    stage_0("0")
+    external_image_0 --> stage_0
+    external_image_1 -.->|"src/ excluding **/*_test.go"| stage_0
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0,external_image_1 externalImage
+    class stage_0 defaultTarget
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRootCmdDockerignoreStdin(t *testing.T) {
+	inputFS := afero.NewMemMapFs()
+	_ = afero.WriteFile(inputFS, ".dockerignore", []byte("docs\n"), 0o644)
+	_ = afero.WriteFile(inputFS, "docs/README.md", []byte("docs"), 0o644)
+
+	buf := new(bytes.Buffer)
+	command := cmd.NewRootCmd(buf, inputFS, "dot-not-found-in-path")
+	command.SetArgs([]string{"--filename", "-", "--show-context", "-o", "mermaid", "-O", "-"})
+	command.SetIn(strings.NewReader("FROM alpine\nCOPY docs/ /docs\n"))
+	command.SetOut(buf)
+	command.SetErr(buf)
+
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	want := `Warning: line 2: "docs/" is excluded by .dockerignore, so nothing is copied
+flowchart LR
+    external_image_0("alpine")
+    stage_0("0")
+    external_image_0 --> stage_0
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0 externalImage
+    class stage_0 defaultTarget
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRootCmdLint(t *testing.T) {
+	inputFS := afero.NewMemMapFs()
+	_ = afero.WriteFile(inputFS, "Dockerfile", []byte(
+		"FROM golang:1.22 AS build\nFROM golang:1.22 AS test\nFROM scratch\nCOPY --from=0 /app /app\n",
+	), 0o644)
+	_ = afero.WriteFile(
+		inputFS, "clean.Dockerfile", []byte("FROM scratch AS build\nFROM scratch\nCOPY --from=build / /\n"), 0o644,
+	)
+	_ = afero.WriteFile(inputFS, "arch.Dockerfile", []byte(
+		"FROM scratch AS base-amd64\nFROM scratch AS base-arm64\nFROM base-${TARGETARCH}\n",
+	), 0o644)
+
+	tests := []struct {
+		name          string
+		cliArgs       []string
+		wantErr       bool
+		wantErrSubstr string // Instead of the output, which contains the usage
+		wantOut       string
+	}{
+		{
+			name:    "text output",
+			cliArgs: []string{"lint"},
+			wantErr: true,
+			wantOut: `Dockerfile:2: warning: stage test is not needed by any target (unreachable-stage)
+Dockerfile:1: warning: image golang:1.22 is used by tag without a digest (image-without-digest)
+Dockerfile:2: warning: image golang:1.22 is used by tag without a digest (image-without-digest)
+Dockerfile:2: warning: stage test uses the same base image golang:1.22 as stage build (duplicate-base-image)
+Dockerfile:4: warning: stage build is referenced by its index 0 instead of a name (numeric-stage-reference)
+Error: found 5 problem(s)
+`,
+		},
+		{
+			name:          "unknown target",
+			cliArgs:       []string{"lint", "--target", "test", "-f", "clean.Dockerfile"},
+			wantErr:       true,
+			wantErrSubstr: `target "test" not found`,
+		},
+		{
+			name:    "json output without problems",
+			cliArgs: []string{"lint", "-f", "clean.Dockerfile", "-o", "json"},
+			wantOut: "{\n  \"findings\": []\n}\n",
+		},
+		{
+			name:    "build platform as the default target platform",
+			cliArgs: []string{"lint", "-f", "arch.Dockerfile", "--build-platform", "linux/arm64"},
+			wantErr: true,
+			wantOut: `arch.Dockerfile:1: warning: stage base-amd64 is not needed by any target (unreachable-stage)
+Error: found 1 problem(s)
+`,
+		},
+		{
+			name:    "several platforms",
+			cliArgs: []string{"lint", "-f", "arch.Dockerfile", "--platform", "linux/amd64,linux/arm64"},
+			wantOut: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			command := cmd.NewRootCmd(buf, inputFS, "dot-not-found-in-path")
+			command.SetArgs(tt.cliArgs)
+			command.SetOut(buf)
+			command.SetErr(buf)
+
+			err := command.Execute()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("Execute() error = %v, want it to contain %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if diff := cmp.Diff(tt.wantOut, buf.String()); diff != "" {
+				t.Errorf("Output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRootCmdCompose(t *testing.T) {
+	inputFS := afero.NewMemMapFs()
+	_ = afero.WriteFile(inputFS, "Dockerfile", []byte("FROM alpine AS base\nFROM base AS api\nFROM base AS worker\n"), 0o644)
+	_ = afero.WriteFile(inputFS, "compose.yaml", []byte(`
+services:
+  api:
+    build:
+      context: .
+      target: api
+  worker:
+    build: .
+`), 0o644)
+
+	buf := new(bytes.Buffer)
+	command := cmd.NewRootCmd(buf, inputFS, "dot-not-found-in-path")
+	command.SetArgs([]string{"--compose", "compose.yaml", "-o", "mermaid", "-O", "-"})
+	command.SetOut(buf)
+	command.SetErr(buf)
+
+	if err := command.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	want := `flowchart LR
+    external_image_0("alpine")
+    stage_0("base")
+    external_image_0 --> stage_0
+    stage_1("api")
+    stage_0 --> stage_1
+    stage_2("worker")
+    stage_0 --> stage_2
+    service_0(["api"])
+    service_0 --> stage_1
+    service_1(["worker"])
+    service_1 --> stage_2
+    classDef externalImage stroke:#333333,color:#333333,stroke-dasharray:5 5
+    classDef defaultTarget fill:#e5e5e5
+    class external_image_0 externalImage
+    classDef service stroke-width:2px
+    class service_0,service_1 service
+    class stage_2 defaultTarget
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRootCmdRecursiveErrors(t *testing.T) {
+	inputFS := afero.NewMemMapFs()
+	_ = afero.WriteFile(inputFS, "repo/good/Dockerfile", []byte("FROM alpine\n"), 0o644)
+	_ = afero.WriteFile(inputFS, "repo/bad/Dockerfile", []byte("# only a comment\n"), 0o644)
+	_ = afero.WriteFile(inputFS, "empty/README.md", []byte("nothing to see here\n"), 0o644)
+
+	tests := []struct {
+		name          string
+		cliArgs       []string
+		wantErrSubstr string
+	}{
+		{
+			name:          "no Dockerfiles",
+			cliArgs:       []string{"--recursive", "empty", "-o", "json"},
+			wantErrSubstr: "could not find any Dockerfiles in empty",
+		},
+		{
+			name:          "one Dockerfile fails",
+			cliArgs:       []string{"--recursive", "repo", "--output-dir", t.TempDir(), "-o", "json"},
+			wantErrSubstr: filepath.Join("repo", "bad", "Dockerfile") + ": ",
+		},
+		{
+			name:          "filename and recursive",
+			cliArgs:       []string{"--recursive", "repo", "--filename", "Dockerfile"},
+			wantErrSubstr: "[filename recursive] were all set",
+		},
+		{
+			name:          "output-file without combine",
+			cliArgs:       []string{"--recursive", "repo", "--output-file", "graph.json", "-o", "json"},
+			wantErrSubstr: "--output-file cannot be used with --recursive, unless --combine is set",
+		},
+		{
+			name:          "combine without recursive",
+			cliArgs:       []string{"--combine", "-o", "json"},
+			wantErrSubstr: "--combine requires --recursive",
+		},
+		{
+			name:          "image without combine",
+			cliArgs:       []string{"--recursive", "repo", "--image", "Dockerfile=ourorg/base", "-o", "json"},
+			wantErrSubstr: "--image and --image-file require --combine",
+		},
+		{
+			name: "invalid image mapping",
+			cliArgs: []string{
+				"--recursive", "repo", "--combine", "--image", "ourorg/base", "-o", "json", "-O", "-",
+			},
+			wantErrSubstr: `invalid image mapping "ourorg/base", expected DOCKERFILE=IMAGE`,
+		},
+		{
+			name: "image mapping without Dockerfile",
+			cliArgs: []string{
+				"--recursive", "repo/good", "--combine", "-o", "json", "-O", "-",
+				"--image", "Dockerfile=ourorg/good", "--image", "repo/good/Dockerfile=ourorg/good",
+			},
+			wantErrSubstr: "could not find the Dockerfiles of the image mappings in repo/good: " +
+				filepath.Join("repo", "good", "Dockerfile"),
+		},
+		{
+			name:          "output-dir without recursive",
+			cliArgs:       []string{"--output-dir", "graphs", "-o", "json"},
+			wantErrSubstr: "--output-dir requires --recursive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			command := cmd.NewRootCmd(buf, inputFS, "dot-not-found-in-path")
+			command.SetArgs(tt.cliArgs)
+			command.SetOut(buf)
+			command.SetErr(buf)
+
+			err := command.Execute()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("Execute() error = %v, want it to contain %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
@@ -1,43 +0,0 @@
-// Package dockerfile2dot provides the functionality for loading a Dockerfile
-// and converting it into a GraphViz DOT file.
-package dockerfile2dot
-
-import (
-	"errors"
-	"fmt"
-	"io/fs"
-	"path/filepath"
-
-	"github.com/spf13/afero"
-)
-
-// LoadAndParseDockerfile looks for the Dockerfile and returns a
-// SimplifiedDockerfile.
-func LoadAndParseDockerfile(
-	inputFS afero.Fs,
-	filename string,
-	opts ParseOptions,
-) (SimplifiedDockerfile, error) {
-	content, err := afero.ReadFile(inputFS, filename)
-	if err != nil {
-		if errors.Is(err, fs.ErrNotExist) {
-			absFilePath, absErr := filepath.Abs(filename)
-			if absErr != nil {
-				return SimplifiedDockerfile{}, fmt.Errorf("could not get absolute path for %q: %w", filename, absErr)
-			}
-			return SimplifiedDockerfile{}, errors.New("could not find a Dockerfile at " + absFilePath)
-		}
-		return SimplifiedDockerfile{}, err
-	}
-	sdf, err := dockerfileToSimplifiedDockerfile(content, opts)
-	if err != nil {
-		return SimplifiedDockerfile{}, err
-	}
-	if len(opts.Targets) > 0 {
-		sdf, err = filterToTargets(sdf, opts.Targets)
-		if err != nil {
-			return SimplifiedDockerfile{}, err
-		}
-	}
-	return sdf, nil
-}
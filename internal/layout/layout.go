@@ -0,0 +1,641 @@
+// Package layout arranges directed graphs in layers from left to right and
+// renders them as SVG, so that graphs can be drawn without Graphviz.
+//
+// The layout follows the classic Sugiyama approach: cycles are broken,
+// nodes are assigned to ranks, long edges are split by dummy nodes, the
+// order within each rank is improved with the barycenter heuristic, and
+// finally coordinates are assigned. Clusters are laid out on their own first
+// and then treated as a single node of the surrounding graph.
+package layout
+
+import (
+	"math"
+	"sort"
+)
+
+const pointsPerInch = 72
+
+// Graph is a directed graph that is laid out from left to right.
+type Graph struct {
+	Nodes    []*Node
+	Edges    []*Edge
+	Clusters []*Cluster
+	NodeSep  float64 // Minimum space between two adjacent nodes in the same rank, in inches
+	RankSep  float64 // Minimum separation between ranks, in inches
+}
+
+// Node is a labeled box in the graph.
+type Node struct {
+	ID         string
+	Label      string
+	Badge      string   // A second line below the label in a smaller font
+	Cluster    *Cluster // The cluster the node belongs to, if any
+	Width      float64  // Minimum width in inches
+	Plain      bool     // Draw only the label, without a border
+	Rounded    bool
+	Folder     bool // Draw a tab on top of the box, like the folder shape of Graphviz
+	Note       bool // Fold the top right corner, like the note shape of Graphviz
+	Component  bool // Draw two small boxes on the left side, like the component shape of Graphviz
+	Cylinder   bool // Draw a cylinder instead of a box
+	Hexagon    bool // Draw a hexagon instead of a box
+	Trapezium  bool // Draw a trapezium instead of a box
+	Dashed     bool
+	Filled     bool
+	Color      string
+	FillColor  string
+	FontColor  string
+	FontFamily string
+	FontSize   float64
+	PenWidth   float64
+	URL        string // Open this link when the node is clicked
+
+	x, y, w, h float64 // Center and size in points, set by the layout
+}
+
+// Edge connects two nodes.
+type Edge struct {
+	From        *Node
+	To          *Node
+	TailCluster *Cluster // Clip the edge at the border of this cluster, like ltail in Graphviz
+	HeadCluster *Cluster // Clip the edge at the border of this cluster, like lhead in Graphviz
+	Dashed      bool
+	Dotted      bool
+	ArrowHead   string // One of "normal" (the default), "empty", "ediamond" and "odot"
+	Label       string // Drawn above the middle of the edge
+	Tooltip     string // Shown when hovering over the edge
+	Bold        bool
+
+	points []point // The route of the edge, set by the layout
+}
+
+// Cluster groups nodes inside a labeled box.
+type Cluster struct {
+	ID        string
+	Label     string
+	Color     string // The color of the border and the label, black by default
+	FillColor string
+	Margin    float64 // Space between the border and the nodes, in points
+	URL       string  // Open this link when the cluster is clicked
+
+	x, y, w, h float64 // Top left corner and size in points, set by the layout
+}
+
+type point struct{ x, y float64 }
+
+// box is a rectangle that takes part in a layered layout. It is either a
+// node, a whole cluster, or a dummy that carries a long edge across a rank.
+type box struct {
+	w, h  float64
+	x, y  float64 // Center
+	rank  int
+	dummy bool
+}
+
+// link is a directed connection between two boxes.
+type link struct{ from, to int }
+
+const (
+	defaultFontSize = 14
+	badgeFontSize   = 10
+	nodeHeight      = 0.5 * pointsPerInch
+	labelPadding    = 8
+	dummySep        = 4
+)
+
+// textWidth estimates the rendered width of s, as the exact font metrics are
+// only known to the viewer.
+func textWidth(s string, fontSize float64) float64 {
+	return float64(len([]rune(s))) * fontSize * 0.55
+}
+
+func (n *Node) fontSize() float64 {
+	if n.FontSize > 0 {
+		return n.FontSize
+	}
+	return defaultFontSize
+}
+
+// measure sets the size of the node based on its label.
+func (n *Node) measure() {
+	n.w = math.Max(n.Width*pointsPerInch, textWidth(n.Label, n.fontSize())+2*labelPadding)
+	n.h = nodeHeight
+	if n.Plain {
+		n.h = n.fontSize() + labelPadding
+	}
+	if n.Badge != "" {
+		n.w = math.Max(n.w, textWidth(n.Badge, badgeFontSize)+2*labelPadding)
+		n.h += badgeFontSize
+	}
+}
+
+// layoutGraph computes the position of all nodes, clusters and edges.
+func layoutGraph(g *Graph) {
+	nodeSep := g.NodeSep * pointsPerInch
+	rankSep := g.RankSep * pointsPerInch
+
+	for _, n := range g.Nodes {
+		n.measure()
+	}
+
+	// Lay out the inside of every cluster on its own.
+	clusterBoxes := make(map[*Cluster]*box, len(g.Clusters))
+	contentWidths := make(map[*Cluster]float64, len(g.Clusters))
+	for _, c := range g.Clusters {
+		var members []*Node
+		for _, n := range g.Nodes {
+			if n.Cluster == c {
+				members = append(members, n)
+			}
+		}
+		var edges []*Edge
+		for _, e := range g.Edges {
+			if e.From.Cluster == c && e.To.Cluster == c {
+				edges = append(edges, e)
+			}
+		}
+		w, h := layoutNodes(members, edges, nodeSep, rankSep)
+		contentWidths[c] = w
+		labelHeight := 0.0
+		if c.Label != "" {
+			labelHeight = defaultFontSize + labelPadding
+			w = math.Max(w, textWidth(c.Label, defaultFontSize))
+		}
+		c.w = w + 2*c.Margin
+		c.h = h + 2*c.Margin + labelHeight
+		clusterBoxes[c] = &box{w: c.w, h: c.h}
+	}
+
+	// Lay out the clusters and the remaining nodes as the top-level graph.
+	var units []*box
+	unitIndex := make(map[any]int)
+	for _, c := range g.Clusters {
+		unitIndex[c] = len(units)
+		units = append(units, clusterBoxes[c])
+	}
+	for _, n := range g.Nodes {
+		if n.Cluster == nil {
+			unitIndex[n] = len(units)
+			units = append(units, &box{w: n.w, h: n.h})
+		}
+	}
+	unitOf := func(n *Node) int {
+		if n.Cluster != nil {
+			return unitIndex[n.Cluster]
+		}
+		return unitIndex[n]
+	}
+
+	var links []link
+	var outerEdges []*Edge
+	for _, e := range g.Edges {
+		if e.From.Cluster != nil && e.From.Cluster == e.To.Cluster {
+			continue
+		}
+		links = append(links, link{from: unitOf(e.From), to: unitOf(e.To)})
+		outerEdges = append(outerEdges, e)
+	}
+	routes := layered(units, links, nodeSep, rankSep)
+
+	// Move the clusters and their members to their final position.
+	for _, c := range g.Clusters {
+		b := clusterBoxes[c]
+		c.x = b.x - b.w/2
+		c.y = b.y - b.h/2
+		offsetX := c.x + c.Margin + (c.w-2*c.Margin-contentWidths[c])/2
+		offsetY := c.y + c.Margin
+		if c.Label != "" {
+			offsetY += defaultFontSize + labelPadding
+		}
+		for _, n := range g.Nodes {
+			if n.Cluster == c {
+				n.x += offsetX
+				n.y += offsetY
+			}
+		}
+		for _, e := range g.Edges {
+			if e.From.Cluster == c && e.To.Cluster == c {
+				for i := range e.points {
+					e.points[i].x += offsetX
+					e.points[i].y += offsetY
+				}
+			}
+		}
+	}
+	for _, n := range g.Nodes {
+		if n.Cluster == nil {
+			b := units[unitIndex[n]]
+			n.x, n.y = b.x, b.y
+		}
+	}
+
+	// Route the edges between top-level units through their dummy nodes.
+	for i, e := range outerEdges {
+		e.points = routeEdge(e, routes[i])
+	}
+	for _, e := range g.Edges {
+		if e.From.Cluster != nil && e.From.Cluster == e.To.Cluster {
+			e.points = routeEdge(e, e.points)
+		}
+	}
+}
+
+// layoutNodes lays out nodes that are not grouped further, relative to the
+// origin, and returns the size of the resulting drawing.
+func layoutNodes(nodes []*Node, edges []*Edge, nodeSep, rankSep float64) (float64, float64) {
+	if len(nodes) == 0 {
+		return 0, 0
+	}
+
+	index := make(map[*Node]int, len(nodes))
+	boxes := make([]*box, len(nodes))
+	for i, n := range nodes {
+		index[n] = i
+		boxes[i] = &box{w: n.w, h: n.h}
+	}
+	links := make([]link, len(edges))
+	for i, e := range edges {
+		links[i] = link{from: index[e.From], to: index[e.To]}
+	}
+
+	routes := layered(boxes, links, nodeSep, rankSep)
+
+	var w, h float64
+	for i, n := range nodes {
+		n.x, n.y = boxes[i].x, boxes[i].y
+		w = math.Max(w, n.x+n.w/2)
+		h = math.Max(h, n.y+n.h/2)
+	}
+	for i, e := range edges {
+		e.points = routes[i]
+	}
+	return w, h
+}
+
+// routeEdge returns the route of an edge from the right side of its tail to
+// the left side of its head, passing through the given waypoints.
+func routeEdge(e *Edge, waypoints []point) []point {
+	startX := e.From.x + e.From.w/2
+	if e.TailCluster != nil {
+		startX = e.TailCluster.x + e.TailCluster.w
+	}
+	endX := e.To.x - e.To.w/2
+	if e.HeadCluster != nil {
+		endX = e.HeadCluster.x
+	}
+	points := []point{{startX, e.From.y}}
+	points = append(points, waypoints...)
+	return append(points, point{endX, e.To.y})
+}
+
+// layered assigns a center position to every box so that links point from
+// left to right. It returns the waypoints of every link, i.e. the positions
+// of the dummy boxes that were inserted for links spanning several ranks.
+func layered(boxes []*box, links []link, nodeSep, rankSep float64) [][]point {
+	dag, reversed := removeCycles(len(boxes), links)
+	assignRanks(boxes, dag)
+
+	// Split links that span more than one rank into chains of dummy boxes.
+	all := append([]*box(nil), boxes...)
+	var segments []link
+	chains := make([][]int, len(links))
+	for i, l := range dag {
+		if l.from == l.to {
+			continue
+		}
+		prev := l.from
+		for r := all[l.from].rank + 1; r < all[l.to].rank; r++ {
+			all = append(all, &box{rank: r, dummy: true})
+			dummy := len(all) - 1
+			segments = append(segments, link{from: prev, to: dummy})
+			chains[i] = append(chains[i], dummy)
+			prev = dummy
+		}
+		segments = append(segments, link{from: prev, to: l.to})
+	}
+
+	ranks := orderRanks(all, segments)
+	assignCoordinates(all, ranks, segments, nodeSep, rankSep)
+
+	routes := make([][]point, len(links))
+	for i, chain := range chains {
+		for _, b := range chain {
+			routes[i] = append(routes[i], point{all[b].x, all[b].y})
+		}
+		if reversed[i] {
+			for l, r := 0, len(routes[i])-1; l < r; l, r = l+1, r-1 {
+				routes[i][l], routes[i][r] = routes[i][r], routes[i][l]
+			}
+		}
+	}
+	return routes
+}
+
+// removeCycles returns the links with every back edge of a depth-first
+// search reversed, which makes the graph acyclic.
+func removeCycles(n int, links []link) ([]link, []bool) {
+	successors := make([][]int, n)
+	for i, l := range links {
+		successors[l.from] = append(successors[l.from], i)
+	}
+
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := make([]int, n)
+	dag := append([]link(nil), links...)
+	reversed := make([]bool, len(links))
+
+	var visit func(v int)
+	visit = func(v int) {
+		state[v] = active
+		for _, i := range successors[v] {
+			switch state[links[i].to] {
+			case unvisited:
+				visit(links[i].to)
+			case active:
+				dag[i] = link{from: links[i].to, to: links[i].from}
+				reversed[i] = true
+			}
+		}
+		state[v] = done
+	}
+	for v := range n {
+		if state[v] == unvisited {
+			visit(v)
+		}
+	}
+	return dag, reversed
+}
+
+// assignRanks places every box one rank after its latest predecessor, and
+// then moves sources as close to their successors as possible.
+func assignRanks(boxes []*box, dag []link) {
+	order := topologicalOrder(len(boxes), dag)
+
+	for _, v := range order {
+		boxes[v].rank = 0
+	}
+	for _, v := range order {
+		for _, l := range dag {
+			if l.from == v && l.to != v {
+				boxes[l.to].rank = max(boxes[l.to].rank, boxes[v].rank+1)
+			}
+		}
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		v := order[i]
+		hasPredecessor := false
+		nearest := math.MaxInt
+		for _, l := range dag {
+			if l.to == v && l.from != v {
+				hasPredecessor = true
+			}
+			if l.from == v && l.to != v {
+				nearest = min(nearest, boxes[l.to].rank-1)
+			}
+		}
+		if !hasPredecessor && nearest != math.MaxInt {
+			boxes[v].rank = nearest
+		}
+	}
+}
+
+// topologicalOrder returns the boxes of an acyclic graph in topological
+// order, preferring lower indices to keep the result deterministic.
+func topologicalOrder(n int, dag []link) []int {
+	inDegree := make([]int, n)
+	for _, l := range dag {
+		if l.from != l.to {
+			inDegree[l.to]++
+		}
+	}
+	var queue, order []int
+	for v := range n {
+		if inDegree[v] == 0 {
+			queue = append(queue, v)
+		}
+	}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		order = append(order, v)
+		for _, l := range dag {
+			if l.from == v && l.to != v {
+				inDegree[l.to]--
+				if inDegree[l.to] == 0 {
+					queue = append(queue, l.to)
+				}
+			}
+		}
+	}
+	return order
+}
+
+// orderRanks groups the boxes by rank and reduces edge crossings between
+// adjacent ranks with the barycenter heuristic.
+func orderRanks(boxes []*box, segments []link) [][]int {
+	maxRank := 0
+	for _, b := range boxes {
+		maxRank = max(maxRank, b.rank)
+	}
+	ranks := make([][]int, maxRank+1)
+	for i, b := range boxes {
+		ranks[b.rank] = append(ranks[b.rank], i)
+	}
+
+	position := make([]float64, len(boxes))
+	updatePositions := func() {
+		for _, rank := range ranks {
+			for i, b := range rank {
+				position[b] = float64(i)
+			}
+		}
+	}
+	updatePositions()
+
+	best := cloneRanks(ranks)
+	bestCrossings := countCrossings(ranks, segments, position)
+
+	sortByBarycenter := func(rank []int, neighbor func(link) (int, int)) {
+		barycenter := make(map[int]float64, len(rank))
+		for _, b := range rank {
+			sum, count := 0.0, 0
+			for _, s := range segments {
+				if self, other := neighbor(s); self == b {
+					sum += position[other]
+					count++
+				}
+			}
+			barycenter[b] = position[b]
+			if count > 0 {
+				barycenter[b] = sum / float64(count)
+			}
+		}
+		sort.SliceStable(rank, func(i, j int) bool {
+			return barycenter[rank[i]] < barycenter[rank[j]]
+		})
+		for i, b := range rank {
+			position[b] = float64(i)
+		}
+	}
+
+	for range 8 {
+		for r := 1; r < len(ranks); r++ {
+			sortByBarycenter(ranks[r], func(s link) (int, int) { return s.to, s.from })
+		}
+		for r := len(ranks) - 2; r >= 0; r-- {
+			sortByBarycenter(ranks[r], func(s link) (int, int) { return s.from, s.to })
+		}
+		if crossings := countCrossings(ranks, segments, position); crossings < bestCrossings {
+			best = cloneRanks(ranks)
+			bestCrossings = crossings
+		}
+	}
+
+	return best
+}
+
+func cloneRanks(ranks [][]int) [][]int {
+	clone := make([][]int, len(ranks))
+	for i, rank := range ranks {
+		clone[i] = append([]int(nil), rank...)
+	}
+	return clone
+}
+
+// countCrossings returns the number of pairs of segments that cross.
+func countCrossings(ranks [][]int, segments []link, position []float64) int {
+	rankOf := make(map[int]int)
+	for r, rank := range ranks {
+		for _, b := range rank {
+			rankOf[b] = r
+		}
+	}
+	crossings := 0
+	for i, a := range segments {
+		for _, b := range segments[i+1:] {
+			if rankOf[a.from] != rankOf[b.from] || rankOf[a.to] != rankOf[b.to] {
+				continue
+			}
+			if (position[a.from]-position[b.from])*(position[a.to]-position[b.to]) < 0 {
+				crossings++
+			}
+		}
+	}
+	return crossings
+}
+
+// assignCoordinates places the ranks next to each other and moves every box
+// as close to the average position of its neighbors as the order allows.
+func assignCoordinates(boxes []*box, ranks [][]int, segments []link, nodeSep, rankSep float64) {
+	left := 0.0
+	for _, rank := range ranks {
+		width := 0.0
+		for _, b := range rank {
+			width = math.Max(width, boxes[b].w)
+		}
+		for _, b := range rank {
+			boxes[b].x = left + width/2
+		}
+		left += width + rankSep
+	}
+
+	gap := func(a, b *box) float64 {
+		sep := nodeSep
+		if a.dummy || b.dummy {
+			sep = dummySep
+		}
+		return (a.h+b.h)/2 + sep
+	}
+
+	for _, rank := range ranks {
+		y := 0.0
+		for i, b := range rank {
+			if i > 0 {
+				y += gap(boxes[rank[i-1]], boxes[b])
+			}
+			boxes[b].y = y
+		}
+	}
+
+	align := func(r int, neighbor func(link) (int, int)) {
+		rank := ranks[r]
+		desired := make([]float64, len(rank))
+		for i, b := range rank {
+			sum, count := 0.0, 0
+			for _, s := range segments {
+				if self, other := neighbor(s); self == b {
+					sum += boxes[other].y
+					count++
+				}
+			}
+			desired[i] = boxes[b].y
+			if count > 0 {
+				desired[i] = sum / float64(count)
+			}
+		}
+		gaps := make([]float64, len(rank))
+		for i := 1; i < len(rank); i++ {
+			gaps[i] = gap(boxes[rank[i-1]], boxes[rank[i]])
+		}
+		for i, y := range separate(desired, gaps) {
+			boxes[rank[i]].y = y
+		}
+	}
+
+	for range 8 {
+		for r := 1; r < len(ranks); r++ {
+			align(r, func(s link) (int, int) { return s.to, s.from })
+		}
+		for r := len(ranks) - 2; r >= 0; r-- {
+			align(r, func(s link) (int, int) { return s.from, s.to })
+		}
+	}
+
+	top := math.Inf(1)
+	for _, b := range boxes {
+		top = math.Min(top, b.y-b.h/2)
+	}
+	for _, b := range boxes {
+		b.y -= top
+	}
+}
+
+// separate returns the positions closest to desired (in the least squares
+// sense) that keep at least gaps[i] between position i-1 and i. It solves
+// the equivalent isotonic regression with the pool adjacent violators
+// algorithm.
+func separate(desired, gaps []float64) []float64 {
+	type block struct {
+		sum   float64
+		count int
+	}
+	offset := make([]float64, len(desired))
+	for i := 1; i < len(desired); i++ {
+		offset[i] = offset[i-1] + gaps[i]
+	}
+
+	var blocks []block
+	for i, d := range desired {
+		blocks = append(blocks, block{sum: d - offset[i], count: 1})
+		for len(blocks) > 1 {
+			last, prev := blocks[len(blocks)-1], blocks[len(blocks)-2]
+			if prev.sum/float64(prev.count) <= last.sum/float64(last.count) {
+				break
+			}
+			blocks = blocks[:len(blocks)-2]
+			blocks = append(blocks, block{sum: prev.sum + last.sum, count: prev.count + last.count})
+		}
+	}
+
+	positions := make([]float64, 0, len(desired))
+	for _, b := range blocks {
+		for range b.count {
+			positions = append(positions, b.sum/float64(b.count)+offset[len(positions)])
+		}
+	}
+	return positions
+}
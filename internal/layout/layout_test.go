@@ -0,0 +1,127 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_separate(t *testing.T) {
+	tests := []struct {
+		name    string
+		desired []float64
+		gaps    []float64
+		want    []float64
+	}{
+		{
+			name:    "no conflicts",
+			desired: []float64{0, 10, 20},
+			gaps:    []float64{0, 5, 5},
+			want:    []float64{0, 10, 20},
+		},
+		{
+			name:    "overlapping nodes are pushed apart around their mean",
+			desired: []float64{10, 10},
+			gaps:    []float64{0, 10},
+			want:    []float64{5, 15},
+		},
+		{
+			name:    "order is preserved",
+			desired: []float64{20, 0},
+			gaps:    []float64{0, 4},
+			want:    []float64{8, 12},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, separate(tt.desired, tt.gaps)); diff != "" {
+				t.Errorf("separate() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_removeCycles(t *testing.T) {
+	links := []link{{0, 1}, {1, 2}, {2, 0}}
+	dag, reversed := removeCycles(3, links)
+	if diff := cmp.Diff([]link{{0, 1}, {1, 2}, {0, 2}}, dag, cmp.AllowUnexported(link{})); diff != "" {
+		t.Errorf("removeCycles() dag mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]bool{false, false, true}, reversed); diff != "" {
+		t.Errorf("removeCycles() reversed mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	cluster := &Cluster{ID: "cluster", Label: "stage", Margin: 16}
+	image := &Node{ID: "image", Label: "ubuntu", Width: 2, Dashed: true}
+	first := &Node{ID: "first", Label: "FROM ubuntu", Cluster: cluster}
+	second := &Node{ID: "second", Label: "RUN <script>", Cluster: cluster}
+	final := &Node{ID: "final", Label: "final", Filled: true, FillColor: "#e5e5e5", URL: "Dockerfile#L3-L4"}
+	other := &Node{ID: "other", Label: "other"}
+
+	g := &Graph{
+		Nodes:    []*Node{image, first, second, final, other},
+		Clusters: []*Cluster{cluster},
+		Edges: []*Edge{
+			{From: image, To: first, HeadCluster: cluster},
+			{From: first, To: second},
+			{From: second, To: final, TailCluster: cluster, ArrowHead: "empty", Dashed: true},
+			{From: image, To: final, ArrowHead: "ediamond", Dotted: true},
+			{From: other, To: final},
+		},
+		NodeSep: 1,
+		RankSep: 0.5,
+	}
+
+	var b strings.Builder
+	if err := WriteSVG(&b, g); err != nil {
+		t.Fatalf("WriteSVG() error = %v", err)
+	}
+	got := b.String()
+
+	for _, want := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg"`,
+		`<g id="cluster" class="cluster">`,
+		`<g id="final" class="node">`,
+		`RUN &lt;script&gt;</text>`,
+		`<g id="second&#45;&gt;final" class="edge">`,
+		`marker-end="url(#arrow-ediamond)"`,
+		`<a xlink:href="Dockerfile#L3-L4" xlink:title="Dockerfile#L3-L4">`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteSVG() = %v, did not contain %v", got, want)
+		}
+	}
+
+	// Edges into a cluster end at its border.
+	if end := g.Edges[0].points[len(g.Edges[0].points)-1]; end.x != cluster.x {
+		t.Errorf("edge image -> first ends at x=%.2f, not at the cluster border x=%.2f", end.x, cluster.x)
+	}
+
+	// Every edge points from left to right.
+	for _, e := range g.Edges {
+		if e.From.x >= e.To.x {
+			t.Errorf("edge %s -> %s points from x=%.2f to x=%.2f", e.From.ID, e.To.ID, e.From.x, e.To.x)
+		}
+	}
+
+	// Nodes do not overlap each other.
+	for i, a := range g.Nodes {
+		for _, b := range g.Nodes[i+1:] {
+			if a.x-a.w/2 < b.x+b.w/2 && b.x-b.w/2 < a.x+a.w/2 &&
+				a.y-a.h/2 < b.y+b.h/2 && b.y-b.h/2 < a.y+a.h/2 {
+				t.Errorf("nodes %s and %s overlap", a.ID, b.ID)
+			}
+		}
+	}
+
+	// Cluster members are inside the cluster.
+	for _, n := range []*Node{first, second} {
+		if n.x-n.w/2 < cluster.x || n.x+n.w/2 > cluster.x+cluster.w ||
+			n.y-n.h/2 < cluster.y || n.y+n.h/2 > cluster.y+cluster.h {
+			t.Errorf("node %s is outside of its cluster", n.ID)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package layout
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	margin          = 4
+	defaultFont     = "Times,serif"
+	defaultColor    = "black"
+	clusterRadius   = 4
+	nodeRadius      = 6
+	defaultPenWidth = 1
+	boldPenWidth    = 2
+	folderTabWidth  = 24
+	folderTabHeight = 4
+	noteFoldSize    = 8
+	componentWidth  = 8
+	componentHeight = 4
+	cylinderRadius  = 4
+	slantWidth      = 10
+	edgeFontSize    = 10
+)
+
+// WriteSVG lays out the graph and writes it to w as an SVG document.
+func WriteSVG(w io.Writer, g *Graph) error {
+	layoutGraph(g)
+
+	width, height := 0.0, 0.0
+	for _, n := range g.Nodes {
+		width = math.Max(width, n.x+n.w/2)
+		height = math.Max(height, n.y+n.h/2)
+	}
+	for _, c := range g.Clusters {
+		width = math.Max(width, c.x+c.w)
+		height = math.Max(height, c.y+c.h)
+	}
+	width += 2 * margin
+	height += 2 * margin
+
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%.0fpt" height="%.0fpt" viewBox="0.00 0.00 %.2f %.2f">
+<defs>
+<marker id="arrow-normal" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="10" markerHeight="7" `+
+		`markerUnits="userSpaceOnUse" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="black" stroke="black"/></marker>
+<marker id="arrow-empty" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="10" markerHeight="7" `+
+		`markerUnits="userSpaceOnUse" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="white" stroke="black"/></marker>
+<marker id="arrow-ediamond" viewBox="0 0 12 8" refX="12" refY="4" markerWidth="12" markerHeight="8" `+
+		`markerUnits="userSpaceOnUse" orient="auto"><path d="M0,4 L6,0 L12,4 L6,8 z" fill="white" stroke="black"/></marker>
+<marker id="arrow-odot" viewBox="0 0 8 8" refX="8" refY="4" markerWidth="8" markerHeight="8" `+
+		`markerUnits="userSpaceOnUse" orient="auto"><circle cx="4" cy="4" r="3.5" fill="white" stroke="black"/></marker>
+</defs>
+<g id="graph0" class="graph" transform="translate(%d %d)">
+<rect x="%d" y="%d" width="%.2f" height="%.2f" fill="white" stroke="none"/>
+`, width, height, width, height, margin, margin, -margin, -margin, width, height)
+
+	for _, c := range g.Clusters {
+		writeCluster(bw, c)
+	}
+	for _, e := range g.Edges {
+		writeEdge(bw, e)
+	}
+	for _, n := range g.Nodes {
+		writeNode(bw, n)
+	}
+
+	fmt.Fprint(bw, "</g>\n</svg>\n")
+
+	return bw.Flush()
+}
+
+func writeCluster(w io.Writer, c *Cluster) {
+	fill := "none"
+	if c.FillColor != "" {
+		fill = c.FillColor
+	}
+	fmt.Fprintf(w, `<g id="%s" class="cluster">
+<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" rx="%d" fill="%s" stroke="%s"/>
+`, attr(c.ID), c.x, c.y, c.w, c.h, clusterRadius, attr(fill), attr(orDefault(c.Color, defaultColor)))
+	if c.Label != "" {
+		writeLinkStart(w, c.URL)
+		writeText(
+			w, c.x+c.w/2, c.y+c.Margin/2+defaultFontSize, c.Label, defaultFont, defaultFontSize,
+			orDefault(c.Color, defaultColor),
+		)
+		writeLinkEnd(w, c.URL)
+	}
+	fmt.Fprint(w, "</g>\n")
+}
+
+func writeNode(w io.Writer, n *Node) {
+	fmt.Fprintf(w, "<g id=\"%s\" class=\"node\">\n", attr(n.ID))
+	writeLinkStart(w, n.URL)
+
+	if !n.Plain {
+		rx := 0
+		if n.Rounded {
+			rx = nodeRadius
+		}
+		fill := "none"
+		if n.Filled {
+			fill = n.FillColor
+		}
+		penWidth := n.PenWidth
+		if penWidth == 0 {
+			penWidth = defaultPenWidth
+		}
+		if outline := outlinePath(n); outline != "" {
+			fmt.Fprintf(
+				w, `<path d="%s" fill="%s" stroke="%s" stroke-width="%g"%s/>
+`,
+				outline, attr(fill), attr(orDefault(n.Color, defaultColor)), penWidth, dashArray(n.Dashed, false),
+			)
+		} else {
+			fmt.Fprintf(
+				w, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" rx="%d" fill="%s" stroke="%s" stroke-width="%g"%s/>
+`,
+				n.x-n.w/2, n.y-n.h/2, n.w, n.h, rx, attr(fill), attr(orDefault(n.Color, defaultColor)), penWidth,
+				dashArray(n.Dashed, false),
+			)
+		}
+		if n.Folder {
+			left, top := n.x+n.w/2-folderTabWidth-folderTabHeight, n.y-n.h/2
+			fmt.Fprintf(
+				w, `<path d="M%.2f,%.2f l%d,-%d h%d l%d,%d" fill="none" stroke="%s" stroke-width="%g"%s/>
+`,
+				left, top, folderTabHeight, folderTabHeight, folderTabWidth-folderTabHeight, folderTabHeight, folderTabHeight,
+				attr(orDefault(n.Color, defaultColor)), penWidth, dashArray(n.Dashed, false),
+			)
+		}
+		if n.Note {
+			right, top := n.x+n.w/2, n.y-n.h/2
+			fmt.Fprintf(
+				w, `<path d="M%.2f,%.2f v%d h%d" fill="none" stroke="%s" stroke-width="%g"%s/>
+`,
+				right-noteFoldSize, top, noteFoldSize, noteFoldSize,
+				attr(orDefault(n.Color, defaultColor)), penWidth, dashArray(n.Dashed, false),
+			)
+		}
+		if n.Component {
+			for _, y := range []float64{n.y - n.h/4, n.y + n.h/4} {
+				fmt.Fprintf(
+					w, `<rect x="%.2f" y="%.2f" width="%d" height="%d" fill="white" stroke="%s" stroke-width="%g"%s/>
+`,
+					n.x-n.w/2-componentWidth/2, y-componentHeight/2, componentWidth, componentHeight,
+					attr(orDefault(n.Color, defaultColor)), penWidth, dashArray(n.Dashed, false),
+				)
+			}
+		}
+	}
+
+	// With a badge, both lines are centered together
+	labelY := n.y
+	if n.Badge != "" {
+		labelY -= badgeFontSize / 2
+	}
+	writeText(
+		w, n.x, labelY, n.Label,
+		orDefault(n.FontFamily, defaultFont), n.fontSize(), orDefault(n.FontColor, defaultColor),
+	)
+	if n.Badge != "" {
+		writeText(
+			w, n.x, labelY+(n.fontSize()+badgeFontSize)/2, n.Badge,
+			orDefault(n.FontFamily, defaultFont), badgeFontSize, orDefault(n.FontColor, defaultColor),
+		)
+	}
+
+	writeLinkEnd(w, n.URL)
+	fmt.Fprint(w, "</g>\n")
+}
+
+// outlinePath returns the SVG path of a node that is not a box, or an empty
+// string for boxes.
+func outlinePath(n *Node) string {
+	left, right, top, bottom := n.x-n.w/2, n.x+n.w/2, n.y-n.h/2, n.y+n.h/2
+	switch {
+	case n.Cylinder:
+		// The whole top ellipse, then the left side, the bottom and the
+		// right side
+		return fmt.Sprintf(
+			"M%.2f,%.2f a%.2f,%d 0 0,1 %.2f,0 a%.2f,%d 0 0,1 %.2f,0 v%.2f a%.2f,%d 0 0,0 %.2f,0 v%.2f",
+			left, top+cylinderRadius, n.w/2, cylinderRadius, n.w, n.w/2, cylinderRadius, -n.w,
+			n.h-2*cylinderRadius, n.w/2, cylinderRadius, n.w, -(n.h - 2*cylinderRadius),
+		)
+	case n.Hexagon:
+		return fmt.Sprintf(
+			"M%.2f,%.2f L%.2f,%.2f L%.2f,%.2f L%.2f,%.2f L%.2f,%.2f L%.2f,%.2f z",
+			left, n.y, left+slantWidth, top, right-slantWidth, top, right, n.y, right-slantWidth, bottom,
+			left+slantWidth, bottom,
+		)
+	case n.Trapezium:
+		return fmt.Sprintf(
+			"M%.2f,%.2f L%.2f,%.2f L%.2f,%.2f L%.2f,%.2f z",
+			left, bottom, left+slantWidth, top, right-slantWidth, top, right, bottom,
+		)
+	default:
+		return ""
+	}
+}
+
+func writeEdge(w io.Writer, e *Edge) {
+	if len(e.points) < 2 {
+		return
+	}
+
+	// Connect the points with curves that leave and enter horizontally.
+	var d strings.Builder
+	fmt.Fprintf(&d, "M%.2f,%.2f", e.points[0].x, e.points[0].y)
+	for i := 1; i < len(e.points); i++ {
+		from, to := e.points[i-1], e.points[i]
+		dx := (to.x - from.x) / 2
+		fmt.Fprintf(&d, " C%.2f,%.2f %.2f,%.2f %.2f,%.2f", from.x+dx, from.y, to.x-dx, to.y, to.x, to.y)
+	}
+
+	arrowHead := e.ArrowHead
+	if arrowHead == "" {
+		arrowHead = "normal"
+	}
+
+	// Like Graphviz, only bold edges have a stroke width.
+	strokeWidth := ""
+	if e.Bold {
+		strokeWidth = fmt.Sprintf(` stroke-width="%d"`, boldPenWidth)
+	}
+
+	fmt.Fprintf(w, "<g id=\"%s&#45;&gt;%s\" class=\"edge\">\n", attr(e.From.ID), attr(e.To.ID))
+	if e.Tooltip != "" {
+		fmt.Fprintf(w, "<title>%s</title>\n", attr(e.Tooltip))
+	}
+	fmt.Fprintf(w, `<path d="%s" fill="none" stroke="%s"%s%s marker-end="url(#arrow-%s)"/>
+`, d.String(), defaultColor, strokeWidth, dashArray(e.Dashed, e.Dotted), attr(arrowHead))
+	if e.Label != "" {
+		// The middle point of the route, or the middle between the two
+		// middle points
+		from, to := e.points[(len(e.points)-1)/2], e.points[len(e.points)/2]
+		writeText(w, (from.x+to.x)/2, (from.y+to.y)/2-edgeFontSize, e.Label, defaultFont, edgeFontSize, defaultColor)
+	}
+	fmt.Fprint(w, "</g>\n")
+}
+
+func writeText(w io.Writer, x, y float64, text, fontFamily string, fontSize float64, color string) {
+	fmt.Fprintf(
+		w, `<text text-anchor="middle" x="%.2f" y="%.2f" font-family="%s" font-size="%.2f" fill="%s">%s</text>
+`,
+		x, y+fontSize*0.35, attr(fontFamily), fontSize, attr(color), html.EscapeString(text),
+	)
+}
+
+// writeLinkStart opens a link like Graphviz does for the URL attribute,
+// including a tooltip that shows the link.
+func writeLinkStart(w io.Writer, url string) {
+	if url != "" {
+		fmt.Fprintf(w, "<a xlink:href=\"%s\" xlink:title=\"%s\">\n<title>%s</title>\n", attr(url), attr(url), attr(url))
+	}
+}
+
+func writeLinkEnd(w io.Writer, url string) {
+	if url != "" {
+		fmt.Fprint(w, "</a>\n")
+	}
+}
+
+func dashArray(dashed, dotted bool) string {
+	switch {
+	case dashed:
+		return ` stroke-dasharray="5,2"`
+	case dotted:
+		return ` stroke-dasharray="1,5"`
+	default:
+		return ""
+	}
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func attr(s string) string {
+	return html.EscapeString(s)
+}
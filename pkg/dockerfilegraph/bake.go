@@ -0,0 +1,538 @@
+package dockerfilegraph
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
+	"github.com/hashicorp/hcl/v2/ext/userfunc"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/spf13/afero"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// bakeVariables contains the variable blocks of a bake file. They are
+// decoded first, because the other blocks may refer to them.
+type bakeVariables struct {
+	Variables []bakeVariable `hcl:"variable,block"`
+	Remain    hcl.Body       `hcl:",remain"`
+}
+
+type bakeVariable struct {
+	Name    string         `hcl:"name,label"`
+	Default hcl.Expression `hcl:"default,optional"`
+	Remain  hcl.Body       `hcl:",remain"`
+}
+
+// bakeFile contains the parts of a bake file that affect the graph.
+// Everything else, like platforms or outputs, is ignored.
+type bakeFile struct {
+	Groups  []bakeGroup  `hcl:"group,block"`
+	Targets []bakeTarget `hcl:"target,block"`
+	Remain  hcl.Body     `hcl:",remain"`
+}
+
+type bakeGroup struct {
+	Name    string   `hcl:"name,label"`
+	Targets []string `hcl:"targets,optional"`
+	Remain  hcl.Body `hcl:",remain"`
+}
+
+type bakeTarget struct {
+	Name             string             `hcl:"name,label"`
+	Inherits         []string           `hcl:"inherits,optional"`
+	Args             map[string]*string `hcl:"args,optional"`
+	Context          *string            `hcl:"context,optional"`
+	Contexts         map[string]string  `hcl:"contexts,optional"`
+	Dockerfile       *string            `hcl:"dockerfile,optional"`
+	DockerfileInline *string            `hcl:"dockerfile-inline,optional"`
+	Tags             []string           `hcl:"tags,optional"`
+	Target           *string            `hcl:"target,optional"`
+	Remain           hcl.Body           `hcl:",remain"`
+}
+
+// LoadBakeFile reads a docker-bake.hcl or docker-bake.json file and returns
+// the graph of the selected bake targets. opts.Targets names bake targets and
+// groups instead of stages, and defaults to the default group. Each target is
+// parsed with its args and named contexts, and filtered to its target stage.
+// Several targets are combined with CombineDockerfiles, so that a target
+// using the image or a target: context of another target is linked to it.
+func LoadBakeFile(
+	ctx context.Context,
+	inputFS afero.Fs,
+	filename string,
+	opts ParseOptions,
+) (SimplifiedDockerfile, error) {
+	targets, err := readBakeFile(inputFS, filename)
+	if err != nil {
+		return SimplifiedDockerfile{}, err
+	}
+
+	names, err := targets.selectTargets(opts.Targets)
+	if err != nil {
+		return SimplifiedDockerfile{}, err
+	}
+
+	inputs := make([]CombineInput, 0, len(names))
+	for _, name := range names {
+		target := targets.targets[name]
+		dockerfile, err := loadBakeTarget(ctx, inputFS, filepath.Dir(filename), target, opts)
+		if err != nil {
+			return SimplifiedDockerfile{}, fmt.Errorf("target %q: %w", name, err)
+		}
+		inputs = append(inputs, CombineInput{
+			File:       name,
+			Dockerfile: dockerfile,
+			Images:     append([]string{"target:" + name}, target.Tags...),
+		})
+	}
+
+	if len(inputs) == 1 {
+		return inputs[0].Dockerfile, nil
+	}
+	return CombineDockerfiles(inputs), nil
+}
+
+// loadBakeTarget parses the Dockerfile of a bake target. Relative paths are
+// resolved like bake does, the context relative to the bake file and the
+// Dockerfile relative to the context.
+func loadBakeTarget(
+	ctx context.Context,
+	inputFS afero.Fs,
+	dir string,
+	target bakeTarget,
+	opts ParseOptions,
+) (SimplifiedDockerfile, error) {
+	// Build args from the command line take precedence, like bake --set.
+	buildArgs := make(map[string]string, len(target.Args)+len(opts.BuildArgs))
+	for key, value := range target.Args {
+		if value != nil {
+			buildArgs[key] = *value
+		}
+	}
+	maps.Copy(buildArgs, opts.BuildArgs)
+	opts.BuildArgs = buildArgs
+
+	contexts := maps.Clone(target.Contexts)
+	if contexts == nil {
+		contexts = make(map[string]string)
+	}
+	maps.Copy(contexts, opts.Contexts)
+	opts.Contexts = contexts
+
+	opts.Targets = nil
+	if target.Target != nil && *target.Target != "" {
+		opts.Targets = []string{*target.Target}
+	}
+
+	if target.DockerfileInline != nil {
+		return ParseDockerfile(ctx, strings.NewReader(*target.DockerfileInline), opts)
+	}
+
+	contextDir := "."
+	if target.Context != nil {
+		contextDir = *target.Context
+	}
+	if !filepath.IsAbs(contextDir) {
+		contextDir = filepath.Join(dir, contextDir)
+	}
+	dockerfile := "Dockerfile"
+	if target.Dockerfile != nil {
+		dockerfile = *target.Dockerfile
+	}
+	if !filepath.IsAbs(dockerfile) {
+		dockerfile = filepath.Join(contextDir, dockerfile)
+	}
+	opts.ContextDir = contextDir
+
+	sdf, err := LoadAndParseDockerfile(ctx, inputFS, dockerfile, opts)
+	if err != nil {
+		return SimplifiedDockerfile{}, err
+	}
+	// The links of the stages are relative to the directory of the bake file.
+	if relPath, err := filepath.Rel(dir, dockerfile); err == nil {
+		setStagePaths(sdf.Stages, relPath)
+	}
+	return sdf, nil
+}
+
+// bakeTargets are the targets and groups of a bake file, with inherited
+// attributes already resolved.
+type bakeTargets struct {
+	file    string
+	order   []string // The names of the targets in the order of the bake file
+	targets map[string]bakeTarget
+	groups  map[string][]string
+}
+
+// readBakeFile parses a bake file in HCL or, if its extension is .json, in
+// JSON format.
+func readBakeFile(inputFS afero.Fs, filename string) (bakeTargets, error) {
+	content, err := afero.ReadFile(inputFS, filename)
+	if err != nil {
+		return bakeTargets{}, err
+	}
+
+	parser := hclparse.NewParser()
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		file, diags = parser.ParseJSON(content, filename)
+	} else {
+		file, diags = parser.ParseHCL(content, filename)
+	}
+	if diags.HasErrors() {
+		return bakeTargets{}, diags
+	}
+
+	evalCtx, err := bakeEvalContext(file.Body)
+	if err != nil {
+		return bakeTargets{}, err
+	}
+
+	var bake bakeFile
+	if diags := gohcl.DecodeBody(file.Body, evalCtx, &bake); diags.HasErrors() {
+		return bakeTargets{}, diags
+	}
+
+	// Blocks with the same name are merged, later ones taking precedence.
+	declared := make(map[string]bakeTarget, len(bake.Targets))
+	var order []string
+	for _, target := range bake.Targets {
+		if existing, ok := declared[target.Name]; ok {
+			target = mergeBakeTargets(existing, target)
+		} else {
+			order = append(order, target.Name)
+		}
+		declared[target.Name] = target
+	}
+
+	targets := bakeTargets{
+		file:    filename,
+		order:   order,
+		targets: make(map[string]bakeTarget, len(declared)),
+		groups:  make(map[string][]string, len(bake.Groups)),
+	}
+	for _, name := range order {
+		target, err := resolveInherits(declared, name, nil)
+		if err != nil {
+			return bakeTargets{}, err
+		}
+		targets.targets[name] = target
+	}
+	for _, group := range bake.Groups {
+		targets.groups[group.Name] = append(targets.groups[group.Name], group.Targets...)
+	}
+
+	return targets, nil
+}
+
+// bakeEvalContext evaluates the variables of a bake file and provides the
+// functions of bake, see bakeFunctions, and the functions that are defined
+// with function blocks. Like bake, an environment variable with the same name
+// overrides the default value. Variables may refer to other variables
+// declared later in the file, so they are resolved in dependency order.
+func bakeEvalContext(body hcl.Body) (*hcl.EvalContext, error) {
+	evalCtx := &hcl.EvalContext{Variables: map[string]cty.Value{}, Functions: bakeFunctions()}
+
+	userFuncs, body, diags := userfunc.DecodeUserFunctions(body, "function", func() *hcl.EvalContext {
+		return evalCtx
+	})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	maps.Copy(evalCtx.Functions, userFuncs)
+
+	var variables bakeVariables
+	if diags := gohcl.DecodeBody(body, nil, &variables); diags.HasErrors() {
+		return nil, diags
+	}
+	declared := make(map[string]bakeVariable, len(variables.Variables))
+	for _, variable := range variables.Variables {
+		declared[variable.Name] = variable
+	}
+
+	for _, variable := range variables.Variables {
+		if err := resolveBakeVariable(evalCtx, declared, variable.Name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return evalCtx, nil
+}
+
+// resolveBakeVariable adds the value of a variable to evalCtx, after the
+// variables that its default value refers to. visiting contains the
+// variables that are being resolved, to detect cycles.
+func resolveBakeVariable(
+	evalCtx *hcl.EvalContext, declared map[string]bakeVariable, name string, visiting []string,
+) error {
+	if _, ok := evalCtx.Variables[name]; ok {
+		return nil
+	}
+	if slices.Contains(visiting, name) {
+		return fmt.Errorf(
+			"bake variable %q refers to itself: %s", name, strings.Join(append(visiting, name), " -> "),
+		)
+	}
+	variable := declared[name]
+
+	if value, ok := os.LookupEnv(name); ok {
+		evalCtx.Variables[name] = cty.StringVal(value)
+		return nil
+	}
+	for _, traversal := range variable.Default.Variables() {
+		if _, ok := declared[traversal.RootName()]; !ok {
+			continue
+		}
+		if err := resolveBakeVariable(evalCtx, declared, traversal.RootName(), append(visiting, name)); err != nil {
+			return err
+		}
+	}
+
+	value, diags := variable.Default.Value(evalCtx)
+	if diags.HasErrors() {
+		return diags
+	}
+	if value.IsNull() {
+		value = cty.StringVal("")
+	}
+	evalCtx.Variables[name] = value
+	return nil
+}
+
+// resolveInherits returns the target with the attributes of the targets it
+// inherits from. visiting contains the targets that are being resolved, to
+// detect cycles.
+func resolveInherits(declared map[string]bakeTarget, name string, visiting []string) (bakeTarget, error) {
+	if slices.Contains(visiting, name) {
+		return bakeTarget{}, fmt.Errorf(
+			"bake target %q inherits from itself: %s", name, strings.Join(append(visiting, name), " -> "),
+		)
+	}
+	target, ok := declared[name]
+	if !ok {
+		return bakeTarget{}, fmt.Errorf("bake target %q not found", name)
+	}
+
+	resolved := bakeTarget{Name: name}
+	for _, parent := range target.Inherits {
+		inherited, err := resolveInherits(declared, parent, append(visiting, name))
+		if err != nil {
+			return bakeTarget{}, err
+		}
+		resolved = mergeBakeTargets(resolved, inherited)
+	}
+	resolved = mergeBakeTargets(resolved, target)
+	resolved.Name = name
+
+	return resolved, nil
+}
+
+// mergeBakeTargets returns base with the attributes that are set in
+// override. Maps are merged key by key.
+func mergeBakeTargets(base, override bakeTarget) bakeTarget {
+	merged := base
+	merged.Name = override.Name
+	merged.Inherits = override.Inherits
+	if override.Context != nil {
+		merged.Context = override.Context
+	}
+	if override.Dockerfile != nil {
+		merged.Dockerfile = override.Dockerfile
+	}
+	if override.DockerfileInline != nil {
+		merged.DockerfileInline = override.DockerfileInline
+	}
+	if override.Target != nil {
+		merged.Target = override.Target
+	}
+	if override.Tags != nil {
+		merged.Tags = override.Tags
+	}
+	if override.Args != nil {
+		merged.Args = maps.Clone(base.Args)
+		if merged.Args == nil {
+			merged.Args = make(map[string]*string, len(override.Args))
+		}
+		maps.Copy(merged.Args, override.Args)
+	}
+	if override.Contexts != nil {
+		merged.Contexts = maps.Clone(base.Contexts)
+		if merged.Contexts == nil {
+			merged.Contexts = make(map[string]string, len(override.Contexts))
+		}
+		maps.Copy(merged.Contexts, override.Contexts)
+	}
+	return merged
+}
+
+// selectTargets expands the given target and group names into target names.
+// Without names, the default group or target is used, or all targets if the
+// bake file has neither. Targets that are used by a target: context of a
+// selected target are selected as well, because bake builds them first.
+func (b bakeTargets) selectTargets(names []string) ([]string, error) {
+	if len(names) == 0 {
+		names = b.order
+		if _, ok := b.groups["default"]; ok {
+			names = []string{"default"}
+		} else if _, ok := b.targets["default"]; ok {
+			names = []string{"default"}
+		}
+	}
+
+	var selected []string
+	var add func(name string, visiting []string) error
+	add = func(name string, visiting []string) error {
+		name = strings.TrimSpace(name)
+		if name == "" || slices.Contains(selected, name) {
+			return nil
+		}
+		if slices.Contains(visiting, name) {
+			return fmt.Errorf("bake group %q contains itself", name)
+		}
+		if groupTargets, ok := b.groups[name]; ok {
+			for _, target := range groupTargets {
+				if err := add(target, append(visiting, name)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		target, ok := b.targets[name]
+		if !ok {
+			return fmt.Errorf("target %q not found in %s", name, b.file)
+		}
+		selected = append(selected, name)
+		for _, source := range slices.Sorted(maps.Values(target.Contexts)) {
+			if dependency, ok := strings.CutPrefix(source, "target:"); ok {
+				if err := add(dependency, nil); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, name := range names {
+		if err := add(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return selected, nil
+}
+
+// unsupportedBakeFunctions are the functions of bake that are not available
+// in go-cty, e.g. hashes, UUIDs and network functions. They fail with a
+// clear error instead of the error for an unknown function.
+var unsupportedBakeFunctions = []string{
+	"base64decode", "base64encode", "basename", "bcrypt", "cidrhost", "cidrnetmask", "cidrsubnet", "cidrsubnets",
+	"convert", "dirname", "homedir", "md5", "rsadecrypt", "sanitize", "sha1", "sha256", "sha512", "timestamp",
+	"urlencode", "uuid", "uuidv5",
+}
+
+// bakeFunctions returns the functions that bake provides for HCL
+// expressions, see https://docs.docker.com/build/bake/stdlib/
+func bakeFunctions() map[string]function.Function {
+	functions := map[string]function.Function{
+		"absolute":               stdlib.AbsoluteFunc,
+		"add":                    stdlib.AddFunc,
+		"and":                    stdlib.AndFunc,
+		"byteslen":               stdlib.BytesLenFunc,
+		"bytesslice":             stdlib.BytesSliceFunc,
+		"can":                    tryfunc.CanFunc,
+		"ceil":                   stdlib.CeilFunc,
+		"chomp":                  stdlib.ChompFunc,
+		"chunklist":              stdlib.ChunklistFunc,
+		"coalesce":               stdlib.CoalesceFunc,
+		"coalescelist":           stdlib.CoalesceListFunc,
+		"compact":                stdlib.CompactFunc,
+		"concat":                 stdlib.ConcatFunc,
+		"contains":               stdlib.ContainsFunc,
+		"csvdecode":              stdlib.CSVDecodeFunc,
+		"distinct":               stdlib.DistinctFunc,
+		"divide":                 stdlib.DivideFunc,
+		"element":                stdlib.ElementFunc,
+		"equal":                  stdlib.EqualFunc,
+		"flatten":                stdlib.FlattenFunc,
+		"floor":                  stdlib.FloorFunc,
+		"format":                 stdlib.FormatFunc,
+		"formatdate":             stdlib.FormatDateFunc,
+		"formatlist":             stdlib.FormatListFunc,
+		"greaterthan":            stdlib.GreaterThanFunc,
+		"greaterthanorequalto":   stdlib.GreaterThanOrEqualToFunc,
+		"hasindex":               stdlib.HasIndexFunc,
+		"indent":                 stdlib.IndentFunc,
+		"index":                  stdlib.IndexFunc,
+		"int":                    stdlib.IntFunc,
+		"join":                   stdlib.JoinFunc,
+		"jsondecode":             stdlib.JSONDecodeFunc,
+		"jsonencode":             stdlib.JSONEncodeFunc,
+		"keys":                   stdlib.KeysFunc,
+		"length":                 stdlib.LengthFunc,
+		"lessthan":               stdlib.LessThanFunc,
+		"lessthanorequalto":      stdlib.LessThanOrEqualToFunc,
+		"log":                    stdlib.LogFunc,
+		"lookup":                 stdlib.LookupFunc,
+		"lower":                  stdlib.LowerFunc,
+		"max":                    stdlib.MaxFunc,
+		"merge":                  stdlib.MergeFunc,
+		"min":                    stdlib.MinFunc,
+		"modulo":                 stdlib.ModuloFunc,
+		"multiply":               stdlib.MultiplyFunc,
+		"negate":                 stdlib.NegateFunc,
+		"not":                    stdlib.NotFunc,
+		"notequal":               stdlib.NotEqualFunc,
+		"or":                     stdlib.OrFunc,
+		"parseint":               stdlib.ParseIntFunc,
+		"pow":                    stdlib.PowFunc,
+		"range":                  stdlib.RangeFunc,
+		"regex":                  stdlib.RegexFunc,
+		"regex_replace":          stdlib.RegexReplaceFunc,
+		"regexall":               stdlib.RegexAllFunc,
+		"replace":                stdlib.ReplaceFunc,
+		"reverse":                stdlib.ReverseFunc,
+		"reverselist":            stdlib.ReverseListFunc,
+		"sethaselement":          stdlib.SetHasElementFunc,
+		"setintersection":        stdlib.SetIntersectionFunc,
+		"setproduct":             stdlib.SetProductFunc,
+		"setsubtract":            stdlib.SetSubtractFunc,
+		"setsymmetricdifference": stdlib.SetSymmetricDifferenceFunc,
+		"setunion":               stdlib.SetUnionFunc,
+		"signum":                 stdlib.SignumFunc,
+		"slice":                  stdlib.SliceFunc,
+		"sort":                   stdlib.SortFunc,
+		"split":                  stdlib.SplitFunc,
+		"strlen":                 stdlib.StrlenFunc,
+		"substr":                 stdlib.SubstrFunc,
+		"subtract":               stdlib.SubtractFunc,
+		"timeadd":                stdlib.TimeAddFunc,
+		"title":                  stdlib.TitleFunc,
+		"trim":                   stdlib.TrimFunc,
+		"trimprefix":             stdlib.TrimPrefixFunc,
+		"trimspace":              stdlib.TrimSpaceFunc,
+		"trimsuffix":             stdlib.TrimSuffixFunc,
+		"try":                    tryfunc.TryFunc,
+		"upper":                  stdlib.UpperFunc,
+		"values":                 stdlib.ValuesFunc,
+		"zipmap":                 stdlib.ZipmapFunc,
+	}
+	for _, name := range unsupportedBakeFunctions {
+		functions[name] = function.New(&function.Spec{
+			VarParam: &function.Parameter{Name: "args", Type: cty.DynamicPseudoType, AllowNull: true},
+			Type: func([]cty.Value) (cty.Type, error) {
+				return cty.NilType, fmt.Errorf("the bake function %s is not supported by dockerfilegraph", name)
+			},
+		})
+	}
+	return functions
+}
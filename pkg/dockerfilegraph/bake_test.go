@@ -0,0 +1,328 @@
+package dockerfilegraph
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/spf13/afero"
+)
+
+func TestLoadBakeFile(t *testing.T) {
+	inputFS := afero.NewMemMapFs()
+	for path, content := range map[string]string{
+		"project/Dockerfile": `ARG GO_VERSION=1.21
+FROM golang:${GO_VERSION} AS build
+FROM base AS test
+FROM alpine AS release
+COPY --from=build / /
+`,
+		"project/base/Dockerfile": "FROM alpine\n",
+		"project/docker-bake.hcl": `
+variable "GO_VERSION" {
+  default = "1.22"
+}
+
+group "default" {
+  targets = ["release"]
+}
+
+group "all" {
+  targets = ["release", "test"]
+}
+
+target "_common" {
+  args = {
+    GO_VERSION = "${GO_VERSION}"
+  }
+}
+
+target "base" {
+  context = "base"
+  platforms = ["linux/amd64"]
+}
+
+target "release" {
+  inherits = ["_common"]
+  target   = "release"
+}
+
+target "test" {
+  inherits = ["_common"]
+  target   = "test"
+  contexts = {
+    base = "target:base"
+  }
+}
+`,
+		"project/docker-bake.json": `{
+  "target": {
+    "release": {
+      "target": "release",
+      "args": {"GO_VERSION": "1.23"},
+      "contexts": {"alpine": "docker-image://alpine:3.20"}
+    }
+  }
+}`,
+		"project/cycle.hcl": `
+target "a" {
+  inherits = ["b"]
+}
+
+target "b" {
+  inherits = ["a"]
+}
+`,
+	} {
+		_ = afero.WriteFile(inputFS, path, []byte(content), 0o644)
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		opts     ParseOptions
+		want     SimplifiedDockerfile
+		wantErr  string
+	}{
+		{
+			name:     "default group with args from variables",
+			filename: "project/docker-bake.hcl",
+			want: SimplifiedDockerfile{
+				BeforeFirstStage: []Layer{{Label: "ARG GO_VERSION=1.21"}},
+				ExternalImages: []ExternalImage{
+					{ID: "golang:1.22", Name: "golang:1.22"},
+					{ID: "alpine", Name: "alpine"},
+				},
+				Stages: []Stage{
+					{Name: "build", Layers: []Layer{{
+						Label: "FROM golang:1.22 AS build", WaitFors: []WaitFor{{ID: "golang:1.22", Type: WaitForFrom}},
+					}}},
+					{Name: "release", Layers: []Layer{
+						{Label: "FROM alpine AS release", WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}}},
+						{Label: "COPY --from=build / /", WaitFors: []WaitFor{{ID: "build", Type: WaitForCopy}}},
+					}},
+				},
+			},
+		},
+		{
+			name:     "group with target context",
+			filename: "project/docker-bake.hcl",
+			opts:     ParseOptions{BuildArgs: map[string]string{"GO_VERSION": "1.24"}, Targets: []string{"all"}},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "golang:1.24", Name: "golang:1.24"},
+					{ID: "alpine", Name: "alpine"},
+				},
+				Stages: []Stage{
+					{Name: "build", File: "release", Layers: []Layer{{
+						Label: "FROM golang:1.24 AS build", WaitFors: []WaitFor{{ID: "golang:1.24", Type: WaitForFrom}},
+					}}},
+					{Name: "release", File: "release", Layers: []Layer{
+						{Label: "FROM alpine AS release", WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}}},
+						{Label: "COPY --from=build / /", WaitFors: []WaitFor{{ID: "0", Type: WaitForCopy}}},
+					}},
+					{Name: "test", File: "test", Layers: []Layer{{
+						Label: "FROM base AS test", WaitFors: []WaitFor{{ID: "3", Type: WaitForFrom}},
+					}}},
+					{File: "base", Layers: []Layer{{
+						Label: "FROM alpine", WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}},
+					}}},
+				},
+			},
+		},
+		{
+			name:     "JSON with docker-image context",
+			filename: "project/docker-bake.json",
+			want: SimplifiedDockerfile{
+				BeforeFirstStage: []Layer{{Label: "ARG GO_VERSION=1.21"}},
+				ExternalImages: []ExternalImage{
+					{ID: "golang:1.23", Name: "golang:1.23"},
+					{ID: "alpine", Name: "alpine:3.20"},
+				},
+				Stages: []Stage{
+					{Name: "build", Layers: []Layer{{
+						Label: "FROM golang:1.23 AS build", WaitFors: []WaitFor{{ID: "golang:1.23", Type: WaitForFrom}},
+					}}},
+					{Name: "release", Layers: []Layer{
+						{Label: "FROM alpine AS release", WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}}},
+						{Label: "COPY --from=build / /", WaitFors: []WaitFor{{ID: "build", Type: WaitForCopy}}},
+					}},
+				},
+			},
+		},
+		{
+			name:     "unknown target",
+			filename: "project/docker-bake.hcl",
+			opts:     ParseOptions{Targets: []string{"missing"}},
+			wantErr:  `target "missing" not found in project/docker-bake.hcl`,
+		},
+		{
+			name:     "inheritance cycle",
+			filename: "project/cycle.hcl",
+			wantErr:  `bake target "a" inherits from itself: a -> b -> a`,
+		},
+		{
+			name:     "missing bake file",
+			filename: "project/missing.hcl",
+			wantErr:  "open project/missing.hcl: file does not exist",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.MaxLabelLength = 40
+			got, err := LoadBakeFile(context.Background(), inputFS, tt.filename, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("LoadBakeFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadBakeFile() error = %v", err)
+			}
+			if diff := cmp.Diff(
+				tt.want, got,
+				cmpopts.IgnoreFields(Stage{}, "Source", "Path"), cmpopts.IgnoreFields(Layer{}, "Source"),
+				cmpopts.IgnoreFields(WaitFor{}, "Copy"),
+				cmpopts.IgnoreFields(ExternalImage{}, "Registry", "Repository", "Tag", "Digest"),
+			); diff != "" {
+				t.Errorf("LoadBakeFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadBakeFileDockerignore(t *testing.T) {
+	inputFS := afero.NewMemMapFs()
+	for path, content := range map[string]string{
+		"project/.dockerignore":     "secret\n",
+		"project/secret":            "password",
+		"project/src/main.go":       "package main",
+		"project/docker/Dockerfile": "FROM scratch\nCOPY secret /x\nCOPY src/ /src/\n",
+		"project/docker-bake.hcl": `
+target "default" {
+  context    = "."
+  dockerfile = "docker/Dockerfile"
+}
+`,
+	} {
+		_ = afero.WriteFile(inputFS, path, []byte(content), 0o644)
+	}
+
+	got, err := LoadBakeFile(
+		context.Background(), inputFS, "project/docker-bake.hcl", ParseOptions{MaxLabelLength: 20, ShowContext: true},
+	)
+	if err != nil {
+		t.Fatalf("LoadBakeFile() error = %v", err)
+	}
+	want := []Layer{
+		{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}}},
+		{Label: "COPY secret /x", Warnings: []string{`"secret" is excluded by .dockerignore, so nothing is copied`}},
+		{
+			Label:    "COPY src/ /src/",
+			WaitFors: []WaitFor{{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"src/"}}},
+		},
+	}
+	if diff := cmp.Diff(
+		want, got.Stages[0].Layers,
+		cmpopts.IgnoreFields(Layer{}, "Source"), cmpopts.IgnoreFields(WaitFor{}, "Copy"), cmpopts.EquateEmpty(),
+	); diff != "" {
+		t.Errorf("LoadBakeFile() layers mismatch (-want +got):\n%s", diff)
+	}
+	if got.Stages[0].Path != "docker/Dockerfile" {
+		t.Errorf("LoadBakeFile() stage path = %q, want %q", got.Stages[0].Path, "docker/Dockerfile")
+	}
+}
+
+func Test_readBakeFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantTags []string
+		wantErr  string
+	}{
+		{
+			name: "variables in dependency order",
+			content: `
+variable "TAG" {
+  default = "${REGISTRY}/app:${VERSION}"
+}
+
+variable "REGISTRY" {
+  default = "registry.example.com"
+}
+
+variable "VERSION" {
+  default = "1.0"
+}
+
+target "default" {
+  tags = [TAG]
+}
+`,
+			wantTags: []string{"registry.example.com/app:1.0"},
+		},
+		{
+			name: "standard and user-defined functions",
+			content: `
+variable "NAME" {
+  default = upper("app")
+}
+
+function "tag" {
+  params = [version]
+  result = "${lower(NAME)}:${version}"
+}
+
+target "default" {
+  tags = [tag("1.0"), join("-", [NAME, "dev"]), try(undefined_variable, "fallback")]
+}
+`,
+			wantTags: []string{"app:1.0", "APP-dev", "fallback"},
+		},
+		{
+			name: "variable cycle",
+			content: `
+variable "A" {
+  default = B
+}
+
+variable "B" {
+  default = "${A}-b"
+}
+`,
+			wantErr: `bake variable "A" refers to itself: A -> B -> A`,
+		},
+		{
+			name: "unsupported function",
+			content: `
+target "default" {
+  tags = [sha256("app")]
+}
+`,
+			wantErr: "the bake function sha256 is not supported by dockerfilegraph",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputFS := afero.NewMemMapFs()
+			_ = afero.WriteFile(inputFS, "docker-bake.hcl", []byte(tt.content), 0o644)
+
+			got, err := readBakeFile(inputFS, "docker-bake.hcl")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readBakeFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readBakeFile() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.wantTags, got.targets["default"].Tags); diff != "" {
+				t.Errorf("readBakeFile() tags mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
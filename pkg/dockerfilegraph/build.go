@@ -0,0 +1,784 @@
+package dockerfilegraph
+
+import (
+	"fmt"
+	"html"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/aquilax/truncate"
+	"github.com/awalterschulze/gographviz"
+)
+
+// The hex equivalents of the Graphviz colors grey20, grey60 and grey90, for
+// output formats that don't know the Graphviz color names.
+const (
+	hexGrey20 = "#333333"
+	hexGrey60 = "#999999"
+	hexGrey90 = "#e5e5e5"
+)
+
+// badgeFontSize is the font size of the badges of stages and images.
+const badgeFontSize = 10
+
+// BuildDotFile builds a GraphViz .dot file from a simplified Dockerfile
+func BuildDotFile(
+	simplifiedDockerfile SimplifiedDockerfile,
+	opts BuildOptions,
+) (string, error) {
+	// Create a new graph
+	graph := gographviz.NewEscape()
+
+	var graphErr error
+	set := func(err error) {
+		if graphErr == nil {
+			graphErr = err
+		}
+	}
+
+	set(graph.SetName("G"))
+	set(graph.SetDir(true))
+	set(graph.AddAttr("G", "compound", "true")) // allow edges between clusters
+	set(graph.AddAttr("G", "nodesep", fmt.Sprintf("%.2f", opts.NodeSep)))
+	set(graph.AddAttr("G", "rankdir", "LR"))
+	set(graph.AddAttr("G", "ranksep", fmt.Sprintf("%.2f", opts.RankSep)))
+	if opts.Concentrate {
+		set(graph.AddAttr("G", "concentrate", "true"))
+	}
+
+	if graphErr != nil {
+		return "", graphErr
+	}
+
+	// Add the legend if requested
+	if opts.Legend {
+		if err := addLegend(graph, opts.EdgeStyle, hasWaitForType(simplifiedDockerfile, WaitForAdd)); err != nil {
+			return "", err
+		}
+	}
+
+	if err := addExternalImagesToGraph(graph, simplifiedDockerfile, opts); err != nil {
+		return "", err
+	}
+
+	if err := addStages(
+		graph, simplifiedDockerfile, opts.MaxLabelLength, opts.Layers, opts.EdgeStyle, opts.LinkPrefix, opts.CopyDetails,
+	); err != nil {
+		return "", err
+	}
+
+	// Add the ARGS that appear before the first stage, if layers are requested
+	if opts.Layers {
+		if err := addBeforeFirstStage(graph, simplifiedDockerfile, opts.LinkPrefix); err != nil {
+			return "", err
+		}
+	}
+
+	if err := addServices(graph, simplifiedDockerfile, opts.Layers); err != nil {
+		return "", err
+	}
+
+	return graph.String(), nil
+}
+
+func addExternalImagesToGraph(
+	graph *gographviz.Escape,
+	simplifiedDockerfile SimplifiedDockerfile,
+	opts BuildOptions,
+) error {
+	var graphErr error
+	set := func(err error) {
+		if graphErr == nil {
+			graphErr = err
+		}
+	}
+
+	for externalImageIndex, externalImage := range simplifiedDockerfile.ExternalImages {
+		attrs := map[string]string{
+			"label": getDotBadgeLabel(
+				getExternalImageLabel(externalImage, opts), getDigestFingerprint(externalImage, opts.ImageDigest),
+			),
+			"shape":     "box",
+			"width":     "2",
+			"style":     "\"dashed,rounded\"",
+			"color":     "grey20",
+			"fontcolor": "grey20",
+		}
+		// Local directories look like folders, remote files like notes, Git
+		// repositories like components, caches like cylinders, secrets like
+		// hexagons and SSH agents like trapeziums.
+		switch externalImage.Type {
+		case ExternalImageDirectory:
+			attrs["shape"] = "folder"
+			attrs["style"] = "dashed"
+		case ExternalImageURL:
+			attrs["shape"] = "note"
+			attrs["style"] = "dashed"
+		case ExternalImageGit:
+			attrs["shape"] = "component"
+			attrs["style"] = "dashed"
+		case ExternalImageCache:
+			attrs["shape"] = "cylinder"
+			attrs["style"] = "dashed"
+		case ExternalImageSecret:
+			attrs["shape"] = "hexagon"
+			attrs["style"] = "dashed"
+		case ExternalImageSSH:
+			attrs["shape"] = "trapezium"
+			attrs["style"] = "dashed"
+		}
+		set(graph.AddNode("G", fmt.Sprintf("external_image_%d", externalImageIndex), attrs))
+	}
+
+	return graphErr
+}
+
+func addStages(
+	graph *gographviz.Escape,
+	simplifiedDockerfile SimplifiedDockerfile,
+	maxLabelLength int,
+	layers bool,
+	edgestyle string,
+	linkPrefix string,
+	copyDetails bool,
+) error {
+	var graphErr error
+	set := func(err error) {
+		if graphErr == nil {
+			graphErr = err
+		}
+	}
+
+	// Draw each Dockerfile of a combined graph as its own cluster
+	files, fileClusterIDs := fileClusters(simplifiedDockerfile.Stages)
+	for _, file := range files {
+		set(graph.AddSubGraph("G", fileClusterIDs[file], map[string]string{
+			"label":  "\"" + file + "\"",
+			"margin": "16",
+			"style":  "dashed",
+		}))
+	}
+
+	for stageIndex, stage := range simplifiedDockerfile.Stages {
+		parent := "G"
+		if stage.File != "" {
+			parent = fileClusterIDs[stage.File]
+		}
+
+		attrs := map[string]string{
+			"label": getStageDotLabel(simplifiedDockerfile.Stages, stageIndex, maxLabelLength),
+			"shape": "box",
+			"style": "rounded",
+			"width": "2",
+		}
+		stageLinkPrefix := getStageLinkPrefix(linkPrefix, stage)
+		addSourceLink(attrs, stageLinkPrefix, stage.Source)
+
+		// Grey out the stages that none of the targets needs.
+		if stage.Unused {
+			attrs["color"] = "grey60"
+			attrs["fontcolor"] = "grey60"
+		}
+
+		// Add layers if requested
+		if layers {
+			if err := addStageWithLayers(
+				graph, parent, simplifiedDockerfile, stageIndex, stage, attrs, stageLinkPrefix,
+			); err != nil {
+				return err
+			}
+		} else {
+			// Add the build stages.
+			// Color the last one, because it is the default build target.
+			if isDefaultTarget(simplifiedDockerfile.Stages, stageIndex) {
+				attrs["style"] = "\"filled,rounded\""
+				attrs["fillcolor"] = "grey90"
+			}
+
+			set(graph.AddNode(parent, fmt.Sprintf("stage_%d", stageIndex), attrs))
+		}
+
+		if graphErr != nil {
+			return graphErr
+		}
+
+		// Add the edges for this build stage
+		if err := addEdgesForStage(
+			stageIndex, stage, graph, simplifiedDockerfile, maxLabelLength, layers, edgestyle, copyDetails,
+		); err != nil {
+			return err
+		}
+	}
+
+	return graphErr
+}
+
+func addStageWithLayers(
+	graph *gographviz.Escape,
+	parent string,
+	simplifiedDockerfile SimplifiedDockerfile,
+	stageIndex int,
+	stage Stage,
+	attrs map[string]string,
+	linkPrefix string,
+) error {
+	var graphErr error
+	set := func(err error) {
+		if graphErr == nil {
+			graphErr = err
+		}
+	}
+
+	cluster := fmt.Sprintf("cluster_stage_%d", stageIndex)
+
+	clusterAttrs := map[string]string{
+		"label":  "\"" + getStageClusterLabel(simplifiedDockerfile.Stages, stageIndex) + "\"",
+		"margin": "16",
+	}
+
+	if isDefaultTarget(simplifiedDockerfile.Stages, stageIndex) {
+		clusterAttrs["style"] = "filled"
+		clusterAttrs["fillcolor"] = "grey90"
+	}
+	if stage.Unused {
+		clusterAttrs["color"] = "grey60"
+		clusterAttrs["fontcolor"] = "grey60"
+	}
+	addSourceLink(clusterAttrs, linkPrefix, stage.Source)
+
+	set(graph.AddSubGraph(parent, cluster, clusterAttrs))
+
+	for layerIndex, layer := range stage.Layers {
+		attrs["label"] = "\"" + layer.Label + "\""
+		attrs["penwidth"] = "0.5"
+		attrs["style"] = "\"filled,rounded\""
+		attrs["fillcolor"] = "white"
+		addSourceLink(attrs, linkPrefix, layer.Source)
+		set(graph.AddNode(
+			cluster,
+			fmt.Sprintf("stage_%d_layer_%d", stageIndex, layerIndex),
+			attrs,
+		))
+
+		// Add edges between layers to guarantee the correct order
+		if layerIndex > 0 {
+			set(graph.AddEdge(
+				fmt.Sprintf("stage_%d_layer_%d", stageIndex, layerIndex-1),
+				fmt.Sprintf("stage_%d_layer_%d", stageIndex, layerIndex),
+				true,
+				nil,
+			))
+		}
+	}
+
+	return graphErr
+}
+
+func addBeforeFirstStage(
+	graph *gographviz.Escape,
+	simplifiedDockerfile SimplifiedDockerfile,
+	linkPrefix string,
+) error {
+	if len(simplifiedDockerfile.BeforeFirstStage) == 0 {
+		return nil
+	}
+
+	var graphErr error
+	set := func(err error) {
+		if graphErr == nil {
+			graphErr = err
+		}
+	}
+
+	set(graph.AddSubGraph(
+		"G",
+		"cluster_before_first_stage",
+		map[string]string{"label": "\"Before First Stage\""},
+	))
+	for argIndex, arg := range simplifiedDockerfile.BeforeFirstStage {
+		attrs := map[string]string{
+			"label": "\"" + arg.Label + "\"",
+			"shape": "box",
+			"style": "rounded",
+			"width": "2",
+		}
+		addSourceLink(attrs, linkPrefix, arg.Source)
+		set(graph.AddNode(
+			"cluster_before_first_stage",
+			fmt.Sprintf("before_first_stage_%d", argIndex),
+			attrs,
+		))
+	}
+
+	return graphErr
+}
+
+// addServices adds the Docker Compose services, with an edge to the stage
+// that each of them builds.
+func addServices(
+	graph *gographviz.Escape,
+	simplifiedDockerfile SimplifiedDockerfile,
+	layers bool,
+) error {
+	var graphErr error
+	set := func(err error) {
+		if graphErr == nil {
+			graphErr = err
+		}
+	}
+
+	for serviceIndex, service := range simplifiedDockerfile.Services {
+		nodeID := fmt.Sprintf("service_%d", serviceIndex)
+		set(graph.AddNode("G", nodeID, map[string]string{
+			"label": "\"" + service.Name + "\"",
+			"shape": "box",
+			"style": "\"bold,rounded\"",
+			"width": "2",
+		}))
+
+		targetNodeID, edgeAttrs, err := getServiceTargetNodeID(simplifiedDockerfile, service, layers)
+		if err != nil {
+			return err
+		}
+		set(graph.AddEdge(nodeID, targetNodeID, true, edgeAttrs))
+	}
+
+	return graphErr
+}
+
+func addEdgesForStage(
+	stageIndex int, stage Stage, graph *gographviz.Escape,
+	simplifiedDockerfile SimplifiedDockerfile, maxLabelLength int, layers bool, edgestyle string, copyDetails bool,
+) error {
+	for layerIndex, layer := range stage.Layers {
+		for _, waitFor := range layer.WaitFors {
+			edgeAttrs := map[string]string{}
+			if waitFor.Type == WaitForCopy {
+				edgeAttrs["arrowhead"] = "empty"
+				if edgestyle == "default" {
+					edgeAttrs["style"] = "dashed"
+				}
+			} else if waitFor.Type == WaitForMount {
+				edgeAttrs["arrowhead"] = "ediamond"
+				if edgestyle == "default" {
+					edgeAttrs["style"] = "dotted"
+				}
+			} else if waitFor.Type == WaitForAdd {
+				edgeAttrs["arrowhead"] = "odot"
+				if edgestyle == "default" {
+					edgeAttrs["style"] = "dashed"
+				}
+			}
+			// COPY --link and ADD --link don't depend on the layers below,
+			// so they are drawn in bold.
+			if waitFor.Copy != nil && waitFor.Copy.Link {
+				if style, ok := edgeAttrs["style"]; ok {
+					edgeAttrs["style"] = "\"" + style + ",bold\""
+				} else {
+					edgeAttrs["style"] = "bold"
+				}
+			}
+
+			sourceNodeID, additionalEdgeAttrs, err := getWaitForNodeID(
+				simplifiedDockerfile, waitFor.ID, layers,
+			)
+			if err != nil {
+				return err
+			}
+			maps.Copy(edgeAttrs, additionalEdgeAttrs)
+			if label := getWaitForLabel(waitFor, maxLabelLength, copyDetails); label != "" {
+				edgeAttrs["label"] = "\"" + label + "\""
+			}
+			if copyDetails && waitFor.Copy != nil {
+				edgeAttrs["tooltip"] = "\"" + getWaitForDetails(waitFor, copyDetails) + "\""
+			}
+
+			targetNodeID := fmt.Sprintf("stage_%d", stageIndex)
+			if layers {
+				targetNodeID = targetNodeID + fmt.Sprintf("_layer_%d", layerIndex)
+			}
+
+			if err := graph.AddEdge(sourceNodeID, targetNodeID, true, edgeAttrs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func addLegend(graph *gographviz.Escape, edgestyle string, withAdd bool) error {
+	var graphErr error
+	set := func(err error) {
+		if graphErr == nil {
+			graphErr = err
+		}
+	}
+
+	// The ADD row is only shown if the Dockerfile has remote ADD sources.
+	keys := []string{"FROM&nbsp;...&nbsp;", "COPY --from=...&nbsp;", "RUN --mount=...&nbsp;"}
+	if withAdd {
+		keys = append(keys, "ADD https://...&nbsp;")
+	}
+
+	set(graph.AddSubGraph("G", "cluster_legend", nil))
+
+	set(graph.AddNode("cluster_legend", "key",
+		map[string]string{
+			"shape":    "plaintext",
+			"fontname": "monospace",
+			"fontsize": "10",
+			"label":    getLegendLabel(keys, true),
+		},
+	))
+	set(graph.AddNode("cluster_legend", "key2",
+		map[string]string{
+			"shape":    "plaintext",
+			"fontname": "monospace",
+			"fontsize": "10",
+			"label":    getLegendLabel(keys, false),
+		},
+	))
+
+	set(graph.AddPortEdge("key", "i0:e", "key2", "i0:w", true, nil))
+
+	copyEdgeAttrs := map[string]string{"arrowhead": "empty"}
+	if edgestyle == "default" {
+		copyEdgeAttrs["style"] = "dashed"
+	}
+	set(graph.AddPortEdge(
+		"key", "i1:e", "key2", "i1:w", true,
+		copyEdgeAttrs,
+	))
+
+	mountEdgeAttrs := map[string]string{"arrowhead": "ediamond"}
+	if edgestyle == "default" {
+		mountEdgeAttrs["style"] = "dotted"
+	}
+	set(graph.AddPortEdge(
+		"key", "i2:e", "key2", "i2:w", true,
+		mountEdgeAttrs,
+	))
+
+	if withAdd {
+		addEdgeAttrs := map[string]string{"arrowhead": "odot"}
+		if edgestyle == "default" {
+			addEdgeAttrs["style"] = "dashed"
+		}
+		set(graph.AddPortEdge(
+			"key", "i3:e", "key2", "i3:w", true,
+			addEdgeAttrs,
+		))
+	}
+
+	return graphErr
+}
+
+// getLegendLabel returns the HTML table of the legend with one row per key,
+// either with the keys aligned to the right, or with empty rows for the
+// other end of the edges.
+func getLegendLabel(keys []string, withKeys bool) string {
+	var b strings.Builder
+	b.WriteString(`<<table border="0" cellpadding="2" cellspacing="0" cellborder="0">` + "\n")
+	for i, key := range keys {
+		if withKeys {
+			fmt.Fprintf(&b, "\t<tr><td align=\"right\" port=\"i%d\">%s</td></tr>\n", i, key)
+		} else {
+			fmt.Fprintf(&b, "\t<tr><td port=\"i%d\">&nbsp;</td></tr>\n", i)
+		}
+	}
+	b.WriteString("</table>>")
+	return b.String()
+}
+
+// hasWaitForType returns true if a layer of the Dockerfile depends on
+// something with the given type of dependency.
+func hasWaitForType(simplifiedDockerfile SimplifiedDockerfile, waitForType WaitForType) bool {
+	for _, stage := range simplifiedDockerfile.Stages {
+		for _, layer := range stage.Layers {
+			for _, waitFor := range layer.WaitFors {
+				if waitFor.Type == waitForType {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// getExternalImageLabel returns the name of the external image as requested
+// by the build options, truncated in the middle so that both the registry and
+// the tag remain visible.
+func getExternalImageLabel(externalImage ExternalImage, opts BuildOptions) string {
+	label := getImageName(externalImage, opts.ImageName, opts.ImageDigest)
+	maxLabelLength := opts.MaxLabelLength
+	if len(label) > maxLabelLength {
+		truncatePosition := truncate.PositionMiddle
+		if maxLabelLength < 5 {
+			truncatePosition = truncate.PositionEnd
+		}
+		label = truncate.Truncate(label, maxLabelLength, "...", truncatePosition)
+	}
+	return label
+}
+
+// addSourceLink makes the node or cluster link to its lines in the
+// Dockerfile, if a link prefix is set.
+func addSourceLink(attrs map[string]string, linkPrefix string, source SourceRange) {
+	link := getSourceLink(linkPrefix, source)
+	if link == "" {
+		return
+	}
+	attrs["URL"] = "\"" + link + "\""
+	attrs["tooltip"] = "\"" + link + "\""
+}
+
+// getStageLinkPrefix returns the link prefix of the Dockerfile of a stage. If
+// the stage has a Path, the link prefix is the URL of the directory that the
+// Path is relative to, e.g. the root of --recursive --combine.
+func getStageLinkPrefix(linkPrefix string, stage Stage) string {
+	if linkPrefix == "" || stage.Path == "" {
+		return linkPrefix
+	}
+	return strings.TrimSuffix(linkPrefix, "/") + "/" + stage.Path
+}
+
+// getSourceLink returns a link to the lines of the Dockerfile, using the
+// GitHub style #L12-L18 fragment, or an empty string if there is no link
+// prefix or no known location.
+func getSourceLink(linkPrefix string, source SourceRange) string {
+	if linkPrefix == "" || source.StartLine == 0 {
+		return ""
+	}
+	if source.EndLine <= source.StartLine {
+		return fmt.Sprintf("%s#L%d", linkPrefix, source.StartLine)
+	}
+	return fmt.Sprintf("%s#L%d-L%d", linkPrefix, source.StartLine, source.EndLine)
+}
+
+// getWaitForLabel returns the label of an edge, see getWaitForDetails,
+// truncated at the end.
+func getWaitForLabel(waitFor WaitFor, maxLabelLength int, copyDetails bool) string {
+	label := getWaitForDetails(waitFor, copyDetails)
+	if maxLabelLength > 0 && len(label) > maxLabelLength {
+		return truncate.Truncate(label, maxLabelLength, "...", truncate.PositionEnd)
+	}
+	return label
+}
+
+// getWaitForDetails returns the paths that are copied from the build context
+// and the .dockerignore patterns that exclude some of their files, the
+// sharing mode of a cache mount, or the options of an ADD from a remote
+// source. With copyDetails, COPY and ADD edges also show their flags and
+// paths. In multi-platform graphs, dependencies that only exist for some
+// platforms list them. It is empty for other dependencies.
+func getWaitForDetails(waitFor WaitFor, copyDetails bool) string {
+	var parts []string
+	if copyDetails && waitFor.Copy != nil {
+		parts = append(parts, getCopyDetails(waitFor))
+	} else if len(waitFor.Paths) > 0 {
+		parts = append(parts, strings.Join(waitFor.Paths, " "))
+	}
+	if len(waitFor.Ignored) > 0 {
+		parts = append(parts, "excluding "+strings.Join(waitFor.Ignored, " "))
+	}
+	if waitFor.Mount != nil && waitFor.Mount.Sharing != "" {
+		parts = append(parts, "sharing="+waitFor.Mount.Sharing)
+	}
+	if waitFor.Type == WaitForAdd {
+		if waitFor.KeepGitDir {
+			parts = append(parts, "keep-git-dir")
+		}
+		if waitFor.Checksum != "" {
+			parts = append(parts, waitFor.Checksum)
+		}
+	}
+	if len(waitFor.Platforms) > 0 {
+		parts = append(parts, "only for "+strings.Join(waitFor.Platforms, ", "))
+	}
+	return strings.Join(parts, " ")
+}
+
+// getCopyDetails returns the flags of a COPY or ADD, followed by the sources
+// and the destination, e.g. "--link --chmod=755 app -> /usr/bin/". The
+// source of an ADD from a remote source is the node the edge starts at, so
+// it is left out.
+func getCopyDetails(waitFor WaitFor) string {
+	copyOpts := waitFor.Copy
+	var parts []string
+	if copyOpts.Link {
+		parts = append(parts, "--link")
+	}
+	if copyOpts.Parents {
+		parts = append(parts, "--parents")
+	}
+	if copyOpts.Chown != "" {
+		parts = append(parts, "--chown="+copyOpts.Chown)
+	}
+	if copyOpts.Chmod != "" {
+		parts = append(parts, "--chmod="+copyOpts.Chmod)
+	}
+	for _, exclude := range copyOpts.Exclude {
+		parts = append(parts, "--exclude="+exclude)
+	}
+
+	sources := copyOpts.Sources
+	if len(waitFor.Paths) > 0 {
+		sources = waitFor.Paths
+	}
+	if waitFor.Type != WaitForAdd {
+		parts = append(parts, sources...)
+	}
+	if copyOpts.Destination != "" {
+		parts = append(parts, "->", copyOpts.Destination)
+	}
+	return strings.Join(parts, " ")
+}
+
+// getStageLabel returns the name of a stage, or its index within its
+// Dockerfile if it has no name.
+func getStageLabel(stages []Stage, stageIndex int, maxLabelLength int) string {
+	stage := stages[stageIndex]
+	if maxLabelLength > 0 && len(stage.Name) > maxLabelLength {
+		return truncate.Truncate(
+			stage.Name, maxLabelLength, "...", truncate.PositionEnd,
+		)
+	}
+
+	if stage.Name == "" {
+		firstStageIndex := stageIndex
+		for firstStageIndex > 0 && stages[firstStageIndex-1].File == stage.File {
+			firstStageIndex--
+		}
+		return fmt.Sprintf("%d", stageIndex-firstStageIndex)
+	}
+
+	return stage.Name
+}
+
+// getStageDotLabel returns the DOT label of a stage node, with the badge of
+// the stage in a smaller font below the name, see getStageBadge.
+func getStageDotLabel(stages []Stage, stageIndex int, maxLabelLength int) string {
+	return getDotBadgeLabel(getStageLabel(stages, stageIndex, maxLabelLength), getStageBadge(stages[stageIndex]))
+}
+
+// getDotBadgeLabel returns a DOT label with the badge in a smaller font below
+// the label, or the quoted label if there is no badge.
+func getDotBadgeLabel(label, badge string) string {
+	if badge == "" {
+		return "\"" + label + "\""
+	}
+	return fmt.Sprintf(
+		`<%s<br/><font point-size="%d">%s</font>>`,
+		html.EscapeString(label), badgeFontSize, html.EscapeString(badge),
+	)
+}
+
+// getStageClusterLabel returns the label of the cluster of a stage with
+// layers, followed by the badge of the stage.
+func getStageClusterLabel(stages []Stage, stageIndex int) string {
+	label := getStageLabel(stages, stageIndex, 0)
+	if badge := getStageBadge(stages[stageIndex]); badge != "" {
+		label += " (" + badge + ")"
+	}
+	return label
+}
+
+// getStageBadge returns the platform of a stage, marked as emulated if it
+// differs from the build platform, or the platforms that are emulated if it
+// runs natively on the others, the target platforms it is only built for
+// in multi-platform graphs, and whether none of the targets needs it. It is
+// empty if there is nothing to show.
+func getStageBadge(stage Stage) string {
+	var parts []string
+	if stage.Platform != "" {
+		parts = append(parts, stage.Platform)
+	}
+	if stage.Emulated {
+		parts = append(parts, "emulated")
+	} else if len(stage.EmulatedPlatforms) > 0 {
+		parts = append(parts, "emulated on "+strings.Join(stage.EmulatedPlatforms, ", "))
+	}
+	if len(stage.Platforms) > 0 {
+		parts = append(parts, "only for "+strings.Join(stage.Platforms, ", "))
+	}
+	if stage.Unused {
+		parts = append(parts, "unused")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// getWaitForNodeID returns the ID of the node identified by the stage ID or
+// name or the external image name.
+func getWaitForNodeID(
+	simplifiedDockerfile SimplifiedDockerfile, nameOrID string, layers bool,
+) (string, map[string]string, error) {
+	attrs := map[string]string{}
+
+	// If it can be converted to an integer, it's a numeric stage reference
+	if stageIndex, convertErr := strconv.Atoi(nameOrID); convertErr == nil {
+		if stageIndex < 0 || stageIndex >= len(simplifiedDockerfile.Stages) {
+			return "", nil, fmt.Errorf(
+				"stage index %d out of range (have %d stages)",
+				stageIndex, len(simplifiedDockerfile.Stages),
+			)
+		}
+		return stageNodeID(simplifiedDockerfile, stageIndex, nameOrID, layers)
+	}
+
+	// Check if it's a stage name
+	if stageIndex, found := findWaitForStage(simplifiedDockerfile.Stages, nameOrID); found {
+		return stageNodeID(simplifiedDockerfile, stageIndex, nameOrID, layers)
+	}
+
+	// Check if it's an external image ID
+	for externalImageIndex, externalImage := range simplifiedDockerfile.ExternalImages {
+		if nameOrID == externalImage.ID {
+			return fmt.Sprintf("external_image_%d", externalImageIndex), attrs, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf(
+		"could not resolve node ID for %q (expected stage index, stage name, or external image ID)",
+		nameOrID,
+	)
+}
+
+// getServiceTargetNodeID returns the ID of the node that a service points
+// to. With layers, this is the first layer of the stage, and the edge ends at
+// the border of the stage cluster.
+func getServiceTargetNodeID(
+	sdf SimplifiedDockerfile, service Service, layers bool,
+) (string, map[string]string, error) {
+	if service.Stage < 0 || service.Stage >= len(sdf.Stages) {
+		return "", nil, fmt.Errorf(
+			"stage index %d of service %q out of range (have %d stages)",
+			service.Stage, service.Name, len(sdf.Stages),
+		)
+	}
+	if layers {
+		if len(sdf.Stages[service.Stage].Layers) == 0 {
+			return "", nil, fmt.Errorf("stage %d of service %q has no layers", service.Stage, service.Name)
+		}
+		return fmt.Sprintf("stage_%d_layer_0", service.Stage),
+			map[string]string{"lhead": fmt.Sprintf("cluster_stage_%d", service.Stage)},
+			nil
+	}
+	return fmt.Sprintf("stage_%d", service.Stage), map[string]string{}, nil
+}
+
+// stageNodeID returns the graph node ID for a stage, handling the layers case.
+func stageNodeID(
+	sdf SimplifiedDockerfile, stageIndex int, nameOrID string, layers bool,
+) (string, map[string]string, error) {
+	if layers {
+		if len(sdf.Stages[stageIndex].Layers) == 0 {
+			return "", nil, fmt.Errorf("stage %q has no layers", nameOrID)
+		}
+		lastLayer := len(sdf.Stages[stageIndex].Layers) - 1
+		return fmt.Sprintf("stage_%d_layer_%d", stageIndex, lastLayer),
+			map[string]string{"ltail": fmt.Sprintf("cluster_stage_%d", stageIndex)},
+			nil
+	}
+	return fmt.Sprintf("stage_%d", stageIndex), map[string]string{}, nil
+}
@@ -0,0 +1,515 @@
+package dockerfilegraph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildDotFileErrors(t *testing.T) {
+	tests := []struct {
+		name                 string
+		simplifiedDockerfile SimplifiedDockerfile
+		layers               bool
+	}{
+		{
+			name: "unresolvable WaitFor ID returns error",
+			simplifiedDockerfile: SimplifiedDockerfile{
+				Stages: []Stage{{
+					Layers: []Layer{{
+						Label: "FROM scratch",
+						WaitFors: []WaitFor{{
+							ID:   "nonexistent",
+							Type: WaitForFrom,
+						}},
+					}},
+				}},
+			},
+		},
+		{
+			name: "out-of-range numeric stage reference returns error",
+			simplifiedDockerfile: SimplifiedDockerfile{
+				Stages: []Stage{{
+					Layers: []Layer{{
+						Label: "FROM ...",
+						WaitFors: []WaitFor{{
+							ID:   "99",
+							Type: WaitForFrom,
+						}},
+					}},
+				}},
+			},
+		},
+		{
+			name: "out-of-range numeric stage reference with layers returns error",
+			simplifiedDockerfile: SimplifiedDockerfile{
+				Stages: []Stage{{
+					Layers: []Layer{{
+						Label: "FROM ...",
+						WaitFors: []WaitFor{{
+							ID:   "99",
+							Type: WaitForFrom,
+						}},
+					}},
+				}},
+			},
+			layers: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := BuildDotFile(
+				tt.simplifiedDockerfile,
+				BuildOptions{EdgeStyle: "default", MaxLabelLength: 20, NodeSep: 0.5, RankSep: 0.5, Layers: tt.layers},
+			)
+			if err == nil {
+				t.Error("BuildDotFile() expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestBuildDotFile(t *testing.T) {
+	type args struct {
+		simplifiedDockerfile SimplifiedDockerfile
+		concentrate          bool
+		copyDetails          bool
+		edgestyle            string
+		layers               bool
+		legend               bool
+		linkPrefix           string
+		maxLabelLength       int
+		nodesep              float64
+		ranksep              float64
+	}
+	tests := []struct {
+		name         string
+		args         args
+		wantContains string
+	}{
+		{
+			name: "legend",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					BeforeFirstStage: []Layer{
+						{
+							Label: "ARG...",
+						},
+					},
+					ExternalImages: []ExternalImage{
+						{ID: "build", Name: "build"},
+						{ID: "release", Name: "release"},
+					},
+					Stages: []Stage{
+						{
+							Layers: []Layer{
+								{
+									Label: "FROM...",
+									WaitFors: []WaitFor{{
+										ID:   "build",
+										Type: WaitForFrom,
+									}},
+								},
+							},
+						},
+					},
+				},
+				edgestyle:      "default",
+				legend:         true,
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: "release",
+		},
+		{
+			name: "legend with ADD",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					ExternalImages: []ExternalImage{
+						{ID: "https://example.com/app.tar.gz", Name: "https://example.com/app.tar.gz"},
+					},
+					Stages: []Stage{{
+						Layers: []Layer{{
+							Label: "ADD https://example.com/app.tar.gz /",
+							WaitFors: []WaitFor{{
+								ID:   "https://example.com/app.tar.gz",
+								Type: WaitForAdd,
+							}},
+						}},
+					}},
+				},
+				edgestyle:      "default",
+				legend:         true,
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: "key:i3:e->key2:i3:w",
+		},
+		{
+			name: "layers",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					BeforeFirstStage: []Layer{
+						{
+							Label: "ARG...",
+						},
+					},
+					ExternalImages: []ExternalImage{
+						{ID: "build", Name: "build"},
+						{ID: "release", Name: "release"},
+					},
+					Stages: []Stage{
+						{
+							Layers: []Layer{
+								{
+									Label: "FROM...",
+									WaitFors: []WaitFor{{
+										ID:   "build",
+										Type: WaitForFrom,
+									}},
+								},
+							},
+						},
+					},
+				},
+				edgestyle:      "default",
+				layers:         true,
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: "release",
+		},
+		{
+			name: "link prefix",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					ExternalImages: []ExternalImage{{ID: "build", Name: "build"}},
+					Stages: []Stage{{
+						Source: SourceRange{StartLine: 12, EndLine: 18},
+						Layers: []Layer{{
+							Label:    "FROM...",
+							WaitFors: []WaitFor{{ID: "build", Type: WaitForFrom}},
+							Source:   SourceRange{StartLine: 12, EndLine: 12},
+						}},
+					}},
+				},
+				edgestyle:      "default",
+				linkPrefix:     "https://example.com/Dockerfile",
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: `URL="https://example.com/Dockerfile#L12-L18", fillcolor=grey90, label="0", shape=box, ` +
+				`style="filled,rounded", tooltip="https://example.com/Dockerfile#L12-L18", width=2`,
+		},
+		{
+			name: "link prefix of combined Dockerfiles",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					Stages: []Stage{
+						{
+							File: "api/Dockerfile", Path: "api/Dockerfile", Source: SourceRange{StartLine: 1, EndLine: 1},
+							Layers: []Layer{{Label: "FROM scratch"}},
+						},
+						{
+							File: "web/Dockerfile", Path: "web/Dockerfile", Source: SourceRange{StartLine: 3, EndLine: 4},
+							Layers: []Layer{{Label: "FROM scratch"}},
+						},
+					},
+				},
+				edgestyle:      "default",
+				linkPrefix:     "https://example.com/blob/main/",
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: `stage_1 [ URL="https://example.com/blob/main/web/Dockerfile#L3-L4"`,
+		},
+		{
+			name: "labels of unnamed stages of combined Dockerfiles",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					Stages: []Stage{
+						{File: "api/Dockerfile", Layers: []Layer{{Label: "FROM scratch"}}},
+						{File: "web/Dockerfile", Layers: []Layer{{Label: "FROM scratch"}}},
+					},
+				},
+				edgestyle:      "default",
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: `stage_1 [ fillcolor=grey90, label="0", shape=box, style="filled,rounded", width=2 ];`,
+		},
+		{
+			name: "build context directory",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					ExternalImages: []ExternalImage{{ID: "src", Name: "./src", Type: ExternalImageDirectory}},
+					Stages: []Stage{{
+						Layers: []Layer{{
+							Label:    "COPY --from=src...",
+							WaitFors: []WaitFor{{ID: "src", Type: WaitForCopy}},
+						}},
+					}},
+				},
+				edgestyle:      "default",
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: `external_image_0 [ color=grey20, fontcolor=grey20, label="./src", shape=folder, style=dashed, width=2 ];`,
+		},
+		{
+			name: "build context with copied paths",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					ExternalImages: []ExternalImage{
+						{ID: BuildContextID, Name: "build context", Type: ExternalImageDirectory},
+					},
+					Stages: []Stage{{
+						Layers: []Layer{{
+							Label: "COPY go.mod go.sum ./",
+							WaitFors: []WaitFor{{
+								ID: BuildContextID, Type: WaitForCopy, Paths: []string{"go.mod", "go.sum", "cmd/server/main.go"},
+							}},
+						}},
+					}},
+				},
+				edgestyle:      "default",
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: `external_image_0->stage_0[ arrowhead=empty, label="go.mod go.sum cmd...", style=dashed ];`,
+		},
+		{
+			name: "ADD from a Git repository",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					ExternalImages: []ExternalImage{
+						{ID: "https://github.com/org/repo.git", Name: "https://github.com/org/repo.git", Type: ExternalImageGit},
+					},
+					Stages: []Stage{{
+						Layers: []Layer{{
+							Label:    "ADD --keep-git-dir...",
+							WaitFors: []WaitFor{{ID: "https://github.com/org/repo.git", Type: WaitForAdd, KeepGitDir: true}},
+						}},
+					}},
+				},
+				edgestyle:      "default",
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: `external_image_0->stage_0[ arrowhead=odot, label="keep-git-dir", style=dashed ];
+	external_image_0 [ color=grey20, fontcolor=grey20, label="https://.../repo.git", shape=component, ` +
+				`style=dashed, width=2 ];`,
+		},
+		{
+			name: "cache mount with sharing mode",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					ExternalImages: []ExternalImage{
+						{ID: "type=cache,id=/root/.cache/go-build", Name: "/root/.cache/go-build", Type: ExternalImageCache},
+					},
+					Stages: []Stage{{
+						Layers: []Layer{{
+							Label: "RUN --mount=type=c...",
+							WaitFors: []WaitFor{{
+								ID:    "type=cache,id=/root/.cache/go-build",
+								Type:  WaitForMount,
+								Mount: &Mount{Type: "cache", ID: "/root/.cache/go-build", Sharing: "locked"},
+							}},
+						}},
+					}},
+				},
+				edgestyle:      "default",
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: `external_image_0->stage_0[ arrowhead=ediamond, label="sharing=locked", style=dotted ];
+	external_image_0 [ color=grey20, fontcolor=grey20, label="/root/.c.../go-build", shape=cylinder, ` +
+				`style=dashed, width=2 ];`,
+		},
+		{
+			name: "COPY --link with copy details",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					Stages: []Stage{
+						{Name: "build", Layers: []Layer{{Label: "FROM scratch AS build"}}},
+						{Layers: []Layer{{
+							Label: "COPY --link --from...",
+							WaitFors: []WaitFor{{
+								ID:   "build",
+								Type: WaitForCopy,
+								Copy: &CopyOptions{
+									Sources: []string{"/app"}, Destination: "/usr/bin/", Link: true, Chmod: "755",
+								},
+							}},
+						}}},
+					},
+				},
+				copyDetails:    true,
+				edgestyle:      "default",
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: `stage_0->stage_1[ arrowhead=empty, label="--link --chmod=75...", style="dashed,bold", ` +
+				`tooltip="--link --chmod=755 /app -> /usr/bin/" ];`,
+		},
+		{
+			name: "COPY --link without copy details",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					Stages: []Stage{
+						{Name: "build", Layers: []Layer{{Label: "FROM scratch AS build"}}},
+						{Layers: []Layer{{
+							Label: "COPY --link --from...",
+							WaitFors: []WaitFor{{
+								ID:   "build",
+								Type: WaitForCopy,
+								Copy: &CopyOptions{Sources: []string{"/app"}, Destination: "/usr/bin/", Link: true},
+							}},
+						}}},
+					},
+				},
+				edgestyle:      "solid",
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: `stage_0->stage_1[ arrowhead=empty, style=bold ];`,
+		},
+		{
+			name: "platform badges",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					Stages: []Stage{
+						{Name: "build", Platform: "linux/amd64", Layers: []Layer{{Label: "FROM scratch AS build"}}},
+						{Platform: "linux/arm64", Emulated: true, Layers: []Layer{{Label: "FROM scratch"}}},
+					},
+				},
+				edgestyle:      "default",
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: `stage_0 [ label=<build<br/><font point-size="10">linux/amd64</font>>, shape=box, ` +
+				`style=rounded, width=2 ];
+	stage_1 [ fillcolor=grey90, label=<1<br/><font point-size="10">linux/arm64, emulated</font>>, ` +
+				`shape=box, style="filled,rounded", width=2 ];`,
+		},
+		{
+			name: "unused stages are greyed out",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					Stages: []Stage{
+						{Name: "test", Unused: true, Layers: []Layer{{Label: "FROM scratch AS test"}}},
+						{Layers: []Layer{{Label: "FROM scratch"}}},
+					},
+				},
+				edgestyle:      "default",
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: `stage_0 [ color=grey60, fontcolor=grey60, ` +
+				`label=<test<br/><font point-size="10">unused</font>>, shape=box, style=rounded, width=2 ];`,
+		},
+		{
+			name: "services with layers",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					Stages: []Stage{{
+						Layers: []Layer{{Label: "FROM scratch"}},
+					}},
+					Services: []Service{{Name: "web", Stage: 0}},
+				},
+				edgestyle:      "default",
+				layers:         true,
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: `service_0->stage_0_layer_0[ lhead=cluster_stage_0 ];`,
+		},
+		{
+			name: "separate scratch images show correct labels",
+			args: args{
+				simplifiedDockerfile: SimplifiedDockerfile{
+					ExternalImages: []ExternalImage{
+						{ID: "scratch-0", Name: "scratch"},
+						{ID: "scratch-1", Name: "scratch"},
+					},
+					Stages: []Stage{
+						{
+							Name: "app1",
+							Layers: []Layer{
+								{
+									Label: "FROM scratch AS app1",
+									WaitFors: []WaitFor{{
+										ID:   "scratch-0",
+										Type: WaitForFrom,
+									}},
+								},
+							},
+						},
+						{
+							Name: "app2",
+							Layers: []Layer{
+								{
+									Label: "FROM scratch AS app2",
+									WaitFors: []WaitFor{{
+										ID:   "scratch-1",
+										Type: WaitForFrom,
+									}},
+								},
+							},
+						},
+					},
+				},
+				concentrate:    false,
+				edgestyle:      "default",
+				layers:         false,
+				legend:         false,
+				maxLabelLength: 20,
+				nodesep:        0.5,
+				ranksep:        0.5,
+			},
+			wantContains: `external_image_0 [ color=grey20, fontcolor=grey20, label="scratch", shape=box, ` +
+				`style="dashed,rounded", width=2 ];
+	external_image_1 [ color=grey20, fontcolor=grey20, label="scratch"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildDotFile(
+				tt.args.simplifiedDockerfile,
+				BuildOptions{
+					Concentrate:    tt.args.concentrate,
+					CopyDetails:    tt.args.copyDetails,
+					EdgeStyle:      tt.args.edgestyle,
+					Layers:         tt.args.layers,
+					Legend:         tt.args.legend,
+					LinkPrefix:     tt.args.linkPrefix,
+					MaxLabelLength: tt.args.maxLabelLength,
+					NodeSep:        tt.args.nodesep,
+					RankSep:        tt.args.ranksep,
+				},
+			)
+			if err != nil {
+				t.Fatalf("BuildDotFile() error = %v", err)
+			}
+			if !strings.Contains(got, tt.wantContains) {
+				t.Errorf(
+					"BuildDotFile() = %v, did not contain %v", got, tt.wantContains,
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package dockerfilegraph
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CombineInput is a parsed Dockerfile that is combined with others by
+// CombineDockerfiles.
+type CombineInput struct {
+	File       string // The path of the Dockerfile, used as the label of its cluster
+	Dockerfile SimplifiedDockerfile
+	Images     []string // The images built from the final stage, e.g. ourorg/base:latest
+	Path       string   // The path of the Dockerfile relative to the URL of BuildOptions.LinkPrefix, if any
+}
+
+// CombineDockerfiles merges several Dockerfiles into a single graph. Every
+// stage keeps its File, so that the renderers can draw each Dockerfile as
+// its own cluster. External images that are built by one of the other
+// Dockerfiles are replaced by an edge from the final stage of that
+// Dockerfile. References to stages are converted to stage indices of the
+// combined graph, because stage names are only unique within a Dockerfile.
+func CombineDockerfiles(inputs []CombineInput) SimplifiedDockerfile {
+	combined := SimplifiedDockerfile{}
+
+	// Find the index of the first stage of each Dockerfile in the combined
+	// graph, and the final stages that build the images.
+	offsets := make([]int, len(inputs))
+	producers := make(map[string]int)
+	offset := 0
+	for inputIndex, input := range inputs {
+		offsets[inputIndex] = offset
+		offset += len(input.Dockerfile.Stages)
+		if len(input.Dockerfile.Stages) > 0 {
+			for _, image := range input.Images {
+				producers[normalizeImageName(image)] = offset - 1
+			}
+		}
+	}
+
+	seen := make(map[string]struct{})
+	for inputIndex, input := range inputs {
+		for _, stage := range input.Dockerfile.Stages {
+			stage.File = filepath.ToSlash(input.File)
+			if input.Path != "" {
+				stage.Path = filepath.ToSlash(input.Path)
+			}
+			layers := make([]Layer, 0, len(stage.Layers))
+			for _, layer := range stage.Layers {
+				waitFors := make([]WaitFor, 0, len(layer.WaitFors))
+				for _, waitFor := range layer.WaitFors {
+					var isStage bool
+					waitFor.ID, isStage = combinedWaitForID(input, offsets[inputIndex], producers, waitFor.ID)
+
+					// Keep each image once, even if several Dockerfiles
+					// use it. The IDs of everything else, e.g. separated
+					// images and build contexts, are only unique within
+					// their Dockerfile.
+					if !isStage {
+						externalImage := findExternalImage(input.Dockerfile, waitFor.ID)
+						// Every Dockerfile has its own build context.
+						if waitFor.ID == BuildContextID {
+							externalImage.Name = "build context of " + filepath.ToSlash(input.File)
+						}
+						if externalImage.ID != externalImage.Name {
+							waitFor.ID += "@" + filepath.ToSlash(input.File)
+							externalImage.ID = waitFor.ID
+						}
+						if _, ok := seen[waitFor.ID]; !ok {
+							seen[waitFor.ID] = struct{}{}
+							combined.ExternalImages = append(combined.ExternalImages, externalImage)
+						}
+					}
+					waitFors = append(waitFors, waitFor)
+				}
+				layer.WaitFors = waitFors
+				layers = append(layers, layer)
+			}
+			stage.Layers = layers
+			combined.Stages = append(combined.Stages, stage)
+		}
+	}
+
+	return combined
+}
+
+// combinedWaitForID returns the ID of a WaitFor in the combined graph, and
+// whether it refers to a stage.
+func combinedWaitForID(
+	input CombineInput, offset int, producers map[string]int, id string,
+) (string, bool) {
+	// Stages of the same Dockerfile
+	if stageIndex, found := findStageIndex(input.Dockerfile.Stages, id); found {
+		return strconv.Itoa(offset + stageIndex), true
+	}
+
+	// Images built by another Dockerfile
+	externalImage := findExternalImage(input.Dockerfile, id)
+	if producer, ok := producers[normalizeImageName(externalImage.Name)]; ok {
+		if producer < offset || producer >= offset+len(input.Dockerfile.Stages) {
+			return strconv.Itoa(producer), true
+		}
+	}
+
+	return id, false
+}
+
+// findExternalImage returns the external image with the given ID.
+func findExternalImage(sdf SimplifiedDockerfile, id string) ExternalImage {
+	if externalImage, ok := findImage(sdf.ExternalImages, id); ok {
+		return externalImage
+	}
+	return ExternalImage{ID: id, Name: id}
+}
+
+// findImage returns the external image with the given ID, if there is one.
+func findImage(externalImages []ExternalImage, id string) (ExternalImage, bool) {
+	for _, externalImage := range externalImages {
+		if externalImage.ID == id {
+			return externalImage, true
+		}
+	}
+	return ExternalImage{}, false
+}
+
+// normalizeImageName adds the implicit latest tag, so that ourorg/base and
+// ourorg/base:latest refer to the same image.
+func normalizeImageName(name string) string {
+	if strings.Contains(name, "@") {
+		return name
+	}
+	if lastSlash := strings.LastIndex(name, "/"); strings.Contains(name[lastSlash+1:], ":") {
+		return name
+	}
+	return name + ":latest"
+}
+
+// setStagePaths sets the Path of all stages, see Stage.Path.
+func setStagePaths(stages []Stage, path string) {
+	for i := range stages {
+		stages[i].Path = filepath.ToSlash(path)
+	}
+}
+
+// isDefaultTarget returns true if the stage is built by default, i.e. it is
+// the last stage of its Dockerfile.
+func isDefaultTarget(stages []Stage, stageIndex int) bool {
+	return stageIndex == len(stages)-1 || stages[stageIndex+1].File != stages[stageIndex].File
+}
+
+// fileClusters returns the IDs of the clusters for the Dockerfiles of
+// combined graphs, in the order of their first stage.
+func fileClusters(stages []Stage) (files []string, clusterIDs map[string]string) {
+	clusterIDs = make(map[string]string)
+	for _, stage := range stages {
+		if stage.File == "" {
+			continue
+		}
+		if _, ok := clusterIDs[stage.File]; !ok {
+			clusterIDs[stage.File] = "cluster_file_" + strconv.Itoa(len(files))
+			files = append(files, stage.File)
+		}
+	}
+	return files, clusterIDs
+}
@@ -0,0 +1,202 @@
+package dockerfilegraph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCombineDockerfiles(t *testing.T) {
+	base := SimplifiedDockerfile{
+		ExternalImages: []ExternalImage{{ID: "alpine", Name: "alpine"}},
+		Stages: []Stage{
+			{Name: "build", Layers: []Layer{{
+				Label: "FROM alpine AS build", WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}},
+			}}},
+			{Layers: []Layer{{
+				Label: "FROM build", WaitFors: []WaitFor{{ID: "build", Type: WaitForFrom}},
+			}}},
+		},
+	}
+	app := SimplifiedDockerfile{
+		ExternalImages: []ExternalImage{
+			{ID: "ourorg/base", Name: "ourorg/base"},
+			{ID: "alpine", Name: "alpine"},
+		},
+		Stages: []Stage{
+			{Name: "build", Layers: []Layer{{
+				Label: "FROM ourorg/base AS build", WaitFors: []WaitFor{{ID: "ourorg/base", Type: WaitForFrom}},
+			}}},
+			{Layers: []Layer{
+				{Label: "FROM alpine", WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}}},
+				{Label: "COPY --from=build...", WaitFors: []WaitFor{{ID: "build", Type: WaitForCopy}}},
+			}},
+		},
+	}
+	nodeStage := SimplifiedDockerfile{
+		ExternalImages: []ExternalImage{{ID: "node:20", Name: "node:20"}, {ID: "scratch-0", Name: "scratch"}},
+		Stages: []Stage{
+			{Name: "node", Layers: []Layer{{
+				Label: "FROM node:20 AS node", WaitFors: []WaitFor{{ID: "node:20", Type: WaitForFrom}},
+			}}},
+			{Layers: []Layer{{
+				Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch-0", Type: WaitForFrom}},
+			}}},
+		},
+	}
+	nodeImage := SimplifiedDockerfile{
+		ExternalImages: []ExternalImage{{ID: "node", Name: "node"}, {ID: "scratch-0", Name: "scratch"}},
+		Stages: []Stage{
+			{Layers: []Layer{{
+				Label: "FROM node", WaitFors: []WaitFor{{ID: "node", Type: WaitForFrom}},
+			}}},
+			{Layers: []Layer{{
+				Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch-0", Type: WaitForFrom}},
+			}}},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		inputs []CombineInput
+		want   SimplifiedDockerfile
+	}{
+		{
+			name: "links produced images and rewrites stage references",
+			inputs: []CombineInput{
+				{File: "base/Dockerfile", Dockerfile: base, Images: []string{"ourorg/base:latest"}},
+				{File: "app/Dockerfile", Dockerfile: app},
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{{ID: "alpine", Name: "alpine"}},
+				Stages: []Stage{
+					{Name: "build", File: "base/Dockerfile", Layers: []Layer{{
+						Label: "FROM alpine AS build", WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}},
+					}}},
+					{File: "base/Dockerfile", Layers: []Layer{{
+						Label: "FROM build", WaitFors: []WaitFor{{ID: "0", Type: WaitForFrom}},
+					}}},
+					{Name: "build", File: "app/Dockerfile", Layers: []Layer{{
+						Label: "FROM ourorg/base AS build", WaitFors: []WaitFor{{ID: "1", Type: WaitForFrom}},
+					}}},
+					{File: "app/Dockerfile", Layers: []Layer{
+						{Label: "FROM alpine", WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}}},
+						{Label: "COPY --from=build...", WaitFors: []WaitFor{{ID: "2", Type: WaitForCopy}}},
+					}},
+				},
+			},
+		},
+		{
+			name: "keeps images that are not built by the Dockerfiles",
+			inputs: []CombineInput{
+				{File: "app/Dockerfile", Dockerfile: app, Images: []string{"ourorg/app"}},
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "ourorg/base", Name: "ourorg/base"},
+					{ID: "alpine", Name: "alpine"},
+				},
+				Stages: []Stage{
+					{Name: "build", File: "app/Dockerfile", Layers: []Layer{{
+						Label: "FROM ourorg/base AS build", WaitFors: []WaitFor{{ID: "ourorg/base", Type: WaitForFrom}},
+					}}},
+					{File: "app/Dockerfile", Layers: []Layer{
+						{Label: "FROM alpine", WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}}},
+						{Label: "COPY --from=build...", WaitFors: []WaitFor{{ID: "0", Type: WaitForCopy}}},
+					}},
+				},
+			},
+		},
+		{
+			name: "keeps the IDs of different Dockerfiles apart",
+			inputs: []CombineInput{
+				{File: "a/Dockerfile", Dockerfile: nodeStage},
+				{File: "b/Dockerfile", Dockerfile: nodeImage},
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "node:20", Name: "node:20"},
+					{ID: "scratch-0@a/Dockerfile", Name: "scratch"},
+					{ID: "node", Name: "node"},
+					{ID: "scratch-0@b/Dockerfile", Name: "scratch"},
+				},
+				Stages: []Stage{
+					{Name: "node", File: "a/Dockerfile", Layers: []Layer{{
+						Label: "FROM node:20 AS node", WaitFors: []WaitFor{{ID: "node:20", Type: WaitForFrom}},
+					}}},
+					{File: "a/Dockerfile", Layers: []Layer{{
+						Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch-0@a/Dockerfile", Type: WaitForFrom}},
+					}}},
+					{File: "b/Dockerfile", Layers: []Layer{{
+						Label: "FROM node", WaitFors: []WaitFor{{ID: "node", Type: WaitForFrom}},
+					}}},
+					{File: "b/Dockerfile", Layers: []Layer{{
+						Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch-0@b/Dockerfile", Type: WaitForFrom}},
+					}}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CombineDockerfiles(tt.inputs)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("CombineDockerfiles() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_normalizeImageName(t *testing.T) {
+	tests := []struct {
+		name  string
+		image string
+		want  string
+	}{
+		{name: "no tag", image: "ourorg/base", want: "ourorg/base:latest"},
+		{name: "tag", image: "ourorg/base:1.0", want: "ourorg/base:1.0"},
+		{name: "registry with port", image: "localhost:5000/base", want: "localhost:5000/base:latest"},
+		{name: "digest", image: "alpine@sha256:abc", want: "alpine@sha256:abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeImageName(tt.image); got != tt.want {
+				t.Errorf("normalizeImageName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCombineDockerfilesNameCollision(t *testing.T) {
+	combined := CombineDockerfiles([]CombineInput{
+		{File: "a/Dockerfile", Dockerfile: SimplifiedDockerfile{
+			ExternalImages: []ExternalImage{{ID: "node:20", Name: "node:20"}},
+			Stages: []Stage{{Name: "node", Layers: []Layer{{
+				Label: "FROM node:20 AS node", WaitFors: []WaitFor{{ID: "node:20", Type: WaitForFrom}},
+			}}}},
+		}},
+		{File: "b/Dockerfile", Dockerfile: SimplifiedDockerfile{
+			ExternalImages: []ExternalImage{{ID: "node", Name: "node"}},
+			Stages: []Stage{{Layers: []Layer{{
+				Label: "FROM node", WaitFors: []WaitFor{{ID: "node", Type: WaitForFrom}},
+			}}}},
+		}},
+	})
+
+	dot, err := BuildDotFile(combined, BuildOptions{EdgeStyle: "default", MaxLabelLength: 20, NodeSep: 0.5, RankSep: 0.5})
+	if err != nil {
+		t.Fatalf("BuildDotFile() error = %v", err)
+	}
+	if !strings.Contains(dot, "external_image_1->stage_1") {
+		t.Errorf("BuildDotFile() has no edge from the node image to the stage of b/Dockerfile:\n%s", dot)
+	}
+
+	graph, err := BuildJSONFile(combined)
+	if err != nil {
+		t.Fatalf("BuildJSONFile() error = %v", err)
+	}
+	if !strings.Contains(graph, `"kind": "externalImage"`) {
+		t.Errorf("BuildJSONFile() does not refer to the node image:\n%s", graph)
+	}
+}
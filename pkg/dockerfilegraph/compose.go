@@ -0,0 +1,306 @@
+package dockerfilegraph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// composeFile contains the parts of a Compose file that affect the graph.
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Build *composeBuild `yaml:"build"`
+	Image string        `yaml:"image"`
+}
+
+type composeBuild struct {
+	Context            string         `yaml:"context"`
+	Dockerfile         string         `yaml:"dockerfile"`
+	DockerfileInline   string         `yaml:"dockerfile_inline"`
+	Target             string         `yaml:"target"`
+	Args               composeMapping `yaml:"args"`
+	AdditionalContexts composeMapping `yaml:"additional_contexts"`
+}
+
+// UnmarshalYAML supports the short syntax, in which build is only the
+// path of the context.
+func (b *composeBuild) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&b.Context)
+	}
+	type plain composeBuild
+	return node.Decode((*plain)(b))
+}
+
+// composeMapping is a mapping that may also be written as a list of
+// KEY=VALUE items. Like Compose, a KEY without a value takes its value from
+// the environment, and is ignored if the environment variable is not set.
+type composeMapping map[string]string
+
+// UnmarshalYAML supports both the mapping and the list syntax.
+func (m *composeMapping) UnmarshalYAML(node *yaml.Node) error {
+	values := make(map[string]*string)
+	if node.Kind == yaml.SequenceNode {
+		var items []string
+		if err := node.Decode(&items); err != nil {
+			return err
+		}
+		for _, item := range items {
+			key, value, hasValue := strings.Cut(item, "=")
+			if hasValue {
+				values[key] = &value
+			} else {
+				values[key] = nil
+			}
+		}
+	} else if err := node.Decode(&values); err != nil {
+		return err
+	}
+
+	*m = make(composeMapping, len(values))
+	for key, value := range values {
+		if value != nil {
+			(*m)[key] = *value
+		} else if envValue, ok := os.LookupEnv(key); ok {
+			(*m)[key] = envValue
+		}
+	}
+	return nil
+}
+
+// composeGroup is a Dockerfile that is built with the same args and
+// contexts by one or more services, which therefore share its stages.
+type composeGroup struct {
+	label    string
+	path     string // The Dockerfile relative to the Compose file, empty for dockerfile_inline
+	build    composeBuild
+	services []string
+	targets  []string
+	images   []string
+}
+
+// LoadComposeFile reads the build sections of a Compose file and returns a
+// single graph of all services. opts.Targets selects services instead of
+// stages. Services that build the same Dockerfile with the same args and
+// contexts share its stages, which are filtered to the targets of these
+// services. Each service is added as a Service that points to its stage.
+func LoadComposeFile(
+	ctx context.Context,
+	inputFS afero.Fs,
+	filename string,
+	opts ParseOptions,
+) (SimplifiedDockerfile, error) {
+	content, err := afero.ReadFile(inputFS, filename)
+	if err != nil {
+		return SimplifiedDockerfile{}, err
+	}
+	var compose composeFile
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		return SimplifiedDockerfile{}, fmt.Errorf("could not parse %s: %w", filename, err)
+	}
+
+	groups, err := groupComposeServices(compose, filepath.Dir(filename), opts.Targets)
+	if err != nil {
+		return SimplifiedDockerfile{}, err
+	}
+	if len(groups) == 0 {
+		return SimplifiedDockerfile{}, fmt.Errorf("could not find any services with a build section in %s", filename)
+	}
+
+	inputs := make([]CombineInput, 0, len(groups))
+	var services []Service
+	offset := 0
+	for _, group := range groups {
+		dockerfile, serviceStages, err := loadComposeGroup(ctx, inputFS, group, opts)
+		if err != nil {
+			return SimplifiedDockerfile{}, fmt.Errorf("service %q: %w", group.services[0], err)
+		}
+		for i, service := range group.services {
+			services = append(services, Service{Name: service, Stage: offset + serviceStages[i]})
+		}
+		offset += len(dockerfile.Stages)
+
+		input := CombineInput{File: group.label, Dockerfile: dockerfile}
+		// The images are built by the final stage only if all services of
+		// the group target the same stage.
+		if len(slices.Compact(slices.Clone(serviceStages))) == 1 {
+			input.Images = group.images
+		}
+		inputs = append(inputs, input)
+	}
+
+	combined := inputs[0].Dockerfile
+	if len(inputs) > 1 {
+		combined = CombineDockerfiles(inputs)
+	}
+	combined.Services = services
+	return combined, nil
+}
+
+// groupComposeServices returns the selected services with a build section,
+// grouped by their Dockerfile, args and contexts. The services are sorted by
+// name, and so are the groups by their first service.
+func groupComposeServices(compose composeFile, dir string, selected []string) ([]composeGroup, error) {
+	for _, name := range selected {
+		if _, ok := compose.Services[strings.TrimSpace(name)]; !ok {
+			return nil, fmt.Errorf("service %q not found", strings.TrimSpace(name))
+		}
+	}
+
+	var groups []composeGroup
+	groupIndices := make(map[string]int)
+	for _, name := range slices.Sorted(maps.Keys(compose.Services)) {
+		service := compose.Services[name]
+		if service.Build == nil {
+			continue
+		}
+		if len(selected) > 0 && !slices.ContainsFunc(selected, func(s string) bool {
+			return strings.TrimSpace(s) == name
+		}) {
+			continue
+		}
+
+		build := *service.Build
+		if build.DockerfileInline == "" {
+			contextDir := build.Context
+			if contextDir == "" {
+				contextDir = "."
+			}
+			if !filepath.IsAbs(contextDir) {
+				contextDir = filepath.Join(dir, contextDir)
+			}
+			if build.Dockerfile == "" {
+				build.Dockerfile = "Dockerfile"
+			}
+			if !filepath.IsAbs(build.Dockerfile) {
+				build.Dockerfile = filepath.Join(contextDir, build.Dockerfile)
+			}
+			build.Context = contextDir
+		}
+		target := build.Target
+		build.Target = ""
+
+		key, err := json.Marshal(build)
+		if err != nil {
+			return nil, err
+		}
+		groupIndex, ok := groupIndices[string(key)]
+		if !ok {
+			groupIndex = len(groups)
+			groupIndices[string(key)] = groupIndex
+			label, path := "dockerfile_inline of "+name, ""
+			if build.DockerfileInline == "" {
+				path = build.Dockerfile
+				if relPath, err := filepath.Rel(dir, build.Dockerfile); err == nil {
+					path = relPath
+				}
+				label = path
+			}
+			groups = append(groups, composeGroup{label: filepath.ToSlash(label), path: path, build: build})
+		}
+
+		group := &groups[groupIndex]
+		group.services = append(group.services, name)
+		group.targets = append(group.targets, target)
+		group.images = append(group.images, "service:"+name)
+		if service.Image != "" {
+			group.images = append(group.images, service.Image)
+		}
+	}
+
+	// Tell apart the clusters of a Dockerfile that is built with different
+	// args or contexts.
+	labelCounts := make(map[string]int, len(groups))
+	for _, group := range groups {
+		labelCounts[group.label]++
+	}
+	for i := range groups {
+		if labelCounts[groups[i].label] > 1 {
+			groups[i].label += " (" + strings.Join(groups[i].services, ", ") + ")"
+		}
+	}
+
+	return groups, nil
+}
+
+// loadComposeGroup parses the Dockerfile of a group of services, filtered to
+// the stages they need or with the others marked as unused, and returns the
+// stage index of each service.
+func loadComposeGroup(
+	ctx context.Context,
+	inputFS afero.Fs,
+	group composeGroup,
+	opts ParseOptions,
+) (SimplifiedDockerfile, []int, error) {
+	// Build args from the command line take precedence.
+	buildArgs := maps.Clone(map[string]string(group.build.Args))
+	if buildArgs == nil {
+		buildArgs = make(map[string]string, len(opts.BuildArgs))
+	}
+	maps.Copy(buildArgs, opts.BuildArgs)
+	opts.BuildArgs = buildArgs
+
+	contexts := maps.Clone(map[string]string(group.build.AdditionalContexts))
+	if contexts == nil {
+		contexts = make(map[string]string, len(opts.Contexts))
+	}
+	maps.Copy(contexts, opts.Contexts)
+	opts.Contexts = contexts
+	opts.ContextDir = group.build.Context
+	opts.Targets = nil
+
+	var dockerfile SimplifiedDockerfile
+	var err error
+	if group.build.DockerfileInline != "" {
+		dockerfile, err = ParseDockerfile(ctx, strings.NewReader(group.build.DockerfileInline), opts)
+	} else {
+		dockerfile, err = LoadAndParseDockerfile(ctx, inputFS, group.build.Dockerfile, opts)
+	}
+	if err != nil {
+		return SimplifiedDockerfile{}, nil, err
+	}
+
+	// The links of the stages are relative to the directory of the Compose
+	// file.
+	if group.path != "" {
+		setStagePaths(dockerfile.Stages, group.path)
+	}
+
+	// Services without a target build the last stage.
+	targets := slices.Clone(group.targets)
+	for i, target := range targets {
+		if target == "" {
+			targets[i] = strconv.Itoa(len(dockerfile.Stages) - 1)
+		}
+	}
+	if opts.HighlightUnused {
+		dockerfile, err = MarkUnusedStages(dockerfile, targets)
+	} else {
+		dockerfile, err = FilterToTargets(dockerfile, targets)
+	}
+	if err != nil {
+		return SimplifiedDockerfile{}, nil, err
+	}
+
+	serviceStages := make([]int, len(group.targets))
+	for i, target := range group.targets {
+		serviceStages[i] = len(dockerfile.Stages) - 1
+		if target != "" {
+			serviceStages[i], _ = findStageIndex(dockerfile.Stages, target)
+		}
+	}
+
+	return dockerfile, serviceStages, nil
+}
@@ -0,0 +1,207 @@
+package dockerfilegraph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/spf13/afero"
+)
+
+func TestLoadComposeFile(t *testing.T) {
+	inputFS := afero.NewMemMapFs()
+	for path, content := range map[string]string{
+		"project/Dockerfile": `ARG NODE_VERSION=20
+FROM node:${NODE_VERSION} AS deps
+FROM deps AS dev
+FROM deps AS build
+FROM nginx AS web
+COPY --from=build / /
+`,
+		"project/worker/Dockerfile": "FROM base\n",
+		"project/compose.yaml": `
+services:
+  db:
+    image: postgres
+  dev:
+    build:
+      context: .
+      target: dev
+  web:
+    image: ourorg/web
+    build:
+      context: .
+      args:
+        NODE_VERSION: "22"
+      target: web
+  app:
+    build:
+      context: .
+      args:
+        - NODE_VERSION=22
+  worker:
+    build:
+      context: worker
+      additional_contexts:
+        base: service:app
+`,
+		"project/short.yaml": `
+services:
+  app:
+    build: .
+`,
+	} {
+		_ = afero.WriteFile(inputFS, path, []byte(content), 0o644)
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		opts     ParseOptions
+		want     SimplifiedDockerfile
+		wantErr  string
+	}{
+		{
+			name:     "services share the stages of the same build",
+			filename: "project/compose.yaml",
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "node:22", Name: "node:22"},
+					{ID: "nginx", Name: "nginx"},
+					{ID: "node:20", Name: "node:20"},
+				},
+				Stages: []Stage{
+					{Name: "deps", File: "Dockerfile (app, web)", Layers: []Layer{{
+						Label: "FROM node:22 AS deps", WaitFors: []WaitFor{{ID: "node:22", Type: WaitForFrom}},
+					}}},
+					{Name: "build", File: "Dockerfile (app, web)", Layers: []Layer{{
+						Label: "FROM deps AS build", WaitFors: []WaitFor{{ID: "0", Type: WaitForFrom}},
+					}}},
+					{Name: "web", File: "Dockerfile (app, web)", Layers: []Layer{
+						{Label: "FROM nginx AS web", WaitFors: []WaitFor{{ID: "nginx", Type: WaitForFrom}}},
+						{Label: "COPY --from=build / /", WaitFors: []WaitFor{{ID: "1", Type: WaitForCopy}}},
+					}},
+					{Name: "deps", File: "Dockerfile (dev)", Layers: []Layer{{
+						Label: "FROM node:20 AS deps", WaitFors: []WaitFor{{ID: "node:20", Type: WaitForFrom}},
+					}}},
+					{Name: "dev", File: "Dockerfile (dev)", Layers: []Layer{{
+						Label: "FROM deps AS dev", WaitFors: []WaitFor{{ID: "3", Type: WaitForFrom}},
+					}}},
+					{File: "worker/Dockerfile", Layers: []Layer{{
+						Label: "FROM base", WaitFors: []WaitFor{{ID: "2", Type: WaitForFrom}},
+					}}},
+				},
+				Services: []Service{
+					{Name: "app", Stage: 2},
+					{Name: "web", Stage: 2},
+					{Name: "dev", Stage: 4},
+					{Name: "worker", Stage: 5},
+				},
+			},
+		},
+		{
+			name:     "selected service with the short build syntax",
+			filename: "project/short.yaml",
+			opts:     ParseOptions{Targets: []string{"app"}},
+			want: SimplifiedDockerfile{
+				BeforeFirstStage: []Layer{{Label: "ARG NODE_VERSION=20"}},
+				ExternalImages: []ExternalImage{
+					{ID: "node:20", Name: "node:20"},
+					{ID: "nginx", Name: "nginx"},
+				},
+				Stages: []Stage{
+					{Name: "deps", Layers: []Layer{{
+						Label: "FROM node:20 AS deps", WaitFors: []WaitFor{{ID: "node:20", Type: WaitForFrom}},
+					}}},
+					{Name: "build", Layers: []Layer{{
+						Label: "FROM deps AS build", WaitFors: []WaitFor{{ID: "deps", Type: WaitForFrom}},
+					}}},
+					{Name: "web", Layers: []Layer{
+						{Label: "FROM nginx AS web", WaitFors: []WaitFor{{ID: "nginx", Type: WaitForFrom}}},
+						{Label: "COPY --from=build / /", WaitFors: []WaitFor{{ID: "build", Type: WaitForCopy}}},
+					}},
+				},
+				Services: []Service{{Name: "app", Stage: 2}},
+			},
+		},
+		{
+			name:     "unknown service",
+			filename: "project/compose.yaml",
+			opts:     ParseOptions{Targets: []string{"missing"}},
+			wantErr:  `service "missing" not found`,
+		},
+		{
+			name:     "no services with a build section",
+			filename: "project/compose.yaml",
+			opts:     ParseOptions{Targets: []string{"db"}},
+			wantErr:  "could not find any services with a build section in project/compose.yaml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.MaxLabelLength = 40
+			got, err := LoadComposeFile(context.Background(), inputFS, tt.filename, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("LoadComposeFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadComposeFile() error = %v", err)
+			}
+			if diff := cmp.Diff(
+				tt.want, got,
+				cmpopts.IgnoreFields(Stage{}, "Source", "Path"), cmpopts.IgnoreFields(Layer{}, "Source"),
+				cmpopts.IgnoreFields(WaitFor{}, "Copy"),
+				cmpopts.IgnoreFields(ExternalImage{}, "Registry", "Repository", "Tag", "Digest"),
+			); diff != "" {
+				t.Errorf("LoadComposeFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadComposeFileDockerignore(t *testing.T) {
+	inputFS := afero.NewMemMapFs()
+	for path, content := range map[string]string{
+		"project/.dockerignore":     "secret\n",
+		"project/secret":            "password",
+		"project/src/main.go":       "package main",
+		"project/docker/Dockerfile": "FROM scratch\nCOPY secret /x\nCOPY src/ /src/\n",
+		"project/compose.yaml": `
+services:
+  app:
+    build:
+      context: .
+      dockerfile: docker/Dockerfile
+`,
+	} {
+		_ = afero.WriteFile(inputFS, path, []byte(content), 0o644)
+	}
+
+	got, err := LoadComposeFile(
+		context.Background(), inputFS, "project/compose.yaml", ParseOptions{MaxLabelLength: 20, ShowContext: true},
+	)
+	if err != nil {
+		t.Fatalf("LoadComposeFile() error = %v", err)
+	}
+	want := []Layer{
+		{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}}},
+		{Label: "COPY secret /x", Warnings: []string{`"secret" is excluded by .dockerignore, so nothing is copied`}},
+		{
+			Label:    "COPY src/ /src/",
+			WaitFors: []WaitFor{{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"src/"}}},
+		},
+	}
+	if diff := cmp.Diff(
+		want, got.Stages[0].Layers,
+		cmpopts.IgnoreFields(Layer{}, "Source"), cmpopts.IgnoreFields(WaitFor{}, "Copy"), cmpopts.EquateEmpty(),
+	); diff != "" {
+		t.Errorf("LoadComposeFile() layers mismatch (-want +got):\n%s", diff)
+	}
+	if got.Stages[0].Path != "docker/Dockerfile" {
+		t.Errorf("LoadComposeFile() stage path = %q, want %q", got.Stages[0].Path, "docker/Dockerfile")
+	}
+}
@@ -0,0 +1,818 @@
+package dockerfilegraph
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aquilax/truncate"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/moby/buildkit/frontend/dockerfile/shell"
+)
+
+// ArgReplacement holds a key-value pair for ARG variable substitution in Dockerfiles.
+type ArgReplacement struct {
+	Key   string
+	Value string
+}
+
+const (
+	instructionFrom = "FROM"
+	instructionCopy = "COPY"
+	instructionAdd  = "ADD"
+	instructionRun  = "RUN"
+	instructionArg  = "ARG"
+	instructionEnv  = "ENV"
+)
+
+var (
+	varNameRegex  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*`)
+	fromFlagRegex = regexp.MustCompile("--from=(.+)")
+)
+
+// newLayer creates a new layer object with a modified label.
+func newLayer(
+	node *parser.Node, argReplacements []ArgReplacement, maxLabelLength int,
+) (layer Layer) {
+	// Replace argument variables in the original label.
+	label := replaceArgVars(node.Original, argReplacements)
+
+	// Replace double quotes with single quotes.
+	label = strings.ReplaceAll(label, "\"", "'")
+
+	// Collapse multiple spaces into a single space.
+	label = strings.Join(strings.Fields(label), " ")
+
+	// Truncate the label if it exceeds the maximum length.
+	if len(label) > maxLabelLength {
+		label = truncate.Truncate(label, maxLabelLength, "...", truncate.PositionEnd)
+	}
+
+	// Set the label of the layer object.
+	layer.Label = label
+
+	// Remember where the instruction is in the Dockerfile.
+	layer.Source = SourceRange{StartLine: node.StartLine, EndLine: node.EndLine}
+
+	return
+}
+
+func dockerfileToSimplifiedDockerfile(
+	content []byte,
+	opts ParseOptions,
+) (simplifiedDockerfile SimplifiedDockerfile, err error) {
+	result, err := parser.Parse(bytes.NewReader(content))
+	if err != nil {
+		return
+	}
+
+	// Set that holds all stage IDs
+	stages := make(map[string]struct{})
+
+	stageIndex := -1
+
+	argReplacements := make([]ArgReplacement, 0)
+
+	// With a target platform, the automatic platform ARGs are defined
+	buildArgs := opts.BuildArgs
+	targetPlatform, buildPlatform, hasPlatform, err := platformOptions(opts)
+	if err != nil {
+		return
+	}
+	if hasPlatform {
+		buildArgs, argReplacements = withPlatformArgs(buildArgs, argReplacements, targetPlatform, buildPlatform)
+	}
+
+	// The variables that are visible inside each stage
+	scopes := make([]stageScope, 0)
+
+	for _, node := range result.AST.Children {
+		switch strings.ToUpper(node.Value) {
+		case instructionFrom:
+			// Create a new stage
+			stageIndex++
+			stage, layer := processFromInstruction(node, argReplacements, opts.MaxLabelLength, opts.ScratchMode, stages)
+			if hasPlatform {
+				stage.Platform = stagePlatform(node, argReplacements, simplifiedDockerfile.Stages, targetPlatform)
+				stage.Emulated = stage.Platform != buildPlatform.String()
+			}
+			scopes = append(scopes, newStageScope(
+				simplifiedDockerfile.Stages, scopes, replaceArgVars(node.Next.Value, argReplacements),
+			))
+			simplifiedDockerfile.Stages = append(simplifiedDockerfile.Stages, stage)
+
+			// Add a new layer
+			simplifiedDockerfile.Stages[stageIndex].Layers = append(
+				simplifiedDockerfile.Stages[stageIndex].Layers,
+				layer,
+			)
+
+		case instructionCopy:
+			layer := processCopyInstruction(node, scopes[stageIndex].vars(), opts.MaxLabelLength, opts.ScratchMode)
+			if opts.ShowContext && !hasFromFlag(node) {
+				addBuildContextWaitFor(&layer, node, scopes[stageIndex].vars())
+			}
+			simplifiedDockerfile.Stages[stageIndex].Layers = append(
+				simplifiedDockerfile.Stages[stageIndex].Layers,
+				layer,
+			)
+
+		case instructionAdd:
+			layer := processAddInstruction(node, scopes[stageIndex].vars(), opts.MaxLabelLength)
+			if opts.ShowContext {
+				addBuildContextWaitFor(&layer, node, scopes[stageIndex].vars())
+			}
+			simplifiedDockerfile.Stages[stageIndex].Layers = append(
+				simplifiedDockerfile.Stages[stageIndex].Layers,
+				layer,
+			)
+
+		case instructionRun:
+			layer := processRunInstruction(node, scopes[stageIndex].vars(), opts.MaxLabelLength, opts.ScratchMode)
+			simplifiedDockerfile.Stages[stageIndex].Layers = append(
+				simplifiedDockerfile.Stages[stageIndex].Layers,
+				layer,
+			)
+
+		default:
+			if stageIndex == -1 {
+				layer := processBeforeFirstStage(node, &argReplacements, buildArgs, opts.MaxLabelLength)
+				simplifiedDockerfile.BeforeFirstStage = append(
+					simplifiedDockerfile.BeforeFirstStage,
+					layer,
+				)
+				break
+			}
+
+			layer := newLayer(node, scopes[stageIndex].vars(), opts.MaxLabelLength)
+			scopes[stageIndex].update(node, argReplacements, buildArgs)
+			simplifiedDockerfile.Stages[stageIndex].Layers = append(
+				simplifiedDockerfile.Stages[stageIndex].Layers,
+				layer,
+			)
+		}
+	}
+
+	// A stage spans from its FROM line to its last instruction
+	for i, stage := range simplifiedDockerfile.Stages {
+		simplifiedDockerfile.Stages[i].Source = SourceRange{
+			StartLine: stage.Layers[0].Source.StartLine,
+			EndLine:   stage.Layers[len(stage.Layers)-1].Source.EndLine,
+		}
+	}
+
+	addExternalImages(&simplifiedDockerfile, stages, opts.ScratchMode, opts.SeparateImages, opts.Contexts)
+
+	return
+}
+
+// shouldSkipScratchWaitFor returns true if scratch WaitFors should be skipped in hidden mode
+func shouldSkipScratchWaitFor(scratchMode ScratchMode, waitForID string) bool {
+	return scratchMode == ScratchHidden && waitForID == "scratch"
+}
+
+// processFromInstruction handles FROM instruction parsing
+func processFromInstruction(
+	node *parser.Node,
+	argReplacements []ArgReplacement,
+	maxLabelLength int,
+	scratchMode ScratchMode,
+	stages map[string]struct{},
+) (Stage, Layer) {
+	stage := Stage{}
+
+	// If there is an "AS" alias, set it as the name
+	if node.Next.Next != nil {
+		stage.Name = node.Next.Next.Next.Value
+		stages[stage.Name] = struct{}{}
+	}
+
+	layer := newLayer(node, argReplacements, maxLabelLength)
+
+	// Set the waitFor ID (skip scratch in hidden mode)
+	waitForID := replaceArgVars(node.Next.Value, argReplacements)
+	if !shouldSkipScratchWaitFor(scratchMode, waitForID) {
+		layer.WaitFors = []WaitFor{{
+			ID:   waitForID,
+			Type: WaitForFrom,
+		}}
+	}
+
+	return stage, layer
+}
+
+// processCopyInstruction handles COPY instruction parsing
+func processCopyInstruction(
+	node *parser.Node,
+	argReplacements []ArgReplacement,
+	maxLabelLength int,
+	scratchMode ScratchMode,
+) Layer {
+	layer := newLayer(node, argReplacements, maxLabelLength)
+
+	// If there is a "--from" option, set the waitFor ID (skip scratch in hidden mode)
+	for _, flag := range node.Flags {
+		result := fromFlagRegex.FindSubmatch([]byte(replaceArgVars(flag, argReplacements)))
+		if len(result) > 1 {
+			fromID := string(result[1])
+			if !shouldSkipScratchWaitFor(scratchMode, fromID) {
+				copyOpts := parseCopyOptions(node, argReplacements)
+				layer.WaitFors = []WaitFor{{
+					ID:   fromID,
+					Type: WaitForCopy,
+					Copy: &copyOpts,
+				}}
+			}
+		}
+	}
+
+	return layer
+}
+
+// processAddInstruction handles ADD instruction parsing. Every remote
+// source, a URL or a Git repository, becomes a dependency of the layer.
+func processAddInstruction(
+	node *parser.Node,
+	argReplacements []ArgReplacement,
+	maxLabelLength int,
+) Layer {
+	layer := newLayer(node, argReplacements, maxLabelLength)
+
+	var checksum string
+	keepGitDir := false
+	for _, flag := range node.Flags {
+		flag = replaceArgVars(flag, argReplacements)
+		if value, ok := strings.CutPrefix(flag, "--checksum="); ok {
+			checksum = value
+		}
+		if flag == "--keep-git-dir" || flag == "--keep-git-dir=true" {
+			keepGitDir = true
+		}
+	}
+
+	copyOpts := parseCopyOptions(node, argReplacements)
+	for _, source := range copyOpts.Sources {
+		if !isRemoteSource(source) {
+			continue
+		}
+		layer.WaitFors = append(layer.WaitFors, WaitFor{
+			ID:         source,
+			Type:       WaitForAdd,
+			Checksum:   checksum,
+			KeepGitDir: keepGitDir && isGitSource(source),
+			Copy:       &copyOpts,
+		})
+	}
+
+	return layer
+}
+
+// hasFromFlag returns true if a COPY instruction copies from a stage or an
+// image instead of the build context.
+func hasFromFlag(node *parser.Node) bool {
+	for _, flag := range node.Flags {
+		if strings.HasPrefix(flag, "--from=") {
+			return true
+		}
+	}
+	return false
+}
+
+// addBuildContextWaitFor adds the build context as a source of a COPY or ADD
+// instruction, with the paths that are copied from it.
+func addBuildContextWaitFor(layer *Layer, node *parser.Node, argReplacements []ArgReplacement) {
+	paths := buildContextPaths(node, argReplacements)
+	if len(paths) == 0 {
+		return
+	}
+	copyOpts := parseCopyOptions(node, argReplacements)
+	layer.WaitFors = append(layer.WaitFors, WaitFor{
+		ID:    BuildContextID,
+		Type:  WaitForCopy,
+		Paths: paths,
+		Copy:  &copyOpts,
+	})
+}
+
+// buildContextPaths returns the sources of a COPY or ADD instruction that are
+// read from the build context, i.e. without heredocs and remote sources.
+func buildContextPaths(node *parser.Node, argReplacements []ArgReplacement) []string {
+	var paths []string
+	for _, source := range sourceArgs(node) {
+		if strings.HasPrefix(source, "<<") {
+			continue
+		}
+		source = expandCopyArg(source, argReplacements)
+		if isRemoteSource(source) {
+			continue
+		}
+		paths = append(paths, source)
+	}
+	return paths
+}
+
+// sourceArgs returns the sources of a COPY or ADD instruction, i.e. all
+// arguments except the last one, the destination.
+func sourceArgs(node *parser.Node) []string {
+	var args []string
+	for n := node.Next; n != nil; n = n.Next {
+		args = append(args, n.Value)
+	}
+	if len(args) < 2 {
+		return nil
+	}
+	return args[:len(args)-1]
+}
+
+// parseCopyOptions returns the paths and the flags of a COPY or ADD
+// instruction that change what ends up in the layer.
+func parseCopyOptions(node *parser.Node, argReplacements []ArgReplacement) CopyOptions {
+	var copyOpts CopyOptions
+	for _, source := range sourceArgs(node) {
+		if !strings.HasPrefix(source, "<<") {
+			source = expandCopyArg(source, argReplacements)
+		}
+		copyOpts.Sources = append(copyOpts.Sources, source)
+	}
+	for n := node.Next; n != nil; n = n.Next {
+		if n.Next == nil && len(copyOpts.Sources) > 0 {
+			copyOpts.Destination = expandCopyArg(n.Value, argReplacements)
+		}
+	}
+
+	for _, flag := range node.Flags {
+		flag = replaceArgVars(flag, argReplacements)
+		switch {
+		case flag == "--link" || flag == "--link=true":
+			copyOpts.Link = true
+		case flag == "--parents" || flag == "--parents=true":
+			copyOpts.Parents = true
+		case strings.HasPrefix(flag, "--chown="):
+			copyOpts.Chown = strings.TrimPrefix(flag, "--chown=")
+		case strings.HasPrefix(flag, "--chmod="):
+			copyOpts.Chmod = strings.TrimPrefix(flag, "--chmod=")
+		case strings.HasPrefix(flag, "--exclude="):
+			copyOpts.Exclude = append(copyOpts.Exclude, strings.TrimPrefix(flag, "--exclude="))
+		}
+	}
+	return copyOpts
+}
+
+// isRemoteSource returns true if the source of an ADD instruction or a named
+// build context is a URL or a Git repository.
+func isRemoteSource(source string) bool {
+	return strings.Contains(source, "://") || strings.HasPrefix(source, "git@")
+}
+
+// isGitSource returns true if a remote source is a Git repository. Like
+// BuildKit, these are SSH and git:// URLs, and URLs whose path ends in .git,
+// optionally followed by a #ref.
+func isGitSource(source string) bool {
+	for _, prefix := range []string{"git@", "git://", "ssh://"} {
+		if strings.HasPrefix(source, prefix) {
+			return true
+		}
+	}
+	source, _, _ = strings.Cut(source, "#")
+	source, _, _ = strings.Cut(source, "?")
+	return strings.HasSuffix(source, ".git")
+}
+
+// remoteSourceType returns the type of the node for a remote source.
+func remoteSourceType(source string) ExternalImageType {
+	if isGitSource(source) {
+		return ExternalImageGit
+	}
+	return ExternalImageURL
+}
+
+// processRunInstruction handles RUN instruction parsing
+func processRunInstruction(
+	node *parser.Node,
+	argReplacements []ArgReplacement,
+	maxLabelLength int,
+	scratchMode ScratchMode,
+) Layer {
+	layer := newLayer(node, argReplacements, maxLabelLength)
+
+	// Every --mount option that needs a stage, an image, a cache, a secret
+	// or an SSH agent becomes a waitFor (skip scratch in hidden mode)
+	for _, flag := range node.Flags {
+		value, ok := strings.CutPrefix(replaceArgVars(flag, argReplacements), "--mount=")
+		if !ok {
+			continue
+		}
+		mount, err := parseMount(value)
+		if err != nil {
+			continue
+		}
+		mountID := mountWaitForID(mount)
+		if mountID == "" || shouldSkipScratchWaitFor(scratchMode, mountID) {
+			continue
+		}
+		layer.WaitFors = append(layer.WaitFors, WaitFor{
+			ID:    mountID,
+			Type:  WaitForMount,
+			Mount: &mount,
+		})
+	}
+
+	return layer
+}
+
+// processBeforeFirstStage handles instructions before the first FROM
+func processBeforeFirstStage(
+	node *parser.Node,
+	argReplacements *[]ArgReplacement,
+	buildArgs map[string]string,
+	maxLabelLength int,
+) Layer {
+	layer := newLayer(node, *argReplacements, maxLabelLength)
+
+	// Global ARGs are only visible in FROM instructions, unless a stage
+	// declares them again, see stageScope.
+	if strings.ToUpper(node.Value) == instructionArg {
+		for arg := node.Next; arg != nil; arg = arg.Next {
+			key, value, valueProvided := strings.Cut(arg.Value, "=")
+
+			// Like docker build, a build arg overrides the default value,
+			// but only for ARGs that are declared in the Dockerfile. An ARG
+			// that is declared again replaces the previous value.
+			if buildArg, ok := buildArgs[key]; ok {
+				*argReplacements = setArgReplacement(*argReplacements, key, buildArg)
+				continue
+			}
+			if valueProvided {
+				*argReplacements = setArgReplacement(*argReplacements, key, expandArgValue(value, *argReplacements))
+			}
+		}
+	}
+
+	return layer
+}
+
+// stageScope holds the variables that are visible inside a single build stage.
+type stageScope struct {
+	args []ArgReplacement // ARGs declared in this stage
+	env  []ArgReplacement // ENV values, including those inherited from the parent stage
+}
+
+// newStageScope returns the scope of a new stage. A stage that is based on
+// a previous stage inherits its ENV values, but not its ARGs.
+func newStageScope(stages []Stage, scopes []stageScope, baseName string) stageScope {
+	scope := stageScope{}
+	if parentIndex, found := findStageIndex(stages, baseName); found {
+		scope.env = slices.Clone(scopes[parentIndex].env)
+	}
+	return scope
+}
+
+// vars returns the variables of the scope. ENV values come first, because
+// they take precedence over ARGs with the same name.
+func (s stageScope) vars() []ArgReplacement {
+	return slices.Concat(s.env, s.args)
+}
+
+// update adds the variables declared by an ARG or ENV instruction.
+func (s *stageScope) update(
+	node *parser.Node,
+	globalArgs []ArgReplacement,
+	buildArgs map[string]string,
+) {
+	// All values of a single instruction are expanded using the variables
+	// that were defined before it.
+	vars := s.vars()
+
+	switch strings.ToUpper(node.Value) {
+	case instructionArg:
+		for arg := node.Next; arg != nil; arg = arg.Next {
+			key, value, valueProvided := strings.Cut(arg.Value, "=")
+			if buildArg, ok := buildArgs[key]; ok {
+				s.args = setArgReplacement(s.args, key, buildArg)
+			} else if valueProvided {
+				s.args = setArgReplacement(s.args, key, expandArgValue(value, vars))
+			} else if globalIndex := slices.IndexFunc(globalArgs, func(r ArgReplacement) bool {
+				return r.Key == key
+			}); globalIndex >= 0 {
+				// Re-declaring a global ARG without a value makes it visible.
+				s.args = setArgReplacement(s.args, key, globalArgs[globalIndex].Value)
+			}
+		}
+
+	case instructionEnv:
+		// ENV is parsed into triples of key, value and separator.
+		for key := node.Next; key != nil && key.Next != nil; {
+			value := key.Next
+			s.env = setArgReplacement(s.env, key.Value, expandArgValue(value.Value, vars))
+			if value.Next == nil {
+				break
+			}
+			key = value.Next.Next
+		}
+	}
+}
+
+// setArgReplacement sets the value of key, replacing a previous value.
+func setArgReplacement(argReplacements []ArgReplacement, key, value string) []ArgReplacement {
+	for i, r := range argReplacements {
+		if r.Key == key {
+			argReplacements = slices.Clone(argReplacements)
+			argReplacements[i].Value = value
+			return argReplacements
+		}
+	}
+	return append(argReplacements, ArgReplacement{Key: key, Value: value})
+}
+
+// addExternalImages processes all layers and identifies external images.
+func addExternalImages(
+	simplifiedDockerfile *SimplifiedDockerfile,
+	stages map[string]struct{},
+	scratchMode ScratchMode,
+	separateImages []string,
+	contexts map[string]string,
+) {
+	// Build a set of images that should be separated, normalizing whitespace
+	separateSet := make(map[string]struct{}, len(separateImages))
+	for _, img := range separateImages {
+		img = strings.TrimSpace(img)
+		if img == "" {
+			continue
+		}
+		separateSet[img] = struct{}{}
+	}
+
+	// Per-image counters for generating unique IDs when separating
+	separateCounters := make(map[string]int)
+
+	// Track already-seen image IDs to avoid duplicates
+	seen := make(map[string]struct{})
+
+	// Iterate through all stages and layers to find external image dependencies
+	for stageIndex, stage := range simplifiedDockerfile.Stages {
+		for layerIndex, layer := range stage.Layers {
+			for waitForIndex, waitFor := range layer.WaitFors {
+				imageID, skip := resolveExternalImageID(
+					waitFor.ID, simplifiedDockerfile.Stages, stages, scratchMode, separateSet, separateCounters, contexts,
+				)
+				if skip {
+					continue
+				}
+				if imageID != waitFor.ID {
+					simplifiedDockerfile.Stages[stageIndex].Layers[layerIndex].WaitFors[waitForIndex].ID = imageID
+				}
+
+				// Add to external images if not already present
+				if _, exists := seen[imageID]; !exists {
+					seen[imageID] = struct{}{}
+					name, imageType := contextSource(contexts, waitFor.ID)
+					simplifiedDockerfile.ExternalImages = append(
+						simplifiedDockerfile.ExternalImages,
+						withImageReference(ExternalImage{ID: imageID, Name: name, Type: imageType}),
+					)
+				}
+			}
+		}
+	}
+}
+
+// contextSource returns what a named build context replaces the image with,
+// e.g. alpine:3.20 for docker-image://alpine:3.20 or a local directory, or
+// the image itself if there is no such context.
+func contextSource(contexts map[string]string, image string) (string, ExternalImageType) {
+	if image == BuildContextID {
+		return "build context", ExternalImageDirectory
+	}
+	if name, imageType, ok := mountSource(image); ok {
+		return name, imageType
+	}
+	source, ok := contexts[image]
+	if !ok {
+		// The remote sources of ADD instructions
+		if isRemoteSource(image) {
+			return image, remoteSourceType(image)
+		}
+		return image, ExternalImageRegistry
+	}
+
+	if name, ok := strings.CutPrefix(source, "docker-image://"); ok {
+		return name, ExternalImageRegistry
+	}
+	// Other images, and the targets of bake files or the services of
+	// Compose files, which are linked by CombineDockerfiles
+	for _, prefix := range []string{"oci-layout://", "target:", "service:"} {
+		if strings.HasPrefix(source, prefix) {
+			return source, ExternalImageRegistry
+		}
+	}
+	if isRemoteSource(source) {
+		return source, remoteSourceType(source)
+	}
+	return source, ExternalImageDirectory
+}
+
+// resolveExternalImageID determines the graph node ID for a WaitFor dependency.
+// It returns (imageID, skip=true) when the dependency should be omitted entirely
+// (internal stage reference or scratch in hidden mode).
+func resolveExternalImageID(
+	rawID string,
+	allStages []Stage,
+	stageNameSet map[string]struct{},
+	scratchMode ScratchMode,
+	separateSet map[string]struct{},
+	separateCounters map[string]int,
+	contexts map[string]string,
+) (imageID string, skip bool) {
+	// Skip internal stage references by name, unless a named build context
+	// replaces the stage, like BuildKit does. Stage names cannot contain a
+	// colon, so the prefixed ID does not resolve to the stage.
+	if _, ok := stageNameSet[rawID]; ok {
+		if _, replaced := contexts[rawID]; replaced {
+			return "context:" + rawID, false
+		}
+		return "", true
+	}
+
+	// Skip internal stage references by numeric index (in-range only)
+	if _, err := strconv.Atoi(rawID); err == nil {
+		if _, found := findStageIndex(allStages, rawID); found {
+			return "", true
+		}
+	}
+
+	// Handle scratch modes
+	if rawID == "scratch" {
+		switch scratchMode {
+		case ScratchHidden:
+			return "", true
+		case ScratchSeparated:
+			id := fmt.Sprintf("scratch-%d", separateCounters["scratch"])
+			separateCounters["scratch"]++
+			return id, false
+		}
+		return rawID, false
+	}
+
+	// Separate other explicitly listed images
+	if _, shouldSeparate := separateSet[rawID]; shouldSeparate {
+		id := fmt.Sprintf("%s-%d", rawID, separateCounters[rawID])
+		separateCounters[rawID]++
+		return id, false
+	}
+
+	return rawID, false
+}
+
+// argEnv makes resolved replacements available to the shell lexer.
+// If a key appears more than once, the first value wins, so that ENV values
+// take precedence over ARGs, see stageScope.vars.
+type argEnv []ArgReplacement
+
+func (e argEnv) Get(key string) (string, bool) {
+	for _, r := range e {
+		if r.Key == key {
+			return r.Value, true
+		}
+	}
+	return "", false
+}
+
+func (e argEnv) Keys() []string {
+	keys := make([]string, 0, len(e))
+	for _, r := range e {
+		keys = append(keys, r.Key)
+	}
+	return keys
+}
+
+// expandArgValue expands the value of an ARG or ENV instruction the way
+// docker build does, including quotes and modifiers like ${VAR:-default}.
+// Undefined variables expand to an empty string.
+func expandArgValue(value string, resolvedReplacements []ArgReplacement) string {
+	result, _, err := shell.NewLex(parser.DefaultEscapeToken).ProcessWord(value, argEnv(resolvedReplacements))
+	if err != nil {
+		return replaceArgVars(value, resolvedReplacements)
+	}
+	return result
+}
+
+// expandCopyArg returns a source or the destination of a COPY or ADD
+// instruction with its ARG variables replaced and, like BuildKit does for
+// shell-form arguments, its quotes and escape characters removed, e.g.
+// "src"/ becomes src/.
+func expandCopyArg(value string, resolvedReplacements []ArgReplacement) string {
+	return unquoteWord(replaceArgVars(value, resolvedReplacements))
+}
+
+// unquoteWord removes the quotes and escape characters of a shell word. Text
+// in single quotes is taken literally, while in double quotes only ", $ and
+// the escape character itself can be escaped.
+func unquoteWord(word string) string {
+	var result strings.Builder
+	var quote byte
+	for i := 0; i < len(word); i++ {
+		ch := word[i]
+		switch {
+		case quote == '\'':
+			if ch == '\'' {
+				quote = 0
+			} else {
+				result.WriteByte(ch)
+			}
+		case quote == '"':
+			switch {
+			case ch == '"':
+				quote = 0
+			case ch == parser.DefaultEscapeToken && i+1 < len(word) && strings.IndexByte(`"$\`, word[i+1]) >= 0:
+				i++
+				result.WriteByte(word[i])
+			default:
+				result.WriteByte(ch)
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == parser.DefaultEscapeToken && i+1 < len(word):
+			i++
+			result.WriteByte(word[i])
+		default:
+			result.WriteByte(ch)
+		}
+	}
+	return result.String()
+}
+
+// replaceArgVars replaces ARG variables in a string using fully resolved replacements.
+// References to undefined variables are kept as they are, unless a modifier
+// like ${VAR:-default} provides a value for them.
+func replaceArgVars(baseImage string, resolvedReplacements []ArgReplacement) string {
+	var result strings.Builder
+	for i := 0; i < len(baseImage); {
+		switch {
+		case baseImage[i] == parser.DefaultEscapeToken && i+1 < len(baseImage):
+			// Escaped characters are never expanded
+			result.WriteString(baseImage[i : i+2])
+			i += 2
+		case baseImage[i] == '$':
+			reference := varReference(baseImage[i:])
+			if reference == "" {
+				result.WriteByte('$')
+				i++
+				continue
+			}
+			result.WriteString(expandVarReference(reference, resolvedReplacements))
+			i += len(reference)
+		default:
+			result.WriteByte(baseImage[i])
+			i++
+		}
+	}
+	return result.String()
+}
+
+// varReference returns the $VAR or ${...} reference at the start of s,
+// or an empty string if s does not start with a variable reference.
+func varReference(s string) string {
+	if !strings.HasPrefix(s, "${") {
+		if name := varNameRegex.FindString(s[1:]); name != "" {
+			return "$" + name
+		}
+		return ""
+	}
+
+	// Find the matching closing brace, which may follow nested references
+	depth := 0
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return s[:i+1]
+			}
+		}
+	}
+	return ""
+}
+
+// expandVarReference expands a single $VAR or ${...} reference.
+func expandVarReference(reference string, resolvedReplacements []ArgReplacement) string {
+	name := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(reference, "$"), "{"), "}")
+	if varNameRegex.FindString(name) == name {
+		// Plain $VAR or ${VAR}, keep it if the variable is undefined
+		if value, ok := argEnv(resolvedReplacements).Get(name); ok {
+			return value
+		}
+		return reference
+	}
+
+	// ${VAR} with a modifier, which the shell lexer knows how to handle
+	result, _, err := shell.NewLex(parser.DefaultEscapeToken).ProcessWord(reference, argEnv(resolvedReplacements))
+	if err != nil {
+		return reference
+	}
+	return result
+}
@@ -0,0 +1,1686 @@
+package dockerfilegraph
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestScratchModeFromString(t *testing.T) {
+	tests := []struct {
+		input string
+		want  ScratchMode
+	}{
+		{"collapsed", ScratchCollapsed},
+		{"separated", ScratchSeparated},
+		{"hidden", ScratchHidden},
+		{"", ScratchCollapsed},
+		{"invalid", ScratchCollapsed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := ScratchModeFromString(tt.input); got != tt.want {
+				t.Errorf("ScratchModeFromString(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findStageIndex(t *testing.T) {
+	stages := []Stage{
+		{Name: "base"},
+		{Name: ""},
+		{Name: "final"},
+	}
+	tests := []struct {
+		nameOrID  string
+		wantIndex int
+		wantFound bool
+	}{
+		{"base", 0, true},
+		{"final", 2, true},
+		{"0", 0, true},
+		{"2", 2, true},
+		{"1", 1, true},
+		{"3", 3, false},   // out of range
+		{"-1", -1, false}, // negative
+		{"unknown", -1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nameOrID, func(t *testing.T) {
+			gotIndex, gotFound := findStageIndex(stages, tt.nameOrID)
+			if gotFound != tt.wantFound || gotIndex != tt.wantIndex {
+				t.Errorf("findStageIndex(%q) = (%d, %v), want (%d, %v)",
+					tt.nameOrID, gotIndex, gotFound, tt.wantIndex, tt.wantFound)
+			}
+		})
+	}
+}
+
+func Test_dockerfileToSimplifiedDockerfile(t *testing.T) {
+	type args struct {
+		buildArgs      map[string]string
+		content        []byte
+		maxLabelLength int
+		scratchMode    ScratchMode
+		separateImages []string
+	}
+	tests := []struct {
+		name string
+		args args
+		want SimplifiedDockerfile
+	}{
+		{
+			name: "Most minimal Dockerfile",
+			args: args{
+				content:        []byte("FROM scratch"),
+				maxLabelLength: 20,
+				scratchMode:    ScratchCollapsed,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "scratch", Name: "scratch"},
+				},
+				Stages: []Stage{
+					{
+						Layers: []Layer{
+							{
+								Label:    "FROM scratch",
+								WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "All waitFor types",
+			args: args{
+				content: []byte(`
+# syntax=docker/dockerfile:1
+FROM ubuntu as base
+FROM scratch
+COPY --from=base . .
+RUN --mount=type=cache,from=buildcache,source=/go/pkg/mod/cache/,target=/go/pkg/mod/cache/ go build
+`),
+				maxLabelLength: 20,
+				scratchMode:    ScratchCollapsed,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "ubuntu", Name: "ubuntu"},
+					{ID: "scratch", Name: "scratch"},
+					{ID: "buildcache", Name: "buildcache"},
+				},
+				Stages: []Stage{
+					{
+						Name: "base",
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu as base",
+								WaitFors: []WaitFor{{ID: "ubuntu", Type: WaitForFrom}},
+							},
+						},
+					},
+					{
+						Layers: []Layer{
+							{
+								Label:    "FROM scratch",
+								WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}},
+							},
+							{
+								Label:    "COPY --from=base . .",
+								WaitFors: []WaitFor{{ID: "base", Type: WaitForCopy}},
+							},
+							{
+								Label:    "RUN --mount=type=...",
+								WaitFors: []WaitFor{{ID: "buildcache", Type: WaitForMount}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Wait for multiple mounts",
+			args: args{
+				content: []byte(`
+# syntax=docker/dockerfile:1
+FROM ubuntu as base
+RUN \
+  --mount=type=cache,from=buildcache,source=/go/pkg/mod/cache/,target=/go/pkg/mod/cache/ \
+  --mount=from=artifacts,source=/artifacts/embeddata,target=/artifacts/embeddata go build
+`),
+				maxLabelLength: 20,
+				scratchMode:    ScratchCollapsed,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "ubuntu", Name: "ubuntu"},
+					{ID: "buildcache", Name: "buildcache"},
+					{ID: "artifacts", Name: "artifacts"},
+				},
+				Stages: []Stage{
+					{
+						Name: "base",
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu as base",
+								WaitFors: []WaitFor{{ID: "ubuntu", Type: WaitForFrom}},
+							},
+							{
+								Label: "RUN --mount=type=...",
+								WaitFors: []WaitFor{
+									{ID: "buildcache", Type: WaitForMount},
+									{ID: "artifacts", Type: WaitForMount},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "bind mount",
+			args: args{
+				content: []byte(`
+# syntax=docker/dockerfile:1
+FROM scratch
+RUN --mount=from=build,source=/build/,target=/build/ go build
+`),
+				maxLabelLength: 20,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "scratch", Name: "scratch"},
+					{ID: "build", Name: "build"},
+				},
+				Stages: []Stage{
+					{
+						Layers: []Layer{
+							{
+								Label:    "FROM scratch",
+								WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}},
+							},
+							{
+								Label:    "RUN --mount=from=...",
+								WaitFors: []WaitFor{{ID: "build", Type: WaitForMount}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "ARGs before FROM",
+			args: args{
+				content: []byte(`
+# syntax=docker/dockerfile:1
+ARG UBUNTU_VERSION=22.04
+ARG PHP_VERSION=8.0
+ARG ALPINE_VERSION=3.15
+
+FROM ubuntu:$UBUNTU_VERSION as base
+USER app
+
+FROM php:${PHP_VERSION}-fpm-alpine${ALPINE_VERSION} as php
+
+FROM scratch
+COPY --from=base . .
+RUN --mount=type=cache,source=/go/pkg/mod/cache/,target=/go/pkg/mod/cache/,from=buildcache go build
+`),
+				maxLabelLength: 20,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "ubuntu:22.04", Name: "ubuntu:22.04"},
+					{ID: "php:8.0-fpm-alpine3.15", Name: "php:8.0-fpm-alpine3.15"},
+					{ID: "scratch", Name: "scratch"},
+					{ID: "buildcache", Name: "buildcache"},
+				},
+				Stages: []Stage{
+					{
+						Name: "base",
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu:22.04...",
+								WaitFors: []WaitFor{{ID: "ubuntu:22.04", Type: WaitForFrom}},
+							},
+							{
+								Label: "USER app",
+							},
+						},
+					},
+					{
+						Name: "php",
+						Layers: []Layer{
+							{
+								Label: "FROM php:8.0-fpm-...",
+								WaitFors: []WaitFor{{
+									ID:   "php:8.0-fpm-alpine3.15",
+									Type: WaitForFrom,
+								}},
+							},
+						},
+					},
+					{
+						Layers: []Layer{
+							{
+								Label:    "FROM scratch",
+								WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}},
+							},
+							{
+								Label:    "COPY --from=base . .",
+								WaitFors: []WaitFor{{ID: "base", Type: WaitForCopy}},
+							},
+							{
+								Label:    "RUN --mount=type=...",
+								WaitFors: []WaitFor{{ID: "buildcache", Type: WaitForMount}},
+							},
+						},
+					},
+				},
+				BeforeFirstStage: []Layer{
+					{Label: "ARG UBUNTU_VERSIO..."},
+					{Label: "ARG PHP_VERSION=8.0"},
+					{Label: "ARG ALPINE_VERSIO..."},
+				},
+			},
+		},
+		{
+			name: "Build args override ARG defaults",
+			args: args{
+				buildArgs: map[string]string{
+					"GO_VERSION": "1.22",
+					"BASE_IMAGE": "alpine:3.20",
+					"UNDECLARED": "ignored",
+				},
+				content: []byte(`
+ARG GO_VERSION=1.20
+ARG BASE_IMAGE
+ARG DEBIAN=bookworm
+FROM golang:${GO_VERSION}-${DEBIAN} AS build
+FROM ${BASE_IMAGE}$UNDECLARED
+`),
+				maxLabelLength: 40,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "golang:1.22-bookworm", Name: "golang:1.22-bookworm"},
+					{ID: "alpine:3.20$UNDECLARED", Name: "alpine:3.20$UNDECLARED"},
+				},
+				Stages: []Stage{
+					{
+						Name: "build",
+						Layers: []Layer{{
+							Label:    "FROM golang:1.22-bookworm AS build",
+							WaitFors: []WaitFor{{ID: "golang:1.22-bookworm", Type: WaitForFrom}},
+						}},
+					},
+					{
+						Layers: []Layer{{
+							Label:    "FROM alpine:3.20$UNDECLARED",
+							WaitFors: []WaitFor{{ID: "alpine:3.20$UNDECLARED", Type: WaitForFrom}},
+						}},
+					},
+				},
+				BeforeFirstStage: []Layer{
+					{Label: "ARG GO_VERSION=1.20"},
+					{Label: "ARG BASE_IMAGE"},
+					{Label: "ARG DEBIAN=bookworm"},
+				},
+			},
+		},
+		{
+			name: "Build arg switches the base between internal stages",
+			args: args{
+				buildArgs: map[string]string{"VARIANT": "b"},
+				content: []byte(`
+ARG VARIANT=a
+FROM alpine AS base-a
+FROM debian AS base-b
+FROM base-${VARIANT}
+`),
+				maxLabelLength: 30,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "alpine", Name: "alpine"},
+					{ID: "debian", Name: "debian"},
+				},
+				Stages: []Stage{
+					{
+						Name: "base-a",
+						Layers: []Layer{{
+							Label:    "FROM alpine AS base-a",
+							WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}},
+						}},
+					},
+					{
+						Name: "base-b",
+						Layers: []Layer{{
+							Label:    "FROM debian AS base-b",
+							WaitFors: []WaitFor{{ID: "debian", Type: WaitForFrom}},
+						}},
+					},
+					{
+						Layers: []Layer{{
+							Label:    "FROM base-b",
+							WaitFors: []WaitFor{{ID: "base-b", Type: WaitForFrom}},
+						}},
+					},
+				},
+				BeforeFirstStage: []Layer{
+					{Label: "ARG VARIANT=a"},
+				},
+			},
+		},
+		{
+			name: "Stage-scoped ARG and ENV substitution",
+			args: args{
+				content: []byte(`
+ARG BUILDER_STAGE=builder
+ARG VERSION=1.0
+FROM golang AS builder
+FROM alpine AS base
+ENV APP_DIR=/app
+FROM base AS final
+ARG BUILDER_STAGE
+ARG VERSION
+ARG LOCAL=$APP_DIR/bin
+COPY --from=${BUILDER_STAGE} $LOCAL /usr/bin
+RUN --mount=from=$BUILDER_STAGE,target=/src echo $VERSION
+FROM alpine AS other
+COPY --from=$BUILDER_STAGE . .
+RUN echo $APP_DIR $VERSION
+`),
+				maxLabelLength: 60,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "golang", Name: "golang"},
+					{ID: "alpine", Name: "alpine"},
+					{ID: "$BUILDER_STAGE", Name: "$BUILDER_STAGE"},
+				},
+				Stages: []Stage{
+					{
+						Name: "builder",
+						Layers: []Layer{{
+							Label:    "FROM golang AS builder",
+							WaitFors: []WaitFor{{ID: "golang", Type: WaitForFrom}},
+						}},
+					},
+					{
+						Name: "base",
+						Layers: []Layer{
+							{
+								Label:    "FROM alpine AS base",
+								WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}},
+							},
+							{Label: "ENV APP_DIR=/app"},
+						},
+					},
+					{
+						Name: "final",
+						Layers: []Layer{
+							{
+								Label:    "FROM base AS final",
+								WaitFors: []WaitFor{{ID: "base", Type: WaitForFrom}},
+							},
+							{Label: "ARG BUILDER_STAGE"},
+							{Label: "ARG VERSION"},
+							{Label: "ARG LOCAL=/app/bin"},
+							{
+								Label:    "COPY --from=builder /app/bin /usr/bin",
+								WaitFors: []WaitFor{{ID: "builder", Type: WaitForCopy}},
+							},
+							{
+								Label:    "RUN --mount=from=builder,target=/src echo 1.0",
+								WaitFors: []WaitFor{{ID: "builder", Type: WaitForMount}},
+							},
+						},
+					},
+					{
+						Name: "other",
+						Layers: []Layer{
+							{
+								Label:    "FROM alpine AS other",
+								WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}},
+							},
+							{
+								Label:    "COPY --from=$BUILDER_STAGE . .",
+								WaitFors: []WaitFor{{ID: "$BUILDER_STAGE", Type: WaitForCopy}},
+							},
+							{Label: "RUN echo $APP_DIR $VERSION"},
+						},
+					},
+				},
+				BeforeFirstStage: []Layer{
+					{Label: "ARG BUILDER_STAGE=builder"},
+					{Label: "ARG VERSION=1.0"},
+				},
+			},
+		},
+		{
+			name: "Shell-style parameter expansion",
+			args: args{
+				content: []byte(`
+ARG REGISTRY
+ARG NODE=20.1.0
+ARG SUFFIX=-alpine
+FROM ${REGISTRY:-docker.io}/library/node:${NODE%.*}${SUFFIX} AS build
+FROM ${UNDEFINED:+foo}alpine:${NODE#20.}
+ARG VERSION="${NODE:-none}"
+COPY --from=${BASE:-build} / /
+RUN echo $VERSION $HOME \$VERSION
+`),
+				maxLabelLength: 60,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "docker.io/library/node:20.1-alpine", Name: "docker.io/library/node:20.1-alpine"},
+					{ID: "alpine:1.0", Name: "alpine:1.0"},
+				},
+				Stages: []Stage{
+					{
+						Name: "build",
+						Layers: []Layer{{
+							Label: "FROM docker.io/library/node:20.1-alpine AS build",
+							WaitFors: []WaitFor{{
+								ID:   "docker.io/library/node:20.1-alpine",
+								Type: WaitForFrom,
+							}},
+						}},
+					},
+					{
+						Layers: []Layer{
+							{
+								Label:    "FROM alpine:1.0",
+								WaitFors: []WaitFor{{ID: "alpine:1.0", Type: WaitForFrom}},
+							},
+							{Label: "ARG VERSION='none'"},
+							{
+								Label:    "COPY --from=build / /",
+								WaitFors: []WaitFor{{ID: "build", Type: WaitForCopy}},
+							},
+							{Label: "RUN echo none $HOME \\$VERSION"},
+						},
+					},
+				},
+				BeforeFirstStage: []Layer{
+					{Label: "ARG REGISTRY"},
+					{Label: "ARG NODE=20.1.0"},
+					{Label: "ARG SUFFIX=-alpine"},
+				},
+			},
+		},
+		{
+			name: "ENV takes precedence over ARG",
+			args: args{
+				buildArgs: map[string]string{"SOURCE": "build-arg"},
+				content: []byte(`
+FROM alpine AS source
+FROM alpine
+ARG SOURCE=arg
+ENV SOURCE=source
+ARG SOURCE
+COPY --from=$SOURCE . .
+`),
+				maxLabelLength: 60,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "alpine", Name: "alpine"},
+				},
+				Stages: []Stage{
+					{
+						Name: "source",
+						Layers: []Layer{{
+							Label:    "FROM alpine AS source",
+							WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}},
+						}},
+					},
+					{
+						Layers: []Layer{
+							{
+								Label:    "FROM alpine",
+								WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}},
+							},
+							{Label: "ARG SOURCE=arg"},
+							{Label: "ENV SOURCE=source"},
+							{Label: "ARG SOURCE"},
+							{
+								Label:    "COPY --from=source . .",
+								WaitFors: []WaitFor{{ID: "source", Type: WaitForCopy}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "External image used in multiple stages",
+			args: args{
+				content: []byte(`
+# syntax=docker/dockerfile:1.4
+
+FROM scratch AS download-node-setup
+ADD https://deb.nodesource.com/setup_16.x ./
+
+FROM scratch AS download-get-pip
+ADD https://bootstrap.pypa.io/get-pip.py ./
+
+FROM alpine AS final
+COPY --from=download-node-setup setup_16.x ./
+COPY --from=download-get-pip get-pip.py ./
+`),
+				maxLabelLength: 20,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "scratch", Name: "scratch"},
+					{
+						ID:   "https://deb.nodesource.com/setup_16.x",
+						Name: "https://deb.nodesource.com/setup_16.x",
+						Type: ExternalImageURL,
+					},
+					{
+						ID:   "https://bootstrap.pypa.io/get-pip.py",
+						Name: "https://bootstrap.pypa.io/get-pip.py",
+						Type: ExternalImageURL,
+					},
+					{ID: "alpine", Name: "alpine"},
+				},
+				Stages: []Stage{
+					{
+						Name: "download-node-setup",
+						Layers: []Layer{
+							{
+								Label: "FROM scratch AS d...",
+								WaitFors: []WaitFor{{
+									ID:   "scratch",
+									Type: WaitForFrom,
+								}},
+							},
+							{
+								Label: "ADD https://deb.n...",
+								WaitFors: []WaitFor{{
+									ID:   "https://deb.nodesource.com/setup_16.x",
+									Type: WaitForAdd,
+								}},
+							},
+						},
+					},
+					{
+						Name: "download-get-pip",
+						Layers: []Layer{
+							{
+								Label: "FROM scratch AS d...",
+								WaitFors: []WaitFor{{
+									ID:   "scratch",
+									Type: WaitForFrom,
+								}},
+							},
+							{
+								Label: "ADD https://boots...",
+								WaitFors: []WaitFor{{
+									ID:   "https://bootstrap.pypa.io/get-pip.py",
+									Type: WaitForAdd,
+								}},
+							},
+						},
+					},
+					{
+						Name: "final",
+						Layers: []Layer{
+							{
+								Label: "FROM alpine AS final",
+								WaitFors: []WaitFor{{
+									ID:   "alpine",
+									Type: WaitForFrom,
+								}},
+							},
+							{
+								Label: "COPY --from=downl...",
+								WaitFors: []WaitFor{{
+									ID:   "download-node-setup",
+									Type: WaitForCopy,
+								}},
+							},
+							{
+								Label: "COPY --from=downl...",
+								WaitFors: []WaitFor{{
+									ID:   "download-get-pip",
+									Type: WaitForCopy,
+								}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Redeclared ARGs and ENVs use the last value",
+			args: args{
+				content: []byte(`
+ARG BASE=alpine
+ARG BASE=ubuntu
+FROM ${BASE}
+ARG VERSION=1.0
+ARG VERSION=2.0
+ENV DIR=/src
+ENV DIR=/app
+RUN echo $VERSION $DIR
+`),
+				maxLabelLength: 60,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "ubuntu", Name: "ubuntu"},
+				},
+				Stages: []Stage{
+					{
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu",
+								WaitFors: []WaitFor{{ID: "ubuntu", Type: WaitForFrom}},
+							},
+							{Label: "ARG VERSION=1.0"},
+							{Label: "ARG VERSION=2.0"},
+							{Label: "ENV DIR=/src"},
+							{Label: "ENV DIR=/app"},
+							{Label: "RUN echo 2.0 /app"},
+						},
+					},
+				},
+				BeforeFirstStage: []Layer{
+					{Label: "ARG BASE=alpine"},
+					{Label: "ARG BASE=ubuntu"},
+				},
+			},
+		},
+		{
+			name: "Parameter expansion of redeclared ARGs and ENVs",
+			args: args{
+				content: []byte(`
+ARG BASE=alpine
+ARG BASE=ubuntu
+FROM ${BASE:-x}:${BASE:+latest}
+ARG VERSION=1.0
+ARG VERSION=2.0
+ENV DIR=/src
+ENV DIR=/app
+RUN echo ${VERSION:-none} ${DIR:+set}${DIR:-/}
+`),
+				maxLabelLength: 60,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "ubuntu:latest", Name: "ubuntu:latest"},
+				},
+				Stages: []Stage{
+					{
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu:latest",
+								WaitFors: []WaitFor{{ID: "ubuntu:latest", Type: WaitForFrom}},
+							},
+							{Label: "ARG VERSION=1.0"},
+							{Label: "ARG VERSION=2.0"},
+							{Label: "ENV DIR=/src"},
+							{Label: "ENV DIR=/app"},
+							{Label: "RUN echo 2.0 set/app"},
+						},
+					},
+				},
+				BeforeFirstStage: []Layer{
+					{Label: "ARG BASE=alpine"},
+					{Label: "ARG BASE=ubuntu"},
+				},
+			},
+		},
+		{
+			name: "Nested ARG variable substitution",
+			args: args{
+				content: []byte(`
+ARG WORLD=world
+ARG IMAGE1=hello-${WORLD}-1
+ARG IMAGE2=hello-${WORLD}-2
+
+FROM ${IMAGE1}:latest AS stage1
+RUN echo "Stage 1"
+
+FROM ${IMAGE2}:latest AS stage2
+RUN echo "Stage 2"
+`),
+				maxLabelLength: 20,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "hello-world-1:latest", Name: "hello-world-1:latest"},
+					{ID: "hello-world-2:latest", Name: "hello-world-2:latest"},
+				},
+				Stages: []Stage{
+					{
+						Name: "stage1",
+						Layers: []Layer{
+							{
+								Label: "FROM hello-world-...",
+								WaitFors: []WaitFor{{
+									ID:   "hello-world-1:latest",
+									Type: WaitForFrom,
+								}},
+							},
+							{Label: "RUN echo 'Stage 1'"},
+						},
+					},
+					{
+						Name: "stage2",
+						Layers: []Layer{
+							{
+								Label: "FROM hello-world-...",
+								WaitFors: []WaitFor{{
+									ID:   "hello-world-2:latest",
+									Type: WaitForFrom,
+								}},
+							},
+							{Label: "RUN echo 'Stage 2'"},
+						},
+					},
+				},
+				BeforeFirstStage: []Layer{
+					{Label: "ARG WORLD=world"},
+					{Label: "ARG IMAGE1=hello-..."},
+					{Label: "ARG IMAGE2=hello-..."},
+				},
+			},
+		},
+		{
+			// This test verifies that an ARG referenced before its definition resolves to an empty string.
+			// This aligns with the Docker specification's behavior for ARG variable substitution,
+			// where only previously defined ARGs are considered for replacement.
+			name: "ARG referencing later ARG (should not resolve)",
+			args: args{
+				content: []byte(`
+ARG IMAGE1=$IMAGE2
+ARG IMAGE2=scratch
+FROM $IMAGE1
+FROM $IMAGE2
+`),
+				maxLabelLength: 20,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "", Name: ""},
+					{ID: "scratch", Name: "scratch"},
+				},
+				Stages: []Stage{
+					{
+						Layers: []Layer{{
+							Label:    "FROM",
+							WaitFors: []WaitFor{{ID: "", Type: WaitForFrom}},
+						}},
+					},
+					{
+						Layers: []Layer{{
+							Label:    "FROM scratch",
+							WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}},
+						}},
+					},
+				},
+				BeforeFirstStage: []Layer{
+					{Label: "ARG IMAGE1=$IMAGE2"},
+					{Label: "ARG IMAGE2=scratch"},
+				},
+			},
+		},
+		{
+			name: "Scratch mode separated - multiple scratch images",
+			args: args{
+				content: []byte(`
+FROM scratch AS app1
+COPY app1.txt /app1.txt
+
+FROM scratch AS app2
+COPY app2.txt /app2.txt
+`),
+				maxLabelLength: 20,
+				scratchMode:    ScratchSeparated,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "scratch-0", Name: "scratch"},
+					{ID: "scratch-1", Name: "scratch"},
+				},
+				Stages: []Stage{
+					{
+						Name: "app1",
+						Layers: []Layer{
+							{
+								Label:    "FROM scratch AS app1",
+								WaitFors: []WaitFor{{ID: "scratch-0", Type: WaitForFrom}},
+							},
+							{Label: "COPY app1.txt /ap..."},
+						},
+					},
+					{
+						Name: "app2",
+						Layers: []Layer{
+							{
+								Label:    "FROM scratch AS app2",
+								WaitFors: []WaitFor{{ID: "scratch-1", Type: WaitForFrom}},
+							},
+							{Label: "COPY app2.txt /ap..."},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Scratch mode separated - single scratch image",
+			args: args{
+				content: []byte(`FROM scratch AS app
+COPY app.txt /app.txt`),
+				maxLabelLength: 20,
+				scratchMode:    ScratchSeparated,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "scratch-0", Name: "scratch"},
+				},
+				Stages: []Stage{
+					{
+						Name: "app",
+						Layers: []Layer{
+							{
+								Label:    "FROM scratch AS app",
+								WaitFors: []WaitFor{{ID: "scratch-0", Type: WaitForFrom}},
+							},
+							{Label: "COPY app.txt /app..."},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Scratch mode separated - no scratch images",
+			args: args{
+				content: []byte(`FROM ubuntu AS base
+COPY app.txt /app.txt
+
+FROM alpine AS final
+COPY --from=base /app.txt /final.txt`),
+				maxLabelLength: 20,
+				scratchMode:    ScratchSeparated,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "ubuntu", Name: "ubuntu"},
+					{ID: "alpine", Name: "alpine"},
+				},
+				Stages: []Stage{
+					{
+						Name: "base",
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu AS base",
+								WaitFors: []WaitFor{{ID: "ubuntu", Type: WaitForFrom}},
+							},
+							{Label: "COPY app.txt /app..."},
+						},
+					},
+					{
+						Name: "final",
+						Layers: []Layer{
+							{
+								Label:    "FROM alpine AS final",
+								WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}},
+							},
+							{
+								Label:    "COPY --from=base ...",
+								WaitFors: []WaitFor{{ID: "base", Type: WaitForCopy}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Scratch mode collapsed - multiple scratch images",
+			args: args{
+				content: []byte(`FROM scratch AS app1
+COPY app1.txt /app1.txt
+
+FROM scratch AS app2
+COPY app2.txt /app2.txt`),
+				maxLabelLength: 20,
+				scratchMode:    ScratchCollapsed,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "scratch", Name: "scratch"},
+				},
+				Stages: []Stage{
+					{
+						Name: "app1",
+						Layers: []Layer{
+							{
+								Label:    "FROM scratch AS app1",
+								WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}},
+							},
+							{Label: "COPY app1.txt /ap..."},
+						},
+					},
+					{
+						Name: "app2",
+						Layers: []Layer{
+							{
+								Label:    "FROM scratch AS app2",
+								WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}},
+							},
+							{Label: "COPY app2.txt /ap..."},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Scratch mode hidden - multiple scratch images",
+			args: args{
+				content: []byte(`FROM scratch AS app1
+COPY app1.txt /app1.txt
+
+FROM scratch AS app2
+COPY app2.txt /app2.txt`),
+				maxLabelLength: 20,
+				scratchMode:    ScratchHidden,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: nil,
+				Stages: []Stage{
+					{
+						Name: "app1",
+						Layers: []Layer{
+							{
+								Label:    "FROM scratch AS app1",
+								WaitFors: nil,
+							},
+							{Label: "COPY app1.txt /ap..."},
+						},
+					},
+					{
+						Name: "app2",
+						Layers: []Layer{
+							{
+								Label:    "FROM scratch AS app2",
+								WaitFors: nil,
+							},
+							{Label: "COPY app2.txt /ap..."},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Separate flag - single image used in multiple stages",
+			args: args{
+				content: []byte(`FROM ubuntu AS base
+RUN echo base
+
+FROM ubuntu AS other
+RUN echo other
+
+FROM alpine AS final
+COPY --from=base . .`),
+				maxLabelLength: 20,
+				scratchMode:    ScratchCollapsed,
+				separateImages: []string{"ubuntu"},
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "ubuntu-0", Name: "ubuntu"},
+					{ID: "ubuntu-1", Name: "ubuntu"},
+					{ID: "alpine", Name: "alpine"},
+				},
+				Stages: []Stage{
+					{
+						Name: "base",
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu AS base",
+								WaitFors: []WaitFor{{ID: "ubuntu-0", Type: WaitForFrom}},
+							},
+							{Label: "RUN echo base"},
+						},
+					},
+					{
+						Name: "other",
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu AS other",
+								WaitFors: []WaitFor{{ID: "ubuntu-1", Type: WaitForFrom}},
+							},
+							{Label: "RUN echo other"},
+						},
+					},
+					{
+						Name: "final",
+						Layers: []Layer{
+							{
+								Label:    "FROM alpine AS final",
+								WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}},
+							},
+							{
+								Label:    "COPY --from=base . .",
+								WaitFors: []WaitFor{{ID: "base", Type: WaitForCopy}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Separate flag - image not in Dockerfile is a no-op",
+			args: args{
+				content: []byte(`FROM ubuntu AS base
+RUN echo base
+
+FROM ubuntu AS other
+RUN echo other`),
+				maxLabelLength: 20,
+				scratchMode:    ScratchCollapsed,
+				separateImages: []string{"nonexistent"},
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "ubuntu", Name: "ubuntu"},
+				},
+				Stages: []Stage{
+					{
+						Name: "base",
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu AS base",
+								WaitFors: []WaitFor{{ID: "ubuntu", Type: WaitForFrom}},
+							},
+							{Label: "RUN echo base"},
+						},
+					},
+					{
+						Name: "other",
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu AS other",
+								WaitFors: []WaitFor{{ID: "ubuntu", Type: WaitForFrom}},
+							},
+							{Label: "RUN echo other"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Separate flag - whitespace in image names is normalized",
+			args: args{
+				content: []byte(`FROM ubuntu AS base
+RUN echo base
+
+FROM ubuntu AS other
+RUN echo other`),
+				maxLabelLength: 20,
+				scratchMode:    ScratchCollapsed,
+				separateImages: []string{"ubuntu", " ubuntu", "ubuntu "},
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "ubuntu-0", Name: "ubuntu"},
+					{ID: "ubuntu-1", Name: "ubuntu"},
+				},
+				Stages: []Stage{
+					{
+						Name: "base",
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu AS base",
+								WaitFors: []WaitFor{{ID: "ubuntu-0", Type: WaitForFrom}},
+							},
+							{Label: "RUN echo base"},
+						},
+					},
+					{
+						Name: "other",
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu AS other",
+								WaitFors: []WaitFor{{ID: "ubuntu-1", Type: WaitForFrom}},
+							},
+							{Label: "RUN echo other"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Numeric stage reference is not treated as an external image",
+			args: args{
+				content: []byte(`FROM ubuntu AS base
+RUN echo base
+
+FROM alpine
+COPY --from=0 /app /app`),
+				maxLabelLength: 20,
+				scratchMode:    ScratchCollapsed,
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "ubuntu", Name: "ubuntu"},
+					{ID: "alpine", Name: "alpine"},
+				},
+				Stages: []Stage{
+					{
+						Name: "base",
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu AS base",
+								WaitFors: []WaitFor{{ID: "ubuntu", Type: WaitForFrom}},
+							},
+							{Label: "RUN echo base"},
+						},
+					},
+					{
+						Layers: []Layer{
+							{
+								Label:    "FROM alpine",
+								WaitFors: []WaitFor{{ID: "alpine", Type: WaitForFrom}},
+							},
+							{
+								Label:    "COPY --from=0 /ap...",
+								WaitFors: []WaitFor{{ID: "0", Type: WaitForCopy}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Separate flag combined with scratch separated",
+			args: args{
+				content: []byte(`FROM scratch AS app1
+COPY app1.txt /app1.txt
+
+FROM ubuntu AS base
+RUN echo base
+
+FROM scratch AS app2
+COPY app2.txt /app2.txt
+
+FROM ubuntu AS other
+RUN echo other`),
+				maxLabelLength: 20,
+				scratchMode:    ScratchSeparated,
+				separateImages: []string{"ubuntu"},
+			},
+			want: SimplifiedDockerfile{
+				ExternalImages: []ExternalImage{
+					{ID: "scratch-0", Name: "scratch"},
+					{ID: "ubuntu-0", Name: "ubuntu"},
+					{ID: "scratch-1", Name: "scratch"},
+					{ID: "ubuntu-1", Name: "ubuntu"},
+				},
+				Stages: []Stage{
+					{
+						Name: "app1",
+						Layers: []Layer{
+							{
+								Label:    "FROM scratch AS app1",
+								WaitFors: []WaitFor{{ID: "scratch-0", Type: WaitForFrom}},
+							},
+							{Label: "COPY app1.txt /ap..."},
+						},
+					},
+					{
+						Name: "base",
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu AS base",
+								WaitFors: []WaitFor{{ID: "ubuntu-0", Type: WaitForFrom}},
+							},
+							{Label: "RUN echo base"},
+						},
+					},
+					{
+						Name: "app2",
+						Layers: []Layer{
+							{
+								Label:    "FROM scratch AS app2",
+								WaitFors: []WaitFor{{ID: "scratch-1", Type: WaitForFrom}},
+							},
+							{Label: "COPY app2.txt /ap..."},
+						},
+					},
+					{
+						Name: "other",
+						Layers: []Layer{
+							{
+								Label:    "FROM ubuntu AS other",
+								WaitFors: []WaitFor{{ID: "ubuntu-1", Type: WaitForFrom}},
+							},
+							{Label: "RUN echo other"},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dockerfileToSimplifiedDockerfile(
+				tt.args.content,
+				ParseOptions{
+					BuildArgs:      tt.args.buildArgs,
+					MaxLabelLength: tt.args.maxLabelLength,
+					ScratchMode:    tt.args.scratchMode,
+					SeparateImages: tt.args.separateImages,
+				},
+			)
+			if err != nil {
+				t.Errorf("dockerfileToSimplifiedDockerfile() error = %v", err)
+				return
+			}
+			// Source ranges, mount and copy options and image references are
+			// tested separately, see below.
+			if diff := cmp.Diff(
+				tt.want, got,
+				cmpopts.IgnoreFields(Stage{}, "Source"),
+				cmpopts.IgnoreFields(Layer{}, "Source"),
+				cmpopts.IgnoreFields(WaitFor{}, "Mount", "Copy"),
+				cmpopts.IgnoreFields(ExternalImage{}, "Registry", "Repository", "Tag", "Digest"),
+			); diff != "" {
+				t.Errorf("Output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_dockerfileToSimplifiedDockerfileSourceRanges(t *testing.T) {
+	content := []byte(`# syntax=docker/dockerfile:1
+ARG VERSION=1
+
+FROM golang:${VERSION} AS build
+RUN go build \
+    -o /app \
+    ./...
+
+FROM scratch
+COPY --from=build /app /app
+`)
+
+	got, err := dockerfileToSimplifiedDockerfile(content, ParseOptions{MaxLabelLength: 20})
+	if err != nil {
+		t.Fatalf("dockerfileToSimplifiedDockerfile() error = %v", err)
+	}
+
+	wantBeforeFirstStage := []SourceRange{{StartLine: 2, EndLine: 2}}
+	wantStages := []SourceRange{{StartLine: 4, EndLine: 7}, {StartLine: 9, EndLine: 10}}
+	wantLayers := [][]SourceRange{
+		{{StartLine: 4, EndLine: 4}, {StartLine: 5, EndLine: 7}},
+		{{StartLine: 9, EndLine: 9}, {StartLine: 10, EndLine: 10}},
+	}
+
+	gotBeforeFirstStage := []SourceRange{}
+	for _, layer := range got.BeforeFirstStage {
+		gotBeforeFirstStage = append(gotBeforeFirstStage, layer.Source)
+	}
+	gotStages := []SourceRange{}
+	gotLayers := [][]SourceRange{}
+	for _, stage := range got.Stages {
+		gotStages = append(gotStages, stage.Source)
+		layers := []SourceRange{}
+		for _, layer := range stage.Layers {
+			layers = append(layers, layer.Source)
+		}
+		gotLayers = append(gotLayers, layers)
+	}
+
+	if diff := cmp.Diff(wantBeforeFirstStage, gotBeforeFirstStage); diff != "" {
+		t.Errorf("BeforeFirstStage source mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantStages, gotStages); diff != "" {
+		t.Errorf("Stage source mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantLayers, gotLayers); diff != "" {
+		t.Errorf("Layer source mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_dockerfileToSimplifiedDockerfileContexts(t *testing.T) {
+	content := []byte(`FROM golang AS base
+FROM base AS build
+COPY --from=src / /
+COPY --from=repo / /
+FROM alpine
+COPY --from=build / /
+`)
+	got, err := dockerfileToSimplifiedDockerfile(content, ParseOptions{
+		MaxLabelLength: 20,
+		Contexts: map[string]string{
+			"alpine": "docker-image://alpine:3.20",
+			"base":   "target:base",
+			"repo":   "https://github.com/org/repo.git",
+			"src":    "./src",
+		},
+	})
+	if err != nil {
+		t.Fatalf("dockerfileToSimplifiedDockerfile() error = %v", err)
+	}
+
+	wantExternalImages := []ExternalImage{
+		{ID: "golang", Name: "golang"},
+		{ID: "context:base", Name: "target:base"},
+		{ID: "src", Name: "./src", Type: ExternalImageDirectory},
+		{ID: "repo", Name: "https://github.com/org/repo.git", Type: ExternalImageGit},
+		{ID: "alpine", Name: "alpine:3.20"},
+	}
+	if diff := cmp.Diff(
+		wantExternalImages, got.ExternalImages,
+		cmpopts.IgnoreFields(ExternalImage{}, "Registry", "Repository", "Tag", "Digest"),
+	); diff != "" {
+		t.Errorf("ExternalImages mismatch (-want +got):\n%s", diff)
+	}
+	if gotID := got.Stages[1].Layers[0].WaitFors[0].ID; gotID != "context:base" {
+		t.Errorf("the stage replaced by a build context waits for %q, want %q", gotID, "context:base")
+	}
+}
+
+func Test_dockerfileToSimplifiedDockerfileShowContext(t *testing.T) {
+	content := []byte(`FROM golang AS build
+ARG SRC=cmd
+COPY go.mod go.sum ./
+COPY ${SRC} ./cmd
+COPY "docs"/ 'README.md' \$HOME ./
+COPY <<EOF /etc/motd
+hello
+EOF
+FROM alpine
+COPY --from=build /app /app
+ADD https://example.com/app.tar.gz config/ /etc/app/
+`)
+	got, err := dockerfileToSimplifiedDockerfile(content, ParseOptions{MaxLabelLength: 20, ShowContext: true})
+	if err != nil {
+		t.Fatalf("dockerfileToSimplifiedDockerfile() error = %v", err)
+	}
+
+	wantExternalImages := []ExternalImage{
+		{ID: "golang", Name: "golang"},
+		{ID: BuildContextID, Name: "build context", Type: ExternalImageDirectory},
+		{ID: "alpine", Name: "alpine"},
+		{ID: "https://example.com/app.tar.gz", Name: "https://example.com/app.tar.gz", Type: ExternalImageURL},
+	}
+	if diff := cmp.Diff(
+		wantExternalImages, got.ExternalImages,
+		cmpopts.IgnoreFields(ExternalImage{}, "Registry", "Repository", "Tag", "Digest"),
+	); diff != "" {
+		t.Errorf("ExternalImages mismatch (-want +got):\n%s", diff)
+	}
+
+	var gotWaitFors [][]WaitFor
+	for _, stage := range got.Stages {
+		for _, layer := range stage.Layers {
+			gotWaitFors = append(gotWaitFors, layer.WaitFors)
+		}
+	}
+	wantWaitFors := [][]WaitFor{
+		{{ID: "golang", Type: WaitForFrom}},
+		nil,
+		{{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"go.mod", "go.sum"}}},
+		{{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"cmd"}}},
+		{{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"docs/", "README.md", "$HOME"}}},
+		nil,
+		{{ID: "alpine", Type: WaitForFrom}},
+		{{ID: "build", Type: WaitForCopy}},
+		{
+			{ID: "https://example.com/app.tar.gz", Type: WaitForAdd},
+			{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"config/"}},
+		},
+	}
+	if diff := cmp.Diff(wantWaitFors, gotWaitFors, cmpopts.IgnoreFields(WaitFor{}, "Copy")); diff != "" {
+		t.Errorf("WaitFors mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_dockerfileToSimplifiedDockerfileAdd(t *testing.T) {
+	content := []byte(`FROM alpine
+ARG VERSION=v1.0
+ADD --checksum=sha256:24454f83 https://example.com/app-${VERSION}.tar.gz /app/
+ADD --keep-git-dir=true https://github.com/org/repo.git#${VERSION} /src
+ADD git@github.com:org/private.git /private
+ADD --keep-git-dir https://example.com/notes.txt local.txt /docs/
+`)
+	got, err := dockerfileToSimplifiedDockerfile(content, ParseOptions{MaxLabelLength: 20})
+	if err != nil {
+		t.Fatalf("dockerfileToSimplifiedDockerfile() error = %v", err)
+	}
+
+	wantExternalImages := []ExternalImage{
+		{ID: "alpine", Name: "alpine"},
+		{ID: "https://example.com/app-v1.0.tar.gz", Name: "https://example.com/app-v1.0.tar.gz", Type: ExternalImageURL},
+		{ID: "https://github.com/org/repo.git#v1.0", Name: "https://github.com/org/repo.git#v1.0", Type: ExternalImageGit},
+		{ID: "git@github.com:org/private.git", Name: "git@github.com:org/private.git", Type: ExternalImageGit},
+		{ID: "https://example.com/notes.txt", Name: "https://example.com/notes.txt", Type: ExternalImageURL},
+	}
+	if diff := cmp.Diff(
+		wantExternalImages, got.ExternalImages,
+		cmpopts.IgnoreFields(ExternalImage{}, "Registry", "Repository", "Tag", "Digest"),
+	); diff != "" {
+		t.Errorf("ExternalImages mismatch (-want +got):\n%s", diff)
+	}
+
+	var gotWaitFors [][]WaitFor
+	for _, layer := range got.Stages[0].Layers[2:] {
+		gotWaitFors = append(gotWaitFors, layer.WaitFors)
+	}
+	wantWaitFors := [][]WaitFor{
+		{{ID: "https://example.com/app-v1.0.tar.gz", Type: WaitForAdd, Checksum: "sha256:24454f83"}},
+		{{ID: "https://github.com/org/repo.git#v1.0", Type: WaitForAdd, KeepGitDir: true}},
+		{{ID: "git@github.com:org/private.git", Type: WaitForAdd}},
+		{{ID: "https://example.com/notes.txt", Type: WaitForAdd}},
+	}
+	if diff := cmp.Diff(wantWaitFors, gotWaitFors, cmpopts.IgnoreFields(WaitFor{}, "Copy")); diff != "" {
+		t.Errorf("WaitFors mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_dockerfileToSimplifiedDockerfileMounts(t *testing.T) {
+	content := []byte(`FROM golang AS build
+RUN --mount=type=cache,target=/root/.cache/go-build,sharing=locked \
+    --mount=type=bind,from=deps,source=/go/pkg,target=/go/pkg \
+    --mount=type=secret,id=netrc,target=/root/.netrc \
+    --mount=type=secret,target=/run/secrets/token \
+    --mount=type=ssh \
+    --mount=type=tmpfs,target=/tmp \
+    go build
+FROM alpine
+RUN --mount=type=cache,id=gocache,target=/cache --mount=type=bind,target=/src true
+RUN --mount=type=cache,target=/root/.cache/go-build go test
+`)
+	got, err := dockerfileToSimplifiedDockerfile(content, ParseOptions{MaxLabelLength: 20})
+	if err != nil {
+		t.Fatalf("dockerfileToSimplifiedDockerfile() error = %v", err)
+	}
+
+	wantExternalImages := []ExternalImage{
+		{ID: "golang", Name: "golang"},
+		{ID: "type=cache,id=/root/.cache/go-build", Name: "/root/.cache/go-build", Type: ExternalImageCache},
+		{ID: "deps", Name: "deps"},
+		{ID: "type=secret,id=netrc", Name: "netrc", Type: ExternalImageSecret},
+		{ID: "type=secret,id=token", Name: "token", Type: ExternalImageSecret},
+		{ID: "type=ssh,id=default", Name: "default", Type: ExternalImageSSH},
+		{ID: "alpine", Name: "alpine"},
+		{ID: "type=cache,id=gocache", Name: "gocache", Type: ExternalImageCache},
+	}
+	if diff := cmp.Diff(
+		wantExternalImages, got.ExternalImages,
+		cmpopts.IgnoreFields(ExternalImage{}, "Registry", "Repository", "Tag", "Digest"),
+	); diff != "" {
+		t.Errorf("ExternalImages mismatch (-want +got):\n%s", diff)
+	}
+
+	var gotWaitFors [][]WaitFor
+	for _, stage := range got.Stages {
+		for _, layer := range stage.Layers[1:] {
+			gotWaitFors = append(gotWaitFors, layer.WaitFors)
+		}
+	}
+	wantWaitFors := [][]WaitFor{
+		{
+			{ID: "type=cache,id=/root/.cache/go-build", Type: WaitForMount, Mount: &Mount{
+				Type: "cache", ID: "/root/.cache/go-build", Target: "/root/.cache/go-build", Sharing: "locked",
+			}},
+			{ID: "deps", Type: WaitForMount, Mount: &Mount{
+				Type: "bind", Target: "/go/pkg", From: "deps", Source: "/go/pkg",
+			}},
+			{ID: "type=secret,id=netrc", Type: WaitForMount, Mount: &Mount{
+				Type: "secret", ID: "netrc", Target: "/root/.netrc",
+			}},
+			{ID: "type=secret,id=token", Type: WaitForMount, Mount: &Mount{
+				Type: "secret", ID: "token", Target: "/run/secrets/token",
+			}},
+			{ID: "type=ssh,id=default", Type: WaitForMount, Mount: &Mount{Type: "ssh", ID: "default"}},
+		},
+		{
+			{ID: "type=cache,id=gocache", Type: WaitForMount, Mount: &Mount{
+				Type: "cache", ID: "gocache", Target: "/cache",
+			}},
+		},
+		{
+			{ID: "type=cache,id=/root/.cache/go-build", Type: WaitForMount, Mount: &Mount{
+				Type: "cache", ID: "/root/.cache/go-build", Target: "/root/.cache/go-build",
+			}},
+		},
+	}
+	if diff := cmp.Diff(wantWaitFors, gotWaitFors); diff != "" {
+		t.Errorf("WaitFors mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_dockerfileToSimplifiedDockerfileCopyOptions(t *testing.T) {
+	content := []byte(`FROM golang AS build
+FROM alpine
+ARG APP=/app
+COPY --link --chown=app:app --chmod=755 --from=build /go/bin/app /go/bin/cli ${APP}/
+COPY --parents --exclude=*_test.go --exclude=docs cmd/ internal/ /src/
+COPY "config"/ '/etc/app'/
+COPY ["config files/", "/etc/my app/"]
+ADD --link=false --chmod=644 https://example.com/config.json /etc/app/
+`)
+	got, err := dockerfileToSimplifiedDockerfile(content, ParseOptions{MaxLabelLength: 20, ShowContext: true})
+	if err != nil {
+		t.Fatalf("dockerfileToSimplifiedDockerfile() error = %v", err)
+	}
+
+	var gotCopyOptions []CopyOptions
+	for _, layer := range got.Stages[1].Layers {
+		for _, waitFor := range layer.WaitFors {
+			if waitFor.Copy != nil {
+				gotCopyOptions = append(gotCopyOptions, *waitFor.Copy)
+			}
+		}
+	}
+	wantCopyOptions := []CopyOptions{
+		{
+			Sources: []string{"/go/bin/app", "/go/bin/cli"}, Destination: "/app/",
+			Link: true, Chown: "app:app", Chmod: "755",
+		},
+		{
+			Sources: []string{"cmd/", "internal/"}, Destination: "/src/",
+			Parents: true, Exclude: []string{"*_test.go", "docs"},
+		},
+		{Sources: []string{"config/"}, Destination: "/etc/app/"},
+		{Sources: []string{"config files/"}, Destination: "/etc/my app/"},
+		{Sources: []string{"https://example.com/config.json"}, Destination: "/etc/app/", Chmod: "644"},
+	}
+	if diff := cmp.Diff(wantCopyOptions, gotCopyOptions); diff != "" {
+		t.Errorf("CopyOptions mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_dockerfileToSimplifiedDockerfilePlatform(t *testing.T) {
+	content := []byte(`ARG TARGETARCH=ignored
+FROM --platform=$BUILDPLATFORM golang AS build
+ARG TARGETOS TARGETARCH
+RUN GOOS=$TARGETOS GOARCH=$TARGETARCH go build
+FROM --platform=linux/arm alpine AS armv7
+FROM alpine AS base-amd64
+FROM alpine AS base-arm64
+FROM base-${TARGETARCH} AS release
+FROM build AS test
+`)
+	tests := []struct {
+		name          string
+		opts          ParseOptions
+		wantPlatforms []string
+		wantEmulated  []bool
+		wantRunLabel  string
+		wantRelease   string
+	}{
+		{
+			name:          "without platform",
+			opts:          ParseOptions{MaxLabelLength: 50},
+			wantPlatforms: []string{"", "", "", "", "", ""},
+			wantEmulated:  []bool{false, false, false, false, false, false},
+			wantRunLabel:  "RUN GOOS=$TARGETOS GOARCH=ignored go build",
+			wantRelease:   "base-ignored",
+		},
+		{
+			name:          "cross-compiling for arm64",
+			opts:          ParseOptions{MaxLabelLength: 50, Platform: "linux/aarch64", BuildPlatform: "linux/x86_64"},
+			wantPlatforms: []string{"linux/amd64", "linux/arm/v7", "linux/arm64", "linux/arm64", "linux/arm64", "linux/amd64"},
+			wantEmulated:  []bool{false, true, true, true, true, false},
+			wantRunLabel:  "RUN GOOS=linux GOARCH=arm64 go build",
+			wantRelease:   "base-arm64",
+		},
+		{
+			name:          "native build",
+			opts:          ParseOptions{MaxLabelLength: 50, Platform: "linux/amd64", BuildPlatform: "linux/amd64"},
+			wantPlatforms: []string{"linux/amd64", "linux/arm/v7", "linux/amd64", "linux/amd64", "linux/amd64", "linux/amd64"},
+			wantEmulated:  []bool{false, true, false, false, false, false},
+			wantRunLabel:  "RUN GOOS=linux GOARCH=amd64 go build",
+			wantRelease:   "base-amd64",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dockerfileToSimplifiedDockerfile(content, tt.opts)
+			if err != nil {
+				t.Fatalf("dockerfileToSimplifiedDockerfile() error = %v", err)
+			}
+
+			var gotPlatforms []string
+			var gotEmulated []bool
+			for _, stage := range got.Stages {
+				gotPlatforms = append(gotPlatforms, stage.Platform)
+				gotEmulated = append(gotEmulated, stage.Emulated)
+			}
+			if diff := cmp.Diff(tt.wantPlatforms, gotPlatforms); diff != "" {
+				t.Errorf("Platforms mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantEmulated, gotEmulated); diff != "" {
+				t.Errorf("Emulated mismatch (-want +got):\n%s", diff)
+			}
+			if gotLabel := got.Stages[0].Layers[2].Label; gotLabel != tt.wantRunLabel {
+				t.Errorf("RUN label = %q, want %q", gotLabel, tt.wantRunLabel)
+			}
+			if gotID := got.Stages[4].Layers[0].WaitFors[0].ID; gotID != tt.wantRelease {
+				t.Errorf("release is based on %q, want %q", gotID, tt.wantRelease)
+			}
+		})
+	}
+}
+
+func Test_dockerfileToSimplifiedDockerfileInvalidPlatform(t *testing.T) {
+	_, err := dockerfileToSimplifiedDockerfile([]byte("FROM alpine\n"), ParseOptions{Platform: "linux"})
+	if err == nil {
+		t.Error("dockerfileToSimplifiedDockerfile() expected an error for an invalid platform, got nil")
+	}
+}
@@ -0,0 +1,30 @@
+// Package dockerfilegraph loads multi-stage Dockerfiles and converts them
+// into build graphs. A Dockerfile is parsed into a SimplifiedDockerfile,
+// which can then be rendered as a Graphviz DOT file, a Mermaid flowchart, an
+// SVG document or a JSON document. Lint checks the graph for problems like
+// stages that no target needs.
+//
+//	sdf, err := dockerfilegraph.LoadAndParseDockerfile(
+//		ctx, afero.NewOsFs(), "Dockerfile",
+//		dockerfilegraph.ParseOptions{MaxLabelLength: 20},
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	dot, err := dockerfilegraph.BuildDotFile(sdf, dockerfilegraph.BuildOptions{
+//		EdgeStyle: "default", MaxLabelLength: 20, NodeSep: 1, RankSep: 0.5,
+//	})
+//
+// # Compatibility
+//
+// This package follows semantic versioning together with the dockerfilegraph
+// command. Within a major version, exported identifiers are not removed or
+// renamed, function signatures do not change, and the numeric values of
+// enums like WaitForType and ScratchMode stay the same. New fields, functions
+// and enum values may be added in minor versions, so use keyed struct
+// literals and handle unknown enum values.
+//
+// The exact output of the Build functions is not covered, because node
+// labels, styles and layout details may change to improve the rendered
+// graph. The JSON document is versioned separately, see JSONSchemaVersion.
+package dockerfilegraph
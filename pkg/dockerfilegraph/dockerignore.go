@@ -0,0 +1,164 @@
+package dockerfilegraph
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+	"github.com/spf13/afero"
+)
+
+// applyDockerignore checks the paths that COPY and ADD read from the build
+// context against its .dockerignore file, see readDockerignore. The context
+// is the directory of the Dockerfile if contextDir is empty, or the current
+// directory if there is no filename either. Sources
+// that are excluded entirely are removed, with a warning on their layer,
+// because nothing reaches the stage. For the other sources, the patterns
+// that exclude some of their files are added to the WaitFor.
+func applyDockerignore(inputFS afero.Fs, filename, contextDir string, sdf *SimplifiedDockerfile) error {
+	if contextDir == "" {
+		contextDir = filepath.Dir(filename)
+	}
+	ignoreFile, patterns, err := readDockerignore(inputFS, filename, contextDir)
+	if err != nil || len(patterns) == 0 {
+		return err
+	}
+	matcher, err := patternmatcher.New(patterns)
+	if err != nil {
+		return fmt.Errorf("could not parse %s: %w", ignoreFile, err)
+	}
+
+	removed := false
+	for stageIndex := range sdf.Stages {
+		for layerIndex := range sdf.Stages[stageIndex].Layers {
+			layer := &sdf.Stages[stageIndex].Layers[layerIndex]
+			waitFors := make([]WaitFor, 0, len(layer.WaitFors))
+			for _, waitFor := range layer.WaitFors {
+				if waitFor.ID != BuildContextID {
+					waitFors = append(waitFors, waitFor)
+					continue
+				}
+
+				var paths []string
+				for _, path := range waitFor.Paths {
+					ignoredBy, allIgnored, err := ignoredSourcePatterns(inputFS, contextDir, path, matcher)
+					if err != nil {
+						return err
+					}
+					if allIgnored {
+						layer.Warnings = append(layer.Warnings, fmt.Sprintf(
+							"%q is excluded by %s, so nothing is copied", path, filepath.Base(ignoreFile),
+						))
+						continue
+					}
+					paths = append(paths, path)
+					for _, pattern := range ignoredBy {
+						if !slices.Contains(waitFor.Ignored, pattern) {
+							waitFor.Ignored = append(waitFor.Ignored, pattern)
+						}
+					}
+				}
+
+				if len(paths) == 0 {
+					removed = true
+					continue
+				}
+				waitFor.Paths = paths
+				waitFors = append(waitFors, waitFor)
+			}
+			layer.WaitFors = waitFors
+		}
+	}
+
+	if removed {
+		sdf.ExternalImages = filterExternalImages(sdf.ExternalImages, sdf.Stages)
+	}
+	return nil
+}
+
+// readDockerignore returns the patterns of the ignore file of a Dockerfile.
+// Like BuildKit, a file next to the Dockerfile that is named after it, e.g.
+// Dockerfile.dockerignore, takes precedence over the .dockerignore in the
+// root of the build context. A Dockerfile without a filename, e.g. from
+// stdin, only has the .dockerignore of the build context.
+func readDockerignore(inputFS afero.Fs, filename, contextDir string) (string, []string, error) {
+	ignoreFiles := []string{filepath.Join(contextDir, ".dockerignore")}
+	if filename != "" {
+		ignoreFiles = slices.Insert(ignoreFiles, 0, filename+".dockerignore")
+	}
+	for _, ignoreFile := range ignoreFiles {
+		content, err := afero.ReadFile(inputFS, ignoreFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		patterns, err := ignorefile.ReadAll(bytes.NewReader(content))
+		if err != nil {
+			return "", nil, fmt.Errorf("could not read %s: %w", ignoreFile, err)
+		}
+		return ignoreFile, patterns, nil
+	}
+	return "", nil, nil
+}
+
+// ignoredSourcePatterns returns the patterns that exclude files of a source
+// path, and whether all of its files are excluded. A source without any
+// files is not reported as excluded, because it may be created before the
+// build, e.g. by a code generator.
+func ignoredSourcePatterns(
+	inputFS afero.Fs,
+	contextDir string,
+	source string,
+	matcher *patternmatcher.PatternMatcher,
+) ([]string, bool, error) {
+	source = strings.TrimPrefix(filepath.ToSlash(source), "/")
+	matches, err := afero.Glob(inputFS, filepath.Join(contextDir, filepath.FromSlash(source)))
+	if err != nil {
+		// Not a valid glob for Go, so the files are unknown.
+		return nil, false, nil
+	}
+
+	var ignoredBy []string
+	files, ignoredFiles := 0, 0
+	for _, match := range matches {
+		err := afero.Walk(inputFS, match, func(path string, info fs.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			relPath, err := filepath.Rel(contextDir, path)
+			if err != nil {
+				return err
+			}
+			relPath = filepath.ToSlash(relPath)
+
+			files++
+			ignored, err := matcher.MatchesOrParentMatches(relPath)
+			if err != nil || !ignored {
+				return err
+			}
+			ignoredFiles++
+			for _, pattern := range matcher.Patterns() {
+				if pattern.Exclusion() || slices.Contains(ignoredBy, pattern.String()) {
+					continue
+				}
+				if matched, _ := patternmatcher.MatchesOrParentMatches(relPath, []string{pattern.String()}); matched {
+					ignoredBy = append(ignoredBy, pattern.String())
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return ignoredBy, files > 0 && ignoredFiles == files, nil
+}
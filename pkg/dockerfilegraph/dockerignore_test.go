@@ -0,0 +1,135 @@
+package dockerfilegraph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/spf13/afero"
+)
+
+func TestLoadAndParseDockerfileDockerignore(t *testing.T) {
+	dockerfile := `FROM alpine
+COPY go.mod go.sum ./
+COPY cmd/ ./cmd/
+COPY docs/ ./docs/
+COPY generated/ ./generated/
+`
+	tests := []struct {
+		name         string
+		files        map[string]string
+		wantWaitFors [][]WaitFor
+		wantWarnings [][]string
+		wantImages   []string
+	}{
+		{
+			name: "without .dockerignore",
+			wantWaitFors: [][]WaitFor{
+				{{ID: "alpine", Type: WaitForFrom}},
+				{{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"go.mod", "go.sum"}}},
+				{{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"cmd/"}}},
+				{{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"docs/"}}},
+				{{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"generated/"}}},
+			},
+			wantWarnings: [][]string{nil, nil, nil, nil, nil},
+			wantImages:   []string{"alpine", BuildContextID},
+		},
+		{
+			name: "excluded files and sources",
+			files: map[string]string{
+				"app/.dockerignore": "go.sum\ndocs\n**/*_test.go\n!cmd/keep_test.go\ngenerated\n",
+			},
+			wantWaitFors: [][]WaitFor{
+				{{ID: "alpine", Type: WaitForFrom}},
+				{{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"go.mod"}}},
+				{{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"cmd/"}, Ignored: []string{"**/*_test.go"}}},
+				nil,
+				{{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"generated/"}}},
+			},
+			wantWarnings: [][]string{
+				nil,
+				{`"go.sum" is excluded by .dockerignore, so nothing is copied`},
+				nil,
+				{`"docs/" is excluded by .dockerignore, so nothing is copied`},
+				nil,
+			},
+			wantImages: []string{"alpine", BuildContextID},
+		},
+		{
+			name: "Dockerfile.dockerignore takes precedence",
+			files: map[string]string{
+				"app/.dockerignore":           "go.mod\n",
+				"app/Dockerfile.dockerignore": "*\n",
+			},
+			wantWaitFors: [][]WaitFor{
+				{{ID: "alpine", Type: WaitForFrom}},
+				nil,
+				nil,
+				nil,
+				{{ID: BuildContextID, Type: WaitForCopy, Paths: []string{"generated/"}}},
+			},
+			wantWarnings: [][]string{
+				nil,
+				{
+					`"go.mod" is excluded by Dockerfile.dockerignore, so nothing is copied`,
+					`"go.sum" is excluded by Dockerfile.dockerignore, so nothing is copied`,
+				},
+				{`"cmd/" is excluded by Dockerfile.dockerignore, so nothing is copied`},
+				{`"docs/" is excluded by Dockerfile.dockerignore, so nothing is copied`},
+				nil,
+			},
+			wantImages: []string{"alpine", BuildContextID},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputFS := afero.NewMemMapFs()
+			for path, content := range map[string]string{
+				"app/Dockerfile":          dockerfile,
+				"app/go.mod":              "module app",
+				"app/go.sum":              "",
+				"app/cmd/main.go":         "package main",
+				"app/cmd/main_test.go":    "package main",
+				"app/cmd/keep_test.go":    "package main",
+				"app/docs/README.md":      "# App",
+				"app/docs/images/app.png": "",
+			} {
+				_ = afero.WriteFile(inputFS, path, []byte(content), 0o644)
+			}
+			for path, content := range tt.files {
+				_ = afero.WriteFile(inputFS, path, []byte(content), 0o644)
+			}
+
+			got, err := LoadAndParseDockerfile(
+				context.Background(), inputFS, "app/Dockerfile", ParseOptions{MaxLabelLength: 20, ShowContext: true},
+			)
+			if err != nil {
+				t.Fatalf("LoadAndParseDockerfile() error = %v", err)
+			}
+
+			var gotWaitFors [][]WaitFor
+			var gotWarnings [][]string
+			for _, layer := range got.Stages[0].Layers {
+				gotWaitFors = append(gotWaitFors, layer.WaitFors)
+				gotWarnings = append(gotWarnings, layer.Warnings)
+			}
+			var gotImages []string
+			for _, image := range got.ExternalImages {
+				gotImages = append(gotImages, image.ID)
+			}
+
+			if diff := cmp.Diff(
+				tt.wantWaitFors, gotWaitFors, cmpopts.EquateEmpty(), cmpopts.IgnoreFields(WaitFor{}, "Copy"),
+			); diff != "" {
+				t.Errorf("WaitFors mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantWarnings, gotWarnings); diff != "" {
+				t.Errorf("Warnings mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantImages, gotImages); diff != "" {
+				t.Errorf("ExternalImages mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -1,4 +1,4 @@
-package dockerfile2dot
+package dockerfilegraph
 
 import (
 	"fmt"
@@ -6,11 +6,12 @@ import (
 	"strings"
 )
 
-// filterToTargets returns a new SimplifiedDockerfile containing only the
+// FilterToTargets returns a new SimplifiedDockerfile containing only the
 // stages that are transitively needed to build any of the named targets.
 // External images referenced by the retained stages are also retained.
 // Returns an error if any target name does not correspond to a stage.
-func filterToTargets(sdf SimplifiedDockerfile, targets []string) (SimplifiedDockerfile, error) {
+// ParseOptions.Targets applies the same filter while parsing.
+func FilterToTargets(sdf SimplifiedDockerfile, targets []string) (SimplifiedDockerfile, error) {
 	targetIndices, err := resolveTargetIndices(sdf.Stages, targets)
 	if err != nil {
 		return SimplifiedDockerfile{}, err
@@ -42,8 +43,47 @@ func filterToTargets(sdf SimplifiedDockerfile, targets []string) (SimplifiedDock
 	}, nil
 }
 
+// MarkUnusedStages returns a copy of the SimplifiedDockerfile in which the
+// stages that none of the named targets transitively needs are marked as
+// Unused. Without targets, the default targets are used, i.e. the last stage
+// of each Dockerfile. Unlike FilterToTargets, no stage is removed.
+// ParseOptions.HighlightUnused applies the same marking while parsing.
+func MarkUnusedStages(sdf SimplifiedDockerfile, targets []string) (SimplifiedDockerfile, error) {
+	targetIndices, err := targetIndicesOrDefault(sdf.Stages, targets)
+	if err != nil {
+		return SimplifiedDockerfile{}, err
+	}
+
+	reachable := collectReachableIndices(sdf.Stages, targetIndices)
+
+	stages := make([]Stage, len(sdf.Stages))
+	for i, stage := range sdf.Stages {
+		_, ok := reachable[i]
+		stage.Unused = !ok
+		stages[i] = stage
+	}
+	sdf.Stages = stages
+	return sdf, nil
+}
+
+// targetIndicesOrDefault returns the stage indices of the targets, or of the
+// default targets if there are none.
+func targetIndicesOrDefault(stages []Stage, targets []string) ([]int, error) {
+	if len(targets) > 0 {
+		return resolveTargetIndices(stages, targets)
+	}
+	var indices []int
+	for stageIndex := range stages {
+		if isDefaultTarget(stages, stageIndex) {
+			indices = append(indices, stageIndex)
+		}
+	}
+	return indices, nil
+}
+
 // resolveTargetIndices validates target names and returns their stage indices.
-// Whitespace is trimmed from each target; empty entries are skipped.
+// Whitespace is trimmed from each target; empty entries are skipped. In
+// combined graphs, a name selects the stages of that name in all Dockerfiles.
 func resolveTargetIndices(stages []Stage, targets []string) ([]int, error) {
 	indices := make([]int, 0, len(targets))
 	for _, target := range targets {
@@ -56,6 +96,14 @@ func resolveTargetIndices(stages []Stage, targets []string) ([]int, error) {
 			return nil, fmt.Errorf("target %q not found in Dockerfile", trimmed)
 		}
 		indices = append(indices, idx)
+		if _, err := strconv.Atoi(trimmed); err == nil {
+			continue
+		}
+		for i := idx + 1; i < len(stages); i++ {
+			if stages[i].Name == trimmed {
+				indices = append(indices, i)
+			}
+		}
 	}
 	if len(indices) == 0 {
 		return nil, fmt.Errorf("no valid targets specified")
@@ -81,7 +129,7 @@ func collectReachableIndices(stages []Stage, targetIndices []int) map[int]struct
 
 		for _, layer := range stages[idx].Layers {
 			for _, waitFor := range layer.WaitFors {
-				if depIdx, found := findStageIndex(stages, waitFor.ID); found {
+				if depIdx, found := findWaitForStage(stages, waitFor.ID); found {
 					queue = append(queue, depIdx)
 				}
 			}
@@ -105,7 +153,8 @@ func remapStage(stage Stage, oldToNew map[int]int) Stage {
 	for li, layer := range stage.Layers {
 		newLayers[li] = remapLayer(layer, oldToNew)
 	}
-	return Stage{Name: stage.Name, Layers: newLayers}
+	stage.Layers = newLayers
+	return stage
 }
 
 // remapLayer returns a copy of layer with numeric WaitFor IDs updated to new indices.
@@ -119,7 +168,8 @@ func remapLayer(layer Layer, oldToNew map[int]int) Layer {
 		}
 		newWaitFors[wi] = wf
 	}
-	return Layer{Label: layer.Label, WaitFors: newWaitFors}
+	layer.WaitFors = newWaitFors
+	return layer
 }
 
 // filterExternalImages retains only external images referenced by the filtered stages.
@@ -130,7 +180,7 @@ func filterExternalImages(allImages []ExternalImage, filteredStages []Stage) []E
 		for _, layer := range stage.Layers {
 			for _, wf := range layer.WaitFors {
 				// Only count as an external image reference if it doesn't resolve to an internal stage.
-				if _, found := findStageIndex(filteredStages, wf.ID); !found {
+				if _, found := findWaitForStage(filteredStages, wf.ID); !found {
 					referencedIDs[wf.ID] = struct{}{}
 				}
 			}
@@ -1,4 +1,4 @@
-package dockerfile2dot
+package dockerfilegraph
 
 import (
 	"testing"
@@ -7,7 +7,7 @@ import (
 )
 
 // stageFrom is a helper that builds a Stage with a single FROM layer.
-func stageFrom(name, image string, wfType waitForType) Stage {
+func stageFrom(name, image string, wfType WaitForType) Stage {
 	return Stage{
 		Name: name,
 		Layers: []Layer{{
@@ -17,7 +17,7 @@ func stageFrom(name, image string, wfType waitForType) Stage {
 	}
 }
 
-func Test_filterToTargets(t *testing.T) {
+func TestFilterToTargets(t *testing.T) {
 	tests := []struct {
 		name    string
 		sdf     SimplifiedDockerfile
@@ -29,10 +29,10 @@ func Test_filterToTargets(t *testing.T) {
 			name: "single target retains only that stage and its ancestors",
 			sdf: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("base", "ubuntu", waitForFrom),
-					stageFrom("mid", "base", waitForFrom),
-					stageFrom("final", "mid", waitForFrom),
-					stageFrom("unrelated", "alpine", waitForFrom),
+					stageFrom("base", "ubuntu", WaitForFrom),
+					stageFrom("mid", "base", WaitForFrom),
+					stageFrom("final", "mid", WaitForFrom),
+					stageFrom("unrelated", "alpine", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "ubuntu", Name: "ubuntu"},
@@ -42,9 +42,9 @@ func Test_filterToTargets(t *testing.T) {
 			targets: []string{"final"},
 			want: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("base", "ubuntu", waitForFrom),
-					stageFrom("mid", "base", waitForFrom),
-					stageFrom("final", "mid", waitForFrom),
+					stageFrom("base", "ubuntu", WaitForFrom),
+					stageFrom("mid", "base", WaitForFrom),
+					stageFrom("final", "mid", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "ubuntu", Name: "ubuntu"},
@@ -55,8 +55,8 @@ func Test_filterToTargets(t *testing.T) {
 			name: "single target with no deps retains only that stage",
 			sdf: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("standalone", "alpine", waitForFrom),
-					stageFrom("other", "ubuntu", waitForFrom),
+					stageFrom("standalone", "alpine", WaitForFrom),
+					stageFrom("other", "ubuntu", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "alpine", Name: "alpine"},
@@ -66,7 +66,7 @@ func Test_filterToTargets(t *testing.T) {
 			targets: []string{"standalone"},
 			want: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("standalone", "alpine", waitForFrom),
+					stageFrom("standalone", "alpine", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "alpine", Name: "alpine"},
@@ -77,10 +77,10 @@ func Test_filterToTargets(t *testing.T) {
 			name: "two targets union their ancestors",
 			sdf: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("base", "ubuntu", waitForFrom),
-					stageFrom("app1", "base", waitForFrom),
-					stageFrom("app2", "alpine", waitForFrom),
-					stageFrom("unused", "scratch", waitForFrom),
+					stageFrom("base", "ubuntu", WaitForFrom),
+					stageFrom("app1", "base", WaitForFrom),
+					stageFrom("app2", "alpine", WaitForFrom),
+					stageFrom("unused", "scratch", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "ubuntu", Name: "ubuntu"},
@@ -91,9 +91,9 @@ func Test_filterToTargets(t *testing.T) {
 			targets: []string{"app1", "app2"},
 			want: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("base", "ubuntu", waitForFrom),
-					stageFrom("app1", "base", waitForFrom),
-					stageFrom("app2", "alpine", waitForFrom),
+					stageFrom("base", "ubuntu", WaitForFrom),
+					stageFrom("app1", "base", WaitForFrom),
+					stageFrom("app2", "alpine", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "ubuntu", Name: "ubuntu"},
@@ -105,9 +105,9 @@ func Test_filterToTargets(t *testing.T) {
 			name: "two targets with shared ancestor",
 			sdf: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("shared", "ubuntu", waitForFrom),
-					stageFrom("app1", "shared", waitForFrom),
-					stageFrom("app2", "shared", waitForFrom),
+					stageFrom("shared", "ubuntu", WaitForFrom),
+					stageFrom("app1", "shared", WaitForFrom),
+					stageFrom("app2", "shared", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "ubuntu", Name: "ubuntu"},
@@ -116,9 +116,9 @@ func Test_filterToTargets(t *testing.T) {
 			targets: []string{"app1", "app2"},
 			want: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("shared", "ubuntu", waitForFrom),
-					stageFrom("app1", "shared", waitForFrom),
-					stageFrom("app2", "shared", waitForFrom),
+					stageFrom("shared", "ubuntu", WaitForFrom),
+					stageFrom("app1", "shared", WaitForFrom),
+					stageFrom("app2", "shared", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "ubuntu", Name: "ubuntu"},
@@ -129,17 +129,17 @@ func Test_filterToTargets(t *testing.T) {
 			name: "COPY and RUN mount dependencies are followed",
 			sdf: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("builder", "ubuntu", waitForFrom),
-					stageFrom("cache", "alpine", waitForFrom),
+					stageFrom("builder", "ubuntu", WaitForFrom),
+					stageFrom("cache", "alpine", WaitForFrom),
 					{
 						Name: "final",
 						Layers: []Layer{
-							{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: waitForFrom}}},
-							{Label: "COPY --from=builder", WaitFors: []WaitFor{{ID: "builder", Type: waitForCopy}}},
-							{Label: "RUN --mount=from=cache", WaitFors: []WaitFor{{ID: "cache", Type: waitForMount}}},
+							{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}}},
+							{Label: "COPY --from=builder", WaitFors: []WaitFor{{ID: "builder", Type: WaitForCopy}}},
+							{Label: "RUN --mount=from=cache", WaitFors: []WaitFor{{ID: "cache", Type: WaitForMount}}},
 						},
 					},
-					stageFrom("unused", "debian", waitForFrom),
+					stageFrom("unused", "debian", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "ubuntu", Name: "ubuntu"},
@@ -151,14 +151,14 @@ func Test_filterToTargets(t *testing.T) {
 			targets: []string{"final"},
 			want: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("builder", "ubuntu", waitForFrom),
-					stageFrom("cache", "alpine", waitForFrom),
+					stageFrom("builder", "ubuntu", WaitForFrom),
+					stageFrom("cache", "alpine", WaitForFrom),
 					{
 						Name: "final",
 						Layers: []Layer{
-							{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: waitForFrom}}},
-							{Label: "COPY --from=builder", WaitFors: []WaitFor{{ID: "builder", Type: waitForCopy}}},
-							{Label: "RUN --mount=from=cache", WaitFors: []WaitFor{{ID: "cache", Type: waitForMount}}},
+							{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}}},
+							{Label: "COPY --from=builder", WaitFors: []WaitFor{{ID: "builder", Type: WaitForCopy}}},
+							{Label: "RUN --mount=from=cache", WaitFors: []WaitFor{{ID: "cache", Type: WaitForMount}}},
 						},
 					},
 				},
@@ -176,13 +176,13 @@ func Test_filterToTargets(t *testing.T) {
 			name: "numeric WaitFor IDs are remapped after stage elision (no shift)",
 			sdf: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("base", "ubuntu", waitForFrom),
-					stageFrom("unused", "alpine", waitForFrom),
+					stageFrom("base", "ubuntu", WaitForFrom),
+					stageFrom("unused", "alpine", WaitForFrom),
 					{
 						Name: "final",
 						Layers: []Layer{
-							{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: waitForFrom}}},
-							{Label: "COPY --from=0", WaitFors: []WaitFor{{ID: "0", Type: waitForCopy}}},
+							{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}}},
+							{Label: "COPY --from=0", WaitFors: []WaitFor{{ID: "0", Type: WaitForCopy}}},
 						},
 					},
 				},
@@ -195,12 +195,12 @@ func Test_filterToTargets(t *testing.T) {
 			targets: []string{"final"},
 			want: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("base", "ubuntu", waitForFrom),
+					stageFrom("base", "ubuntu", WaitForFrom),
 					{
 						Name: "final",
 						Layers: []Layer{
-							{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: waitForFrom}}},
-							{Label: "COPY --from=0", WaitFors: []WaitFor{{ID: "0", Type: waitForCopy}}},
+							{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}}},
+							{Label: "COPY --from=0", WaitFors: []WaitFor{{ID: "0", Type: WaitForCopy}}},
 						},
 					},
 				},
@@ -217,13 +217,13 @@ func Test_filterToTargets(t *testing.T) {
 			name: "numeric WaitFor IDs are remapped when earlier stage is elided",
 			sdf: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("elided", "debian", waitForFrom),
-					stageFrom("base", "ubuntu", waitForFrom),
+					stageFrom("elided", "debian", WaitForFrom),
+					stageFrom("base", "ubuntu", WaitForFrom),
 					{
 						Name: "final",
 						Layers: []Layer{
-							{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: waitForFrom}}},
-							{Label: "COPY --from=1", WaitFors: []WaitFor{{ID: "1", Type: waitForCopy}}},
+							{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}}},
+							{Label: "COPY --from=1", WaitFors: []WaitFor{{ID: "1", Type: WaitForCopy}}},
 						},
 					},
 				},
@@ -236,12 +236,12 @@ func Test_filterToTargets(t *testing.T) {
 			targets: []string{"final"},
 			want: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("base", "ubuntu", waitForFrom),
+					stageFrom("base", "ubuntu", WaitForFrom),
 					{
 						Name: "final",
 						Layers: []Layer{
-							{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: waitForFrom}}},
-							{Label: "COPY --from=1", WaitFors: []WaitFor{{ID: "0", Type: waitForCopy}}},
+							{Label: "FROM scratch", WaitFors: []WaitFor{{ID: "scratch", Type: WaitForFrom}}},
+							{Label: "COPY --from=1", WaitFors: []WaitFor{{ID: "0", Type: WaitForCopy}}},
 						},
 					},
 				},
@@ -258,8 +258,8 @@ func Test_filterToTargets(t *testing.T) {
 					{Label: "ARG VERSION=1.0"},
 				},
 				Stages: []Stage{
-					stageFrom("app", "alpine", waitForFrom),
-					stageFrom("other", "ubuntu", waitForFrom),
+					stageFrom("app", "alpine", WaitForFrom),
+					stageFrom("other", "ubuntu", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "alpine", Name: "alpine"},
@@ -272,7 +272,7 @@ func Test_filterToTargets(t *testing.T) {
 					{Label: "ARG VERSION=1.0"},
 				},
 				Stages: []Stage{
-					stageFrom("app", "alpine", waitForFrom),
+					stageFrom("app", "alpine", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "alpine", Name: "alpine"},
@@ -303,7 +303,7 @@ func Test_filterToTargets(t *testing.T) {
 			name: "target that is the first and only stage",
 			sdf: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("only", "scratch", waitForFrom),
+					stageFrom("only", "scratch", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "scratch", Name: "scratch"},
@@ -312,7 +312,7 @@ func Test_filterToTargets(t *testing.T) {
 			targets: []string{"only"},
 			want: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("only", "scratch", waitForFrom),
+					stageFrom("only", "scratch", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "scratch", Name: "scratch"},
@@ -323,8 +323,8 @@ func Test_filterToTargets(t *testing.T) {
 			name: "external images not referenced by kept stages are elided",
 			sdf: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("a", "img-a", waitForFrom),
-					stageFrom("b", "img-b", waitForFrom),
+					stageFrom("a", "img-a", WaitForFrom),
+					stageFrom("b", "img-b", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "img-a", Name: "img-a"},
@@ -334,7 +334,7 @@ func Test_filterToTargets(t *testing.T) {
 			targets: []string{"a"},
 			want: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("a", "img-a", waitForFrom),
+					stageFrom("a", "img-a", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "img-a", Name: "img-a"},
@@ -348,15 +348,15 @@ func Test_filterToTargets(t *testing.T) {
 			name: "internal stage WaitFor IDs are not treated as external image references",
 			sdf: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("base", "ubuntu", waitForFrom),
+					stageFrom("base", "ubuntu", WaitForFrom),
 					{
 						Name: "app",
 						Layers: []Layer{{
 							Label:    "FROM base",
-							WaitFors: []WaitFor{{ID: "base", Type: waitForFrom}},
+							WaitFors: []WaitFor{{ID: "base", Type: WaitForFrom}},
 						}},
 					},
-					stageFrom("other", "alpine", waitForFrom),
+					stageFrom("other", "alpine", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "ubuntu", Name: "ubuntu"},
@@ -366,12 +366,12 @@ func Test_filterToTargets(t *testing.T) {
 			targets: []string{"app"},
 			want: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("base", "ubuntu", waitForFrom),
+					stageFrom("base", "ubuntu", WaitForFrom),
 					{
 						Name: "app",
 						Layers: []Layer{{
 							Label:    "FROM base",
-							WaitFors: []WaitFor{{ID: "base", Type: waitForFrom}},
+							WaitFors: []WaitFor{{ID: "base", Type: WaitForFrom}},
 						}},
 					},
 				},
@@ -384,8 +384,8 @@ func Test_filterToTargets(t *testing.T) {
 			name: "target with leading/trailing whitespace is normalized",
 			sdf: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("app", "alpine", waitForFrom),
-					stageFrom("other", "ubuntu", waitForFrom),
+					stageFrom("app", "alpine", WaitForFrom),
+					stageFrom("other", "ubuntu", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "alpine", Name: "alpine"},
@@ -395,8 +395,8 @@ func Test_filterToTargets(t *testing.T) {
 			targets: []string{" app ", "  other  "},
 			want: SimplifiedDockerfile{
 				Stages: []Stage{
-					stageFrom("app", "alpine", waitForFrom),
-					stageFrom("other", "ubuntu", waitForFrom),
+					stageFrom("app", "alpine", WaitForFrom),
+					stageFrom("other", "ubuntu", WaitForFrom),
 				},
 				ExternalImages: []ExternalImage{
 					{ID: "alpine", Name: "alpine"},
@@ -404,20 +404,123 @@ func Test_filterToTargets(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "a target selects the stages of that name in all Dockerfiles of a combined graph",
+			sdf: SimplifiedDockerfile{
+				Stages: []Stage{
+					{Name: "test", File: "api/Dockerfile"},
+					{Name: "app", File: "api/Dockerfile"},
+					{Name: "test", File: "web/Dockerfile"},
+					{Name: "app", File: "web/Dockerfile"},
+				},
+			},
+			targets: []string{"test"},
+			want: SimplifiedDockerfile{
+				Stages: []Stage{
+					{Name: "test", File: "api/Dockerfile", Layers: []Layer{}},
+					{Name: "test", File: "web/Dockerfile", Layers: []Layer{}},
+				},
+				ExternalImages: []ExternalImage{},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := filterToTargets(tt.sdf, tt.targets)
+			got, err := FilterToTargets(tt.sdf, tt.targets)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("filterToTargets() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("FilterToTargets() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if tt.wantErr {
 				return
 			}
 			if diff := cmp.Diff(tt.want, got); diff != "" {
-				t.Errorf("filterToTargets() mismatch (-want +got):\n%s", diff)
+				t.Errorf("FilterToTargets() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMarkUnusedStages(t *testing.T) {
+	unused := func(stage Stage) Stage {
+		stage.Unused = true
+		return stage
+	}
+
+	tests := []struct {
+		name    string
+		sdf     SimplifiedDockerfile
+		targets []string
+		want    []Stage
+		wantErr bool
+	}{
+		{
+			name: "without targets the last stage is the target",
+			sdf: SimplifiedDockerfile{Stages: []Stage{
+				stageFrom("base", "ubuntu", WaitForFrom),
+				stageFrom("test", "base", WaitForFrom),
+				stageFrom("final", "base", WaitForFrom),
+			}},
+			want: []Stage{
+				stageFrom("base", "ubuntu", WaitForFrom),
+				unused(stageFrom("test", "base", WaitForFrom)),
+				stageFrom("final", "base", WaitForFrom),
+			},
+		},
+		{
+			name: "targets replace the last stage",
+			sdf: SimplifiedDockerfile{Stages: []Stage{
+				stageFrom("base", "ubuntu", WaitForFrom),
+				stageFrom("test", "base", WaitForFrom),
+				stageFrom("final", "base", WaitForFrom),
+			}},
+			targets: []string{"test"},
+			want: []Stage{
+				stageFrom("base", "ubuntu", WaitForFrom),
+				stageFrom("test", "base", WaitForFrom),
+				unused(stageFrom("final", "base", WaitForFrom)),
+			},
+		},
+		{
+			name: "earlier marks are replaced",
+			sdf: SimplifiedDockerfile{Stages: []Stage{
+				unused(stageFrom("base", "ubuntu", WaitForFrom)),
+				stageFrom("final", "base", WaitForFrom),
+			}},
+			want: []Stage{
+				stageFrom("base", "ubuntu", WaitForFrom),
+				stageFrom("final", "base", WaitForFrom),
+			},
+		},
+		{
+			name: "the last stage of each Dockerfile is a default target",
+			sdf: SimplifiedDockerfile{Stages: []Stage{
+				{Name: "test", File: "a/Dockerfile"},
+				{Name: "app", File: "a/Dockerfile"},
+				{Name: "app", File: "b/Dockerfile"},
+			}},
+			want: []Stage{
+				{Name: "test", File: "a/Dockerfile", Unused: true},
+				{Name: "app", File: "a/Dockerfile"},
+				{Name: "app", File: "b/Dockerfile"},
+			},
+		},
+		{
+			name:    "unknown target",
+			sdf:     SimplifiedDockerfile{Stages: []Stage{stageFrom("final", "ubuntu", WaitForFrom)}},
+			targets: []string{"missing"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MarkUnusedStages(tt.sdf, tt.targets)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MarkUnusedStages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got.Stages); diff != "" {
+				t.Errorf("MarkUnusedStages() mismatch (-want +got):\n%s", diff)
 			}
 		})
 	}
@@ -0,0 +1,75 @@
+package dockerfilegraph
+
+import (
+	"path"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// fingerprintLength is the number of hex digits that a digest fingerprint
+// shows, like the short image IDs of the Docker CLI.
+const fingerprintLength = 12
+
+// withImageReference sets the registry, repository, tag and digest of an
+// image from its name. Other external images, scratch and names that are no
+// valid reference, e.g. because of an unresolved ARG, are left unchanged.
+func withImageReference(externalImage ExternalImage) ExternalImage {
+	if externalImage.Type != ExternalImageRegistry || externalImage.Name == "scratch" {
+		return externalImage
+	}
+	named, err := reference.ParseNormalizedNamed(externalImage.Name)
+	if err != nil {
+		return externalImage
+	}
+
+	externalImage.Registry = reference.Domain(named)
+	externalImage.Repository = reference.Path(named)
+	if tagged, ok := named.(reference.Tagged); ok {
+		externalImage.Tag = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		externalImage.Digest = digested.Digest().String()
+	}
+	return externalImage
+}
+
+// getImageName returns the name of an external image as requested by the
+// ImageName and ImageDigest build options. The short name is the last
+// part of the repository, e.g. app for ghcr.io/org/app. Without a parsed
+// reference, the name is returned as it is.
+func getImageName(externalImage ExternalImage, imageName, imageDigest string) string {
+	if externalImage.Repository == "" {
+		return externalImage.Name
+	}
+
+	name := externalImage.Name
+	if imageName == "short" {
+		name = path.Base(externalImage.Repository)
+		if externalImage.Tag != "" {
+			name += ":" + externalImage.Tag
+		}
+		if externalImage.Digest != "" {
+			name += "@" + externalImage.Digest
+		}
+	}
+	if imageDigest == "fingerprint" || imageDigest == "hide" {
+		name, _, _ = strings.Cut(name, "@")
+	}
+	return name
+}
+
+// getDigestFingerprint returns the algorithm and the first hex digits of the
+// digest of an image, e.g. sha256:4bcff63911fc, if the ImageDigest build
+// option asks for it. It is shown below the name of the image, so that it
+// is not truncated.
+func getDigestFingerprint(externalImage ExternalImage, imageDigest string) string {
+	if imageDigest != "fingerprint" || externalImage.Digest == "" {
+		return ""
+	}
+	algorithm, encoded, _ := strings.Cut(externalImage.Digest, ":")
+	if len(encoded) > fingerprintLength {
+		encoded = encoded[:fingerprintLength]
+	}
+	return algorithm + ":" + encoded
+}
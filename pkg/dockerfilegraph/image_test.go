@@ -0,0 +1,129 @@
+package dockerfilegraph
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testDigest = "sha256:4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1"
+
+func Test_withImageReference(t *testing.T) {
+	tests := []struct {
+		name          string
+		externalImage ExternalImage
+		want          ExternalImage
+	}{
+		{
+			name:          "official image",
+			externalImage: ExternalImage{ID: "alpine", Name: "alpine"},
+			want:          ExternalImage{ID: "alpine", Name: "alpine", Registry: "docker.io", Repository: "library/alpine"},
+		},
+		{
+			name:          "tag and digest",
+			externalImage: ExternalImage{ID: "alpine", Name: "alpine:3.23@" + testDigest},
+			want: ExternalImage{
+				ID: "alpine", Name: "alpine:3.23@" + testDigest,
+				Registry: "docker.io", Repository: "library/alpine", Tag: "3.23", Digest: testDigest,
+			},
+		},
+		{
+			name:          "registry with port",
+			externalImage: ExternalImage{ID: "app", Name: "localhost:5000/org/app:1.0"},
+			want: ExternalImage{
+				ID: "app", Name: "localhost:5000/org/app:1.0",
+				Registry: "localhost:5000", Repository: "org/app", Tag: "1.0",
+			},
+		},
+		{
+			name:          "unresolved ARG",
+			externalImage: ExternalImage{ID: "${BASE}", Name: "${BASE}"},
+			want:          ExternalImage{ID: "${BASE}", Name: "${BASE}"},
+		},
+		{
+			name:          "scratch",
+			externalImage: ExternalImage{ID: "scratch", Name: "scratch"},
+			want:          ExternalImage{ID: "scratch", Name: "scratch"},
+		},
+		{
+			name:          "directory",
+			externalImage: ExternalImage{ID: "src", Name: "src", Type: ExternalImageDirectory},
+			want:          ExternalImage{ID: "src", Name: "src", Type: ExternalImageDirectory},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := withImageReference(tt.externalImage)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("withImageReference() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_getExternalImageLabel(t *testing.T) {
+	pinned := withImageReference(ExternalImage{ID: "alpine", Name: "alpine:3.23@" + testDigest})
+	private := withImageReference(ExternalImage{ID: "app", Name: "ghcr.io/org/team/app:1.0"})
+	tests := []struct {
+		name          string
+		externalImage ExternalImage
+		opts          BuildOptions
+		wantLabel     string
+		wantBadge     string
+	}{
+		{
+			name:          "full",
+			externalImage: pinned,
+			opts:          BuildOptions{MaxLabelLength: 20},
+			wantLabel:     "alpine:3...44de311d1",
+		},
+		{
+			name:          "hidden digest",
+			externalImage: pinned,
+			opts:          BuildOptions{MaxLabelLength: 20, ImageDigest: "hide"},
+			wantLabel:     "alpine:3.23",
+		},
+		{
+			name:          "digest fingerprint",
+			externalImage: pinned,
+			opts:          BuildOptions{MaxLabelLength: 20, ImageDigest: "fingerprint"},
+			wantLabel:     "alpine:3.23",
+			wantBadge:     "sha256:4bcff63911fc",
+		},
+		{
+			name:          "short name",
+			externalImage: private,
+			opts:          BuildOptions{MaxLabelLength: 20, ImageName: "short"},
+			wantLabel:     "app:1.0",
+		},
+		{
+			name:          "short name with digest fingerprint",
+			externalImage: pinned,
+			opts:          BuildOptions{MaxLabelLength: 20, ImageName: "short", ImageDigest: "fingerprint"},
+			wantLabel:     "alpine:3.23",
+			wantBadge:     "sha256:4bcff63911fc",
+		},
+		{
+			name:          "fingerprint without digest",
+			externalImage: private,
+			opts:          BuildOptions{MaxLabelLength: 30, ImageDigest: "fingerprint"},
+			wantLabel:     "ghcr.io/org/team/app:1.0",
+		},
+		{
+			name:          "short name without reference",
+			externalImage: ExternalImage{ID: "${BASE}", Name: "${BASE}"},
+			opts:          BuildOptions{MaxLabelLength: 20, ImageName: "short"},
+			wantLabel:     "${BASE}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getExternalImageLabel(tt.externalImage, tt.opts); got != tt.wantLabel {
+				t.Errorf("getExternalImageLabel() = %q, want %q", got, tt.wantLabel)
+			}
+			if got := getDigestFingerprint(tt.externalImage, tt.opts.ImageDigest); got != tt.wantBadge {
+				t.Errorf("getDigestFingerprint() = %q, want %q", got, tt.wantBadge)
+			}
+		})
+	}
+}
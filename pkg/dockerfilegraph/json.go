@@ -0,0 +1,199 @@
+package dockerfilegraph
+
+import (
+	"encoding/json"
+)
+
+// JSONSchemaVersion is the version of the JSON document created by
+// BuildJSONFile. It is increased whenever a field is removed or its meaning
+// changes, but not when new fields are added.
+const JSONSchemaVersion = 2
+
+// JSONGraph is the root of the JSON document created by BuildJSONFile.
+type JSONGraph struct {
+	SchemaVersion    int                 `json:"schemaVersion"`
+	BeforeFirstStage []JSONLayer         `json:"beforeFirstStage"` // Instructions before the first FROM
+	Stages           []JSONStage         `json:"stages"`
+	ExternalImages   []JSONExternalImage `json:"externalImages"`
+	Services         []JSONService       `json:"services,omitempty"` // Docker Compose services
+}
+
+// JSONService is a Docker Compose service.
+type JSONService struct {
+	Name  string `json:"name"`
+	Stage int    `json:"stage"` // The index of the stage that the service builds
+}
+
+// JSONStage is a single build stage.
+type JSONStage struct {
+	Index         int              `json:"index"`
+	Name          string           `json:"name,omitempty"` // The part after the AS in the FROM line
+	File          string           `json:"file,omitempty"` // The Dockerfile of the stage in combined graphs
+	DefaultTarget bool             `json:"defaultTarget"`
+	Layers        []JSONLayer      `json:"layers"`
+	Source        *JSONSourceRange `json:"source,omitempty"`    // The lines from the FROM line to the last instruction
+	Platform      string           `json:"platform,omitempty"`  // The platform the stage runs on, with --platform
+	Emulated      bool             `json:"emulated,omitempty"`  // Whether the platform differs from the build platform
+	Platforms     []string         `json:"platforms,omitempty"` // The target platforms it is only built for
+
+	// The platforms it is emulated on if it runs natively on the others
+	EmulatedPlatforms []string `json:"emulatedPlatforms,omitempty"`
+	Unused            bool     `json:"unused,omitempty"` // Whether no target needs it, with --highlight-unused
+}
+
+// JSONLayer is a single instruction of a stage.
+type JSONLayer struct {
+	Label    string           `json:"label"`
+	WaitFors []JSONWaitFor    `json:"waitFors,omitempty"`
+	Source   *JSONSourceRange `json:"source,omitempty"`   // The lines of the instruction
+	Warnings []string         `json:"warnings,omitempty"` // Problems found in the instruction
+}
+
+// JSONSourceRange holds the lines of the Dockerfile, starting at 1.
+type JSONSourceRange struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// JSONWaitFor is an edge from a stage or an external image to a layer.
+type JSONWaitFor struct {
+	ID      string   `json:"id"`                // Stage name, stage index or external image ID
+	Type    string   `json:"type"`              // One of: add, copy, from, mount
+	Kind    string   `json:"kind"`              // One of: stage, externalImage
+	Stage   *int     `json:"stage,omitempty"`   // Index of the stage, if Kind is stage
+	Paths   []string `json:"paths,omitempty"`   // The paths copied from the build context, with --show-context
+	Ignored []string `json:"ignored,omitempty"` // The .dockerignore patterns that exclude some files of the paths
+
+	Checksum   string `json:"checksum,omitempty"`   // The --checksum of an ADD from a remote source
+	KeepGitDir bool   `json:"keepGitDir,omitempty"` // Whether an ADD from a Git repository keeps the .git directory
+
+	Mount *JSONMount       `json:"mount,omitempty"` // The options of a RUN --mount
+	Copy  *JSONCopyOptions `json:"copy,omitempty"`  // The paths and flags of a COPY or ADD
+
+	Platforms []string `json:"platforms,omitempty"` // The target platforms it only exists for
+}
+
+// JSONMount holds the options of a RUN --mount.
+type JSONMount struct {
+	Type    string `json:"type"` // One of: bind, cache, secret, ssh, tmpfs
+	ID      string `json:"id,omitempty"`
+	Target  string `json:"target,omitempty"`
+	From    string `json:"from,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Sharing string `json:"sharing,omitempty"` // One of: shared, private, locked
+}
+
+// JSONCopyOptions holds the paths and flags of a COPY or ADD.
+type JSONCopyOptions struct {
+	Sources     []string `json:"sources,omitempty"`
+	Destination string   `json:"destination,omitempty"`
+	Link        bool     `json:"link,omitempty"`
+	Parents     bool     `json:"parents,omitempty"`
+	Chown       string   `json:"chown,omitempty"`
+	Chmod       string   `json:"chmod,omitempty"`
+	Exclude     []string `json:"exclude,omitempty"`
+}
+
+// JSONExternalImage is an image that is not built by the Dockerfile.
+type JSONExternalImage struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"` // One of image, directory, url, git, cache, secret or ssh
+	Registry   string `json:"registry,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// BuildJSONFile serializes a simplified Dockerfile as an indented JSON
+// document, see JSONGraph for the schema.
+func BuildJSONFile(simplifiedDockerfile SimplifiedDockerfile) (string, error) {
+	graph := JSONGraph{
+		SchemaVersion:    JSONSchemaVersion,
+		BeforeFirstStage: jsonLayers(simplifiedDockerfile, simplifiedDockerfile.BeforeFirstStage),
+		Stages:           make([]JSONStage, 0, len(simplifiedDockerfile.Stages)),
+		ExternalImages:   make([]JSONExternalImage, 0, len(simplifiedDockerfile.ExternalImages)),
+	}
+
+	for stageIndex, stage := range simplifiedDockerfile.Stages {
+		graph.Stages = append(graph.Stages, JSONStage{
+			Index:             stageIndex,
+			Name:              stage.Name,
+			File:              stage.File,
+			DefaultTarget:     isDefaultTarget(simplifiedDockerfile.Stages, stageIndex),
+			Layers:            jsonLayers(simplifiedDockerfile, stage.Layers),
+			Source:            jsonSourceRange(stage.Source),
+			Platform:          stage.Platform,
+			Emulated:          stage.Emulated,
+			EmulatedPlatforms: stage.EmulatedPlatforms,
+			Platforms:         stage.Platforms,
+			Unused:            stage.Unused,
+		})
+	}
+
+	for _, externalImage := range simplifiedDockerfile.ExternalImages {
+		graph.ExternalImages = append(graph.ExternalImages, JSONExternalImage{
+			ID:         externalImage.ID,
+			Name:       externalImage.Name,
+			Type:       externalImage.Type.String(),
+			Registry:   externalImage.Registry,
+			Repository: externalImage.Repository,
+			Tag:        externalImage.Tag,
+			Digest:     externalImage.Digest,
+		})
+	}
+
+	for _, service := range simplifiedDockerfile.Services {
+		graph.Services = append(graph.Services, JSONService(service))
+	}
+
+	b, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+func jsonLayers(simplifiedDockerfile SimplifiedDockerfile, layers []Layer) []JSONLayer {
+	jsonLayers := make([]JSONLayer, 0, len(layers))
+	for _, layer := range layers {
+		jsonLayer := JSONLayer{Label: layer.Label, Source: jsonSourceRange(layer.Source), Warnings: layer.Warnings}
+		for _, waitFor := range layer.WaitFors {
+			jsonWaitFor := JSONWaitFor{
+				ID:      waitFor.ID,
+				Type:    waitFor.Type.String(),
+				Kind:    "externalImage",
+				Paths:   waitFor.Paths,
+				Ignored: waitFor.Ignored,
+
+				Checksum:   waitFor.Checksum,
+				KeepGitDir: waitFor.KeepGitDir,
+
+				Platforms: waitFor.Platforms,
+			}
+			if waitFor.Mount != nil {
+				jsonMount := JSONMount(*waitFor.Mount)
+				jsonWaitFor.Mount = &jsonMount
+			}
+			if waitFor.Copy != nil {
+				jsonCopyOptions := JSONCopyOptions(*waitFor.Copy)
+				jsonWaitFor.Copy = &jsonCopyOptions
+			}
+			if stageIndex, found := findWaitForStage(simplifiedDockerfile.Stages, waitFor.ID); found {
+				jsonWaitFor.Kind = "stage"
+				jsonWaitFor.Stage = &stageIndex
+			}
+			jsonLayer.WaitFors = append(jsonLayer.WaitFors, jsonWaitFor)
+		}
+		jsonLayers = append(jsonLayers, jsonLayer)
+	}
+	return jsonLayers
+}
+
+// jsonSourceRange returns nil if the location is unknown.
+func jsonSourceRange(source SourceRange) *JSONSourceRange {
+	if source.StartLine == 0 {
+		return nil
+	}
+	return &JSONSourceRange{StartLine: source.StartLine, EndLine: source.EndLine}
+}
@@ -0,0 +1,163 @@
+package dockerfilegraph
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildJSONFile(t *testing.T) {
+	tests := []struct {
+		name                 string
+		simplifiedDockerfile SimplifiedDockerfile
+		want                 string
+	}{
+		{
+			name: "empty",
+			want: `{
+  "schemaVersion": 2,
+  "beforeFirstStage": [],
+  "stages": [],
+  "externalImages": []
+}
+`,
+		},
+		{
+			name: "stages, layers and external images",
+			simplifiedDockerfile: SimplifiedDockerfile{
+				BeforeFirstStage: []Layer{{Label: "ARG VERSION=1"}},
+				ExternalImages: []ExternalImage{
+					{ID: "ubuntu", Name: "ubuntu"},
+					{ID: "buildcache", Name: "buildcache"},
+				},
+				Stages: []Stage{
+					{
+						Name: "base",
+						Layers: []Layer{{
+							Label:    "FROM ubuntu AS base",
+							WaitFors: []WaitFor{{ID: "ubuntu", Type: WaitForFrom}},
+						}},
+					},
+					{
+						Layers: []Layer{
+							{Label: "FROM scratch"},
+							{
+								Label: "COPY --from=0 . .",
+								WaitFors: []WaitFor{{
+									ID:   "0",
+									Type: WaitForCopy,
+									Copy: &CopyOptions{Sources: []string{"."}, Destination: ".", Link: true},
+								}},
+								Source: SourceRange{StartLine: 4, EndLine: 5},
+							},
+							{
+								Label: "RUN --mount=from=buildcache",
+								WaitFors: []WaitFor{{
+									ID:    "buildcache",
+									Type:  WaitForMount,
+									Mount: &Mount{Type: "bind", From: "buildcache"},
+								}},
+							},
+						},
+					},
+				},
+			},
+			want: `{
+  "schemaVersion": 2,
+  "beforeFirstStage": [
+    {
+      "label": "ARG VERSION=1"
+    }
+  ],
+  "stages": [
+    {
+      "index": 0,
+      "name": "base",
+      "defaultTarget": false,
+      "layers": [
+        {
+          "label": "FROM ubuntu AS base",
+          "waitFors": [
+            {
+              "id": "ubuntu",
+              "type": "from",
+              "kind": "externalImage"
+            }
+          ]
+        }
+      ]
+    },
+    {
+      "index": 1,
+      "defaultTarget": true,
+      "layers": [
+        {
+          "label": "FROM scratch"
+        },
+        {
+          "label": "COPY --from=0 . .",
+          "waitFors": [
+            {
+              "id": "0",
+              "type": "copy",
+              "kind": "stage",
+              "stage": 0,
+              "copy": {
+                "sources": [
+                  "."
+                ],
+                "destination": ".",
+                "link": true
+              }
+            }
+          ],
+          "source": {
+            "startLine": 4,
+            "endLine": 5
+          }
+        },
+        {
+          "label": "RUN --mount=from=buildcache",
+          "waitFors": [
+            {
+              "id": "buildcache",
+              "type": "mount",
+              "kind": "externalImage",
+              "mount": {
+                "type": "bind",
+                "from": "buildcache"
+              }
+            }
+          ]
+        }
+      ]
+    }
+  ],
+  "externalImages": [
+    {
+      "id": "ubuntu",
+      "name": "ubuntu",
+      "type": "image"
+    },
+    {
+      "id": "buildcache",
+      "name": "buildcache",
+      "type": "image"
+    }
+  ]
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildJSONFile(tt.simplifiedDockerfile)
+			if err != nil {
+				t.Fatalf("BuildJSONFile() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("BuildJSONFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package dockerfilegraph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LintRule is a check of the build graph that Lint runs.
+type LintRule struct {
+	ID          string
+	Level       string // The SARIF level of its findings: error or warning
+	Description string
+}
+
+// LintRules are the rules that Lint checks, in the order of their findings.
+var LintRules = []LintRule{
+	{"unreachable-stage", "warning", "Stages that no target needs are never built"},
+	{"image-without-digest", "warning", "Images used by tag without a digest can change without notice"},
+	{"latest-tag", "warning", "The latest tag, explicit or implicit, makes builds unreproducible"},
+	{"duplicate-base-image", "warning", "Stages with the same base image could share a common stage"},
+	{"numeric-stage-reference", "warning", "A stage referenced by its index breaks when stages are added or removed"},
+	{"undefined-stage", "error", "A reference to a stage that does not exist is pulled as an image instead"},
+}
+
+// Finding is a problem found by Lint.
+type Finding struct {
+	Rule    string      // The ID of the LintRule
+	Message string      // What is wrong, e.g. which image has no digest
+	File    string      // The Dockerfile of the stage in combined graphs
+	Source  SourceRange // The lines of the stage or the instruction
+}
+
+// Lint checks the build graph for problems. Stages are reachable if one of
+// the targets needs them, or one of the default targets without targets.
+// The Dockerfile must be parsed without ParseOptions.Targets, so that it
+// still contains the stages that no target needs.
+func Lint(simplifiedDockerfile SimplifiedDockerfile, targets []string) ([]Finding, error) {
+	stages := simplifiedDockerfile.Stages
+
+	targetIndices, err := targetIndicesOrDefault(stages, targets)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	findings = append(findings, lintUnreachableStages(stages, targetIndices)...)
+	findings = append(findings, lintImageTags(simplifiedDockerfile)...)
+	findings = append(findings, lintDuplicateBaseImages(simplifiedDockerfile)...)
+	findings = append(findings, lintStageReferences(simplifiedDockerfile)...)
+	return findings, nil
+}
+
+func lintUnreachableStages(stages []Stage, targetIndices []int) []Finding {
+	reachable := collectReachableIndices(stages, targetIndices)
+
+	var findings []Finding
+	for stageIndex, stage := range stages {
+		if _, ok := reachable[stageIndex]; ok {
+			continue
+		}
+		findings = append(findings, Finding{
+			Rule:    "unreachable-stage",
+			Message: fmt.Sprintf("stage %s is not needed by any target", getStageLabel(stages, stageIndex, 0)),
+			File:    stage.File,
+			Source:  stage.Source,
+		})
+	}
+	return findings
+}
+
+// lintImageTags finds the uses of images without a digest or with the latest
+// tag. Images without a parsed reference, e.g. scratch or names with an
+// unresolved ARG, and stage indices beyond the last stage are skipped.
+func lintImageTags(simplifiedDockerfile SimplifiedDockerfile) []Finding {
+	var withoutDigest, latest []Finding
+	forEachImageUse(simplifiedDockerfile, func(stageIndex int, layer Layer, waitFor WaitFor, image ExternalImage) {
+		if image.Repository == "" || image.Digest != "" {
+			return
+		}
+		if _, err := strconv.Atoi(waitFor.ID); err == nil && waitFor.Type != WaitForFrom {
+			return
+		}
+		finding := Finding{File: simplifiedDockerfile.Stages[stageIndex].File, Source: layer.Source}
+
+		finding.Rule = "image-without-digest"
+		finding.Message = fmt.Sprintf("image %s is used without a digest", image.Name)
+		if image.Tag != "" {
+			finding.Message = fmt.Sprintf("image %s is used by tag without a digest", image.Name)
+		}
+		withoutDigest = append(withoutDigest, finding)
+
+		switch image.Tag {
+		case "latest":
+			finding.Rule = "latest-tag"
+			finding.Message = fmt.Sprintf("image %s uses the latest tag", image.Name)
+			latest = append(latest, finding)
+		case "":
+			finding.Rule = "latest-tag"
+			finding.Message = fmt.Sprintf("image %s implicitly uses the latest tag", image.Name)
+			latest = append(latest, finding)
+		}
+	})
+	return append(withoutDigest, latest...)
+}
+
+// lintDuplicateBaseImages finds stages that are based on the same image as
+// an earlier stage.
+func lintDuplicateBaseImages(simplifiedDockerfile SimplifiedDockerfile) []Finding {
+	firstStages := make(map[string]int)
+
+	var findings []Finding
+	forEachImageUse(simplifiedDockerfile, func(stageIndex int, layer Layer, waitFor WaitFor, image ExternalImage) {
+		if waitFor.Type != WaitForFrom || image.Type != ExternalImageRegistry || image.Name == "scratch" {
+			return
+		}
+		stage := simplifiedDockerfile.Stages[stageIndex]
+
+		key := normalizeImageName(image.Name)
+		firstStageIndex, ok := firstStages[key]
+		if !ok {
+			firstStages[key] = stageIndex
+			return
+		}
+		findings = append(findings, Finding{
+			Rule: "duplicate-base-image",
+			Message: fmt.Sprintf(
+				"stage %s uses the same base image %s as stage %s",
+				getStageLabel(simplifiedDockerfile.Stages, stageIndex, 0), image.Name,
+				getStageLabel(simplifiedDockerfile.Stages, firstStageIndex, 0),
+			),
+			File:   stage.File,
+			Source: layer.Source,
+		})
+	})
+	return findings
+}
+
+// lintStageReferences finds COPY --from and RUN --mount from references to
+// stages by their index, and FROM, COPY --from and RUN --mount from
+// references that were probably meant to be a stage, see
+// undefinedStageReference.
+func lintStageReferences(simplifiedDockerfile SimplifiedDockerfile) []Finding {
+	stages := simplifiedDockerfile.Stages
+
+	var numeric, undefined []Finding
+	for _, stage := range stages {
+		for _, layer := range stage.Layers {
+			for _, waitFor := range layer.WaitFors {
+				finding := Finding{File: stage.File, Source: layer.Source}
+				if message, ok := undefinedStageReference(simplifiedDockerfile, waitFor); ok {
+					finding.Rule = "undefined-stage"
+					finding.Message = message
+					undefined = append(undefined, finding)
+					continue
+				}
+				if waitFor.Type != WaitForCopy && waitFor.Type != WaitForMount {
+					continue
+				}
+				if index, err := strconv.Atoi(waitFor.ID); err == nil {
+					finding.Rule = "numeric-stage-reference"
+					finding.Message = fmt.Sprintf(
+						"stage %s is referenced by its index %d instead of a name",
+						getStageLabel(stages, index, 0), index,
+					)
+					numeric = append(numeric, finding)
+				}
+			}
+		}
+	}
+	return append(numeric, undefined...)
+}
+
+// undefinedStageReference returns why a FROM, COPY --from or RUN --mount
+// from reference was probably meant to be a stage that does not exist: an
+// index beyond the last stage, or a plain name like biuld that is close to
+// the name of a stage. Both are pulled as images instead. FROM does not
+// accept stage indices, so only names are checked there.
+func undefinedStageReference(simplifiedDockerfile SimplifiedDockerfile, waitFor WaitFor) (string, bool) {
+	if waitFor.Type != WaitForFrom && waitFor.Type != WaitForCopy && waitFor.Type != WaitForMount {
+		return "", false
+	}
+	stages := simplifiedDockerfile.Stages
+
+	if index, err := strconv.Atoi(waitFor.ID); err == nil && waitFor.Type != WaitForFrom {
+		if index >= 0 && index < len(stages) {
+			return "", false
+		}
+		return fmt.Sprintf("stage %d does not exist, the Dockerfile has %d stages", index, len(stages)), true
+	}
+
+	image, ok := findImage(simplifiedDockerfile.ExternalImages, waitFor.ID)
+	if !ok || image.Type != ExternalImageRegistry || image.Name != waitFor.ID ||
+		strings.ContainsAny(waitFor.ID, "/:@") || image.Repository == "" {
+		return "", false
+	}
+	for _, stage := range stages {
+		if isTypo(waitFor.ID, stage.Name) {
+			return fmt.Sprintf(
+				"there is no stage %s, did you mean %s? It is pulled as an image instead", waitFor.ID, stage.Name,
+			), true
+		}
+	}
+	return "", false
+}
+
+// isTypo returns true if reference is probably a typo of the name of a stage.
+// The number of allowed typos grows with the length of the name, one for
+// every three characters. Short names like app are too similar to the names
+// of images to tell, so they never match.
+func isTypo(reference, name string) bool {
+	return len(name) > 3 && typoDistance(reference, name) <= len(name)/3
+}
+
+// typoDistance returns the number of inserted, deleted, substituted and
+// swapped adjacent characters that turn a into b, so that biuld is one typo
+// away from build.
+func typoDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+// forEachImageUse calls fn for each WaitFor of an external image.
+func forEachImageUse(
+	simplifiedDockerfile SimplifiedDockerfile, fn func(stageIndex int, layer Layer, waitFor WaitFor, image ExternalImage),
+) {
+	for stageIndex, stage := range simplifiedDockerfile.Stages {
+		for _, layer := range stage.Layers {
+			for _, waitFor := range layer.WaitFors {
+				if image, ok := findImage(simplifiedDockerfile.ExternalImages, waitFor.ID); ok {
+					fn(stageIndex, layer, waitFor, image)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package dockerfilegraph
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testPinnedAlpine = "alpine:3.23@sha256:4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1"
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		targets    []string
+		want       []Finding
+		wantErr    bool
+	}{
+		{
+			name:       "no problems",
+			dockerfile: "FROM " + testPinnedAlpine + " AS build\nRUN make\n\nFROM scratch\nCOPY --from=build /app /app\n",
+		},
+		{
+			name:       "unreachable stage",
+			dockerfile: "FROM scratch AS test\n\nFROM scratch AS release\n",
+			want: []Finding{
+				{Rule: "unreachable-stage", Message: "stage test is not needed by any target", Source: SourceRange{1, 1}},
+			},
+		},
+		{
+			name:       "unreachable stage with a target",
+			dockerfile: "FROM scratch AS test\n\nFROM scratch AS release\n",
+			targets:    []string{"test"},
+			want: []Finding{
+				{Rule: "unreachable-stage", Message: "stage release is not needed by any target", Source: SourceRange{3, 3}},
+			},
+		},
+		{
+			name:       "unknown target",
+			dockerfile: "FROM scratch AS release\n",
+			targets:    []string{"test"},
+			wantErr:    true,
+		},
+		{
+			name:       "images without digest and with the latest tag",
+			dockerfile: "FROM alpine:3.23 AS build\nFROM ubuntu:latest AS tools\nCOPY --from=build / /\nFROM tools\n",
+			want: []Finding{
+				{
+					Rule: "image-without-digest", Message: "image alpine:3.23 is used by tag without a digest",
+					Source: SourceRange{1, 1},
+				},
+				{
+					Rule: "image-without-digest", Message: "image ubuntu:latest is used by tag without a digest",
+					Source: SourceRange{2, 2},
+				},
+				{Rule: "latest-tag", Message: "image ubuntu:latest uses the latest tag", Source: SourceRange{2, 2}},
+			},
+		},
+		{
+			name:       "implicit latest tag",
+			dockerfile: "FROM alpine\n",
+			want: []Finding{
+				{Rule: "image-without-digest", Message: "image alpine is used without a digest", Source: SourceRange{1, 1}},
+				{Rule: "latest-tag", Message: "image alpine implicitly uses the latest tag", Source: SourceRange{1, 1}},
+			},
+		},
+		{
+			name: "duplicate base image",
+			dockerfile: "FROM " + testPinnedAlpine + " AS build\n" +
+				"FROM " + testPinnedAlpine + "\nCOPY --from=build / /\n",
+			want: []Finding{
+				{
+					Rule:    "duplicate-base-image",
+					Message: "stage 1 uses the same base image " + testPinnedAlpine + " as stage build",
+					Source:  SourceRange{2, 2},
+				},
+			},
+		},
+		{
+			name:       "numeric stage reference",
+			dockerfile: "FROM scratch AS build\nFROM scratch\nCOPY --from=0 / /\n",
+			want: []Finding{
+				{
+					Rule: "numeric-stage-reference", Message: "stage build is referenced by its index 0 instead of a name",
+					Source: SourceRange{3, 3},
+				},
+			},
+		},
+		{
+			name: "undefined stages",
+			dockerfile: "FROM scratch AS build\nFROM scratch\nCOPY --from=biuld / /\nCOPY --from=5 / /\n" +
+				"RUN --mount=from=bulid,target=/src make\nCOPY --from=build / /\n",
+			want: []Finding{
+				{Rule: "image-without-digest", Message: "image biuld is used without a digest", Source: SourceRange{3, 3}},
+				{Rule: "image-without-digest", Message: "image bulid is used without a digest", Source: SourceRange{5, 5}},
+				{Rule: "latest-tag", Message: "image biuld implicitly uses the latest tag", Source: SourceRange{3, 3}},
+				{Rule: "latest-tag", Message: "image bulid implicitly uses the latest tag", Source: SourceRange{5, 5}},
+				{
+					Rule:    "undefined-stage",
+					Message: "there is no stage biuld, did you mean build? It is pulled as an image instead",
+					Source:  SourceRange{3, 3},
+				},
+				{
+					Rule: "undefined-stage", Message: "stage 5 does not exist, the Dockerfile has 2 stages",
+					Source: SourceRange{4, 4},
+				},
+				{
+					Rule:    "undefined-stage",
+					Message: "there is no stage bulid, did you mean build? It is pulled as an image instead",
+					Source:  SourceRange{5, 5},
+				},
+			},
+		},
+		{
+			name:       "undefined stage in FROM",
+			dockerfile: "FROM scratch AS build\nFROM biuld\nRUN make\n",
+			want: []Finding{
+				{
+					Rule: "unreachable-stage", Message: "stage build is not needed by any target",
+					Source: SourceRange{1, 1},
+				},
+				{Rule: "image-without-digest", Message: "image biuld is used without a digest", Source: SourceRange{2, 2}},
+				{Rule: "latest-tag", Message: "image biuld implicitly uses the latest tag", Source: SourceRange{2, 2}},
+				{
+					Rule:    "undefined-stage",
+					Message: "there is no stage biuld, did you mean build? It is pulled as an image instead",
+					Source:  SourceRange{2, 2},
+				},
+			},
+		},
+		{
+			name:       "short stage names",
+			dockerfile: "FROM php AS base\nFROM base AS app\nFROM php\n",
+			want: []Finding{
+				{Rule: "unreachable-stage", Message: "stage base is not needed by any target", Source: SourceRange{1, 1}},
+				{Rule: "unreachable-stage", Message: "stage app is not needed by any target", Source: SourceRange{2, 2}},
+				{Rule: "image-without-digest", Message: "image php is used without a digest", Source: SourceRange{1, 1}},
+				{Rule: "image-without-digest", Message: "image php is used without a digest", Source: SourceRange{3, 3}},
+				{Rule: "latest-tag", Message: "image php implicitly uses the latest tag", Source: SourceRange{1, 1}},
+				{Rule: "latest-tag", Message: "image php implicitly uses the latest tag", Source: SourceRange{3, 3}},
+				{
+					Rule: "duplicate-base-image", Message: "stage 2 uses the same base image php as stage base",
+					Source: SourceRange{3, 3},
+				},
+			},
+		},
+		{
+			name: "image that is not similar to a stage",
+			dockerfile: "FROM scratch AS build\nFROM scratch\nCOPY --from=busybox:1.36 /bin/busybox /bin/\n" +
+				"COPY --from=build / /\n",
+			want: []Finding{
+				{
+					Rule: "image-without-digest", Message: "image busybox:1.36 is used by tag without a digest",
+					Source: SourceRange{3, 3},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sdf, err := dockerfileToSimplifiedDockerfile([]byte(tt.dockerfile), ParseOptions{MaxLabelLength: 20})
+			if err != nil {
+				t.Fatalf("dockerfileToSimplifiedDockerfile() error = %v", err)
+			}
+			got, err := Lint(sdf, tt.targets)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Lint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Lint() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBuildSARIFFile(t *testing.T) {
+	got, err := BuildSARIFFile([]Finding{
+		{Rule: "undefined-stage", Message: "stage 5 does not exist", File: "Dockerfile", Source: SourceRange{4, 4}},
+		{Rule: "latest-tag", Message: "image alpine implicitly uses the latest tag"},
+	}, "v1.0.0")
+	if err != nil {
+		t.Fatalf("BuildSARIFFile() error = %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal([]byte(got), &log); err != nil {
+		t.Fatalf("BuildSARIFFile() returned invalid JSON: %v", err)
+	}
+	want := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Results: []sarifResult{
+				{
+					RuleID: "undefined-stage", Level: "error", Message: sarifMessage{Text: "stage 5 does not exist"},
+					Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: &sarifArtifactLocation{URI: "Dockerfile"},
+						Region:           &sarifRegion{StartLine: 4, EndLine: 4},
+					}}},
+				},
+				{
+					RuleID: "latest-tag", Level: "warning",
+					Message: sarifMessage{Text: "image alpine implicitly uses the latest tag"},
+				},
+			},
+		}},
+	}
+	if diff := cmp.Diff(want.Runs[0].Results, log.Runs[0].Results); diff != "" {
+		t.Errorf("BuildSARIFFile() results mismatch (-want +got):\n%s", diff)
+	}
+	if log.Schema != want.Schema || log.Version != want.Version {
+		t.Errorf("BuildSARIFFile() = %s %s, want %s %s", log.Schema, log.Version, want.Schema, want.Version)
+	}
+	if driver := log.Runs[0].Tool.Driver; driver.Version != "v1.0.0" || len(driver.Rules) != len(LintRules) {
+		t.Errorf("BuildSARIFFile() driver = %+v, want version v1.0.0 and %d rules", driver, len(LintRules))
+	}
+}
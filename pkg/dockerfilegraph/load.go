@@ -0,0 +1,104 @@
+package dockerfilegraph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// LoadAndParseDockerfile looks for the Dockerfile and returns a
+// SimplifiedDockerfile.
+func LoadAndParseDockerfile(
+	ctx context.Context,
+	inputFS afero.Fs,
+	filename string,
+	opts ParseOptions,
+) (SimplifiedDockerfile, error) {
+	if err := ctx.Err(); err != nil {
+		return SimplifiedDockerfile{}, err
+	}
+	content, err := afero.ReadFile(inputFS, filename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			absFilePath, absErr := filepath.Abs(filename)
+			if absErr != nil {
+				return SimplifiedDockerfile{}, fmt.Errorf("could not get absolute path for %q: %w", filename, absErr)
+			}
+			return SimplifiedDockerfile{}, errors.New("could not find a Dockerfile at " + absFilePath)
+		}
+		return SimplifiedDockerfile{}, err
+	}
+	sdf, err := parseDockerfile(ctx, content, opts)
+	if err != nil || !opts.ShowContext {
+		return sdf, err
+	}
+	if err := applyDockerignore(inputFS, filename, opts.ContextDir, &sdf); err != nil {
+		return SimplifiedDockerfile{}, err
+	}
+	return sdf, nil
+}
+
+// ParseDockerfile reads a Dockerfile from r and returns a
+// SimplifiedDockerfile. It is useful when the Dockerfile does not exist on
+// disk, e.g. when it is read from stdin or generated from a template.
+func ParseDockerfile(ctx context.Context, r io.Reader, opts ParseOptions) (SimplifiedDockerfile, error) {
+	if err := ctx.Err(); err != nil {
+		return SimplifiedDockerfile{}, err
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return SimplifiedDockerfile{}, fmt.Errorf("could not read the Dockerfile: %w", err)
+	}
+	return parseDockerfile(ctx, content, opts)
+}
+
+// ParseDockerfileInContext is like ParseDockerfile, but with
+// ParseOptions.ShowContext, it also applies the .dockerignore in the root of
+// ParseOptions.ContextDir, the current directory by default, like docker
+// build does for a Dockerfile that is read from stdin.
+func ParseDockerfileInContext(
+	ctx context.Context, inputFS afero.Fs, r io.Reader, opts ParseOptions,
+) (SimplifiedDockerfile, error) {
+	sdf, err := ParseDockerfile(ctx, r, opts)
+	if err != nil || !opts.ShowContext {
+		return sdf, err
+	}
+	if err := applyDockerignore(inputFS, "", opts.ContextDir, &sdf); err != nil {
+		return SimplifiedDockerfile{}, err
+	}
+	return sdf, nil
+}
+
+// parseDockerfile converts the content of a Dockerfile and applies the
+// target filter, or marks the unused stages. Reading from a slow source may
+// take a while, so the context is checked again before parsing.
+func parseDockerfile(ctx context.Context, content []byte, opts ParseOptions) (SimplifiedDockerfile, error) {
+	if err := ctx.Err(); err != nil {
+		return SimplifiedDockerfile{}, err
+	}
+	var sdf SimplifiedDockerfile
+	var err error
+	if len(opts.Platforms) > 0 {
+		sdf, err = parsePlatformVariants(content, opts)
+	} else {
+		sdf, err = dockerfileToSimplifiedDockerfile(content, opts)
+	}
+	if err != nil {
+		return SimplifiedDockerfile{}, err
+	}
+	switch {
+	case opts.HighlightUnused:
+		sdf, err = MarkUnusedStages(sdf, opts.Targets)
+	case len(opts.Targets) > 0:
+		sdf, err = FilterToTargets(sdf, opts.Targets)
+	}
+	if err != nil {
+		return SimplifiedDockerfile{}, err
+	}
+	return sdf, nil
+}
@@ -0,0 +1,127 @@
+package dockerfilegraph
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// TestLoadAndParseDockerfile tests the file loading functionality of LoadAndParseDockerfile.
+// This test focuses on file I/O concerns (file not found, path resolution) rather than
+// Dockerfile parsing logic, which is tested in convert_test.go.
+func TestLoadAndParseDockerfile(t *testing.T) {
+	type args struct {
+		ctx      context.Context
+		inputFS  afero.Fs
+		filename string
+	}
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dockerfileFS := afero.NewMemMapFs()
+	_ = afero.WriteFile(dockerfileFS, "Dockerfile", []byte(`FROM scratch`), 0o644)
+
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "Dockerfile not found",
+			args: args{
+				ctx:      context.Background(),
+				inputFS:  dockerfileFS,
+				filename: "missing/Dockerfile",
+			},
+			wantErr: true,
+		},
+		{
+			name: "canceled context",
+			args: args{
+				ctx:      canceledCtx,
+				inputFS:  dockerfileFS,
+				filename: "Dockerfile",
+			},
+			wantErr: true,
+		},
+		{
+			name: "should work in the current working directory",
+			args: args{
+				ctx:      context.Background(),
+				inputFS:  dockerfileFS,
+				filename: "Dockerfile",
+			},
+			wantErr: false,
+		},
+		{
+			name: "should work in any directory",
+			args: args{
+				ctx:      context.Background(),
+				inputFS:  dockerfileFS,
+				filename: "subdir/../Dockerfile",
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadAndParseDockerfile(
+				tt.args.ctx,
+				tt.args.inputFS,
+				tt.args.filename,
+				ParseOptions{MaxLabelLength: 20},
+			)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadAndParseDockerfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("read failed") }
+
+// TestParseDockerfile tests reading a Dockerfile from an io.Reader.
+func TestParseDockerfile(t *testing.T) {
+	tests := []struct {
+		name       string
+		reader     io.Reader
+		wantStages int
+		wantErr    bool
+	}{
+		{
+			name:       "should parse the content of the reader",
+			reader:     strings.NewReader("FROM alpine AS build\nFROM scratch\n"),
+			wantStages: 2,
+		},
+		{
+			name:    "should return read errors",
+			reader:  errReader{},
+			wantErr: true,
+		},
+		{
+			name:    "should return parse errors",
+			reader:  strings.NewReader(" "),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDockerfile(context.Background(), tt.reader, ParseOptions{MaxLabelLength: 20})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDockerfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got.Stages) != tt.wantStages {
+				t.Errorf("ParseDockerfile() got %d stages, want %d", len(got.Stages), tt.wantStages)
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package dockerfilegraph
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const mermaidIndent = "    "
+
+// BuildMermaidFile builds a Mermaid flowchart from a simplified Dockerfile.
+// The result mirrors the graph produced by BuildDotFile, but can be rendered
+// natively by Markdown viewers such as GitHub or GitLab.
+func BuildMermaidFile(
+	simplifiedDockerfile SimplifiedDockerfile,
+	opts BuildOptions,
+) (string, error) {
+	var b strings.Builder
+
+	b.WriteString("flowchart LR\n")
+
+	// Add the legend if requested
+	if opts.Legend {
+		addMermaidLegend(&b, opts.EdgeStyle, hasWaitForType(simplifiedDockerfile, WaitForAdd))
+	}
+
+	externalImageIDs := make([]string, 0, len(simplifiedDockerfile.ExternalImages))
+	for externalImageIndex, externalImage := range simplifiedDockerfile.ExternalImages {
+		nodeID := fmt.Sprintf("external_image_%d", externalImageIndex)
+		externalImageIDs = append(externalImageIDs, nodeID)
+		// The shapes are as close as possible to the ones of Graphviz:
+		// folders are parallelograms, notes flags and components subroutines.
+		shape := "(%s)"
+		switch externalImage.Type {
+		case ExternalImageDirectory:
+			shape = "[/%s/]"
+		case ExternalImageURL:
+			shape = ">%s]"
+		case ExternalImageGit:
+			shape = "[[%s]]"
+		case ExternalImageCache:
+			shape = "[(%s)]"
+		case ExternalImageSecret:
+			shape = "{{%s}}"
+		case ExternalImageSSH:
+			shape = "[/%s\\]"
+		}
+		fmt.Fprintf(
+			&b, "%s%s"+shape+"\n",
+			mermaidIndent, nodeID,
+			mermaidBadgeLabel(
+				getExternalImageLabel(externalImage, opts), getDigestFingerprint(externalImage, opts.ImageDigest),
+			),
+		)
+	}
+
+	if err := addMermaidStages(&b, simplifiedDockerfile, opts); err != nil {
+		return "", err
+	}
+
+	// Add the ARGS that appear before the first stage, if layers are requested
+	if opts.Layers && len(simplifiedDockerfile.BeforeFirstStage) > 0 {
+		fmt.Fprintf(
+			&b, "%ssubgraph cluster_before_first_stage [%s]\n",
+			mermaidIndent, mermaidLabel("Before First Stage"),
+		)
+		for argIndex, arg := range simplifiedDockerfile.BeforeFirstStage {
+			fmt.Fprintf(
+				&b, "%s%sbefore_first_stage_%d(%s)\n",
+				mermaidIndent, mermaidIndent, argIndex, mermaidLabel(arg.Label),
+			)
+			addMermaidClick(
+				&b, mermaidIndent+mermaidIndent, fmt.Sprintf("before_first_stage_%d", argIndex),
+				getSourceLink(opts.LinkPrefix, arg.Source),
+			)
+		}
+		fmt.Fprintf(&b, "%send\n", mermaidIndent)
+	}
+
+	serviceIDs, err := addMermaidServices(&b, simplifiedDockerfile, opts.Layers)
+	if err != nil {
+		return "", err
+	}
+
+	// Style the external images and the default build target
+	fmt.Fprintf(
+		&b, "%sclassDef externalImage stroke:%s,color:%s,stroke-dasharray:5 5\n",
+		mermaidIndent, hexGrey20, hexGrey20,
+	)
+	fmt.Fprintf(&b, "%sclassDef defaultTarget fill:%s\n", mermaidIndent, hexGrey90)
+	if len(externalImageIDs) > 0 {
+		fmt.Fprintf(
+			&b, "%sclass %s externalImage\n",
+			mermaidIndent, strings.Join(externalImageIDs, ","),
+		)
+	}
+	if len(serviceIDs) > 0 {
+		fmt.Fprintf(&b, "%sclassDef service stroke-width:2px\n", mermaidIndent)
+		fmt.Fprintf(&b, "%sclass %s service\n", mermaidIndent, strings.Join(serviceIDs, ","))
+	}
+	addMermaidUnusedStyles(&b, simplifiedDockerfile.Stages, opts.Layers)
+	for stageIndex := range simplifiedDockerfile.Stages {
+		if !isDefaultTarget(simplifiedDockerfile.Stages, stageIndex) {
+			continue
+		}
+		if opts.Layers {
+			fmt.Fprintf(
+				&b, "%sstyle cluster_stage_%d fill:%s\n",
+				mermaidIndent, stageIndex, hexGrey90,
+			)
+		} else {
+			fmt.Fprintf(&b, "%sclass stage_%d defaultTarget\n", mermaidIndent, stageIndex)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func addMermaidStages(
+	b *strings.Builder,
+	simplifiedDockerfile SimplifiedDockerfile,
+	opts BuildOptions,
+) error {
+	// In combined graphs, the edges are added after all Dockerfiles, because
+	// Mermaid moves a node into the subgraph in which it is used first.
+	files, fileClusterIDs := fileClusters(simplifiedDockerfile.Stages)
+	edges := b
+	if len(files) > 0 {
+		edges = &strings.Builder{}
+	}
+
+	for stageIndex, stage := range simplifiedDockerfile.Stages {
+		indent := mermaidIndent
+		if stage.File != "" {
+			indent += mermaidIndent
+			if stageIndex == 0 || simplifiedDockerfile.Stages[stageIndex-1].File != stage.File {
+				fmt.Fprintf(
+					b, "%ssubgraph %s [%s]\n",
+					mermaidIndent, fileClusterIDs[stage.File], mermaidLabel(stage.File),
+				)
+			}
+		}
+
+		if opts.Layers {
+			fmt.Fprintf(
+				b, "%ssubgraph cluster_stage_%d [%s]\n",
+				indent, stageIndex, mermaidLabel(getStageClusterLabel(simplifiedDockerfile.Stages, stageIndex)),
+			)
+			for layerIndex, layer := range stage.Layers {
+				fmt.Fprintf(
+					b, "%s%sstage_%d_layer_%d(%s)\n",
+					indent, mermaidIndent, stageIndex, layerIndex, mermaidLabel(layer.Label),
+				)
+				addMermaidClick(
+					b, indent+mermaidIndent, fmt.Sprintf("stage_%d_layer_%d", stageIndex, layerIndex),
+					getSourceLink(getStageLinkPrefix(opts.LinkPrefix, stage), layer.Source),
+				)
+
+				// Add edges between layers to guarantee the correct order
+				if layerIndex > 0 {
+					fmt.Fprintf(
+						b, "%s%sstage_%d_layer_%d --> stage_%d_layer_%d\n",
+						indent, mermaidIndent, stageIndex, layerIndex-1, stageIndex, layerIndex,
+					)
+				}
+			}
+			fmt.Fprintf(b, "%send\n", indent)
+		} else {
+			fmt.Fprintf(
+				b, "%sstage_%d(%s)\n",
+				indent, stageIndex,
+				mermaidStageLabel(simplifiedDockerfile.Stages, stageIndex, opts.MaxLabelLength),
+			)
+			addMermaidClick(
+				b, indent, fmt.Sprintf("stage_%d", stageIndex),
+				getSourceLink(getStageLinkPrefix(opts.LinkPrefix, stage), stage.Source),
+			)
+		}
+
+		if stage.File != "" && isDefaultTarget(simplifiedDockerfile.Stages, stageIndex) {
+			fmt.Fprintf(b, "%send\n", mermaidIndent)
+		}
+
+		// Add the edges for this build stage
+		for layerIndex, layer := range stage.Layers {
+			for _, waitFor := range layer.WaitFors {
+				sourceNodeID, attrs, err := getWaitForNodeID(
+					simplifiedDockerfile, waitFor.ID, opts.Layers,
+				)
+				if err != nil {
+					return err
+				}
+				// Mermaid allows edges to start at a subgraph, which is
+				// what ltail achieves in Graphviz.
+				if cluster, ok := attrs["ltail"]; ok {
+					sourceNodeID = cluster
+				}
+
+				targetNodeID := fmt.Sprintf("stage_%d", stageIndex)
+				if opts.Layers {
+					targetNodeID = targetNodeID + fmt.Sprintf("_layer_%d", layerIndex)
+				}
+
+				arrow := mermaidArrow(waitFor, opts.EdgeStyle)
+				if label := getWaitForLabel(waitFor, opts.MaxLabelLength, opts.CopyDetails); label != "" {
+					arrow += "|" + mermaidLabel(label) + "|"
+				}
+				fmt.Fprintf(edges, "%s%s %s %s\n", mermaidIndent, sourceNodeID, arrow, targetNodeID)
+			}
+		}
+	}
+
+	if edges != b {
+		b.WriteString(edges.String())
+	}
+
+	return nil
+}
+
+// addMermaidServices adds the Docker Compose services, with an edge to the
+// stage that each of them builds, and returns their node IDs.
+func addMermaidServices(
+	b *strings.Builder,
+	simplifiedDockerfile SimplifiedDockerfile,
+	layers bool,
+) ([]string, error) {
+	serviceIDs := make([]string, 0, len(simplifiedDockerfile.Services))
+	for serviceIndex, service := range simplifiedDockerfile.Services {
+		nodeID := fmt.Sprintf("service_%d", serviceIndex)
+		serviceIDs = append(serviceIDs, nodeID)
+
+		targetNodeID, attrs, err := getServiceTargetNodeID(simplifiedDockerfile, service, layers)
+		if err != nil {
+			return nil, err
+		}
+		// Mermaid allows edges to end at a subgraph, which is what lhead
+		// achieves in Graphviz.
+		if cluster, ok := attrs["lhead"]; ok {
+			targetNodeID = cluster
+		}
+
+		fmt.Fprintf(b, "%s%s([%s])\n", mermaidIndent, nodeID, mermaidLabel(service.Name))
+		fmt.Fprintf(b, "%s%s --> %s\n", mermaidIndent, nodeID, targetNodeID)
+	}
+	return serviceIDs, nil
+}
+
+func addMermaidLegend(b *strings.Builder, edgestyle string, withAdd bool) {
+	fmt.Fprintf(b, "%ssubgraph cluster_legend [%s]\n", mermaidIndent, mermaidLabel("Legend"))
+	var keyIDs, key2IDs []string
+	for i, entry := range []struct {
+		label       string
+		waitForType WaitForType
+	}{
+		{"FROM ...", WaitForFrom},
+		{"COPY --from=...", WaitForCopy},
+		{"RUN --mount=...", WaitForMount},
+		{"ADD https://...", WaitForAdd},
+	} {
+		if entry.waitForType == WaitForAdd && !withAdd {
+			continue
+		}
+		keyIDs = append(keyIDs, fmt.Sprintf("key_%d", i))
+		key2IDs = append(key2IDs, fmt.Sprintf("key2_%d", i))
+		fmt.Fprintf(
+			b, "%s%skey_%d[%s] %s|%s| key2_%d[%s]\n",
+			mermaidIndent, mermaidIndent,
+			i, mermaidLabel(" "),
+			mermaidArrow(WaitFor{Type: entry.waitForType}, edgestyle),
+			mermaidLabel(entry.label),
+			i, mermaidLabel(" "),
+		)
+	}
+	fmt.Fprintf(b, "%send\n", mermaidIndent)
+	fmt.Fprintf(
+		b, "%sclassDef legendKey fill:none,stroke:none\n%sclass %s legendKey\n",
+		mermaidIndent, mermaidIndent, strings.Join(slices.Concat(keyIDs, key2IDs), ","),
+	)
+}
+
+// addMermaidClick makes the node open the link when it is clicked.
+func addMermaidClick(b *strings.Builder, indent string, nodeID string, link string) {
+	if link == "" {
+		return
+	}
+	fmt.Fprintf(b, "%sclick %s href %s\n", indent, nodeID, mermaidLabel(link))
+}
+
+// mermaidArrow returns the Mermaid link syntax for the given dependency.
+func mermaidArrow(waitFor WaitFor, edgestyle string) string {
+	// Mermaid has no bold dashed links, so COPY --link and ADD --link use
+	// thick links in both edge styles.
+	linked := waitFor.Copy != nil && waitFor.Copy.Link
+	switch waitFor.Type {
+	case WaitForCopy:
+		if linked {
+			return "==>"
+		}
+		if edgestyle == "default" {
+			return "-.->"
+		}
+		return "-->"
+	case WaitForMount:
+		if edgestyle == "default" {
+			return "-.-o"
+		}
+		return "--o"
+	case WaitForAdd:
+		if linked {
+			return "==x"
+		}
+		if edgestyle == "default" {
+			return "-.-x"
+		}
+		return "--x"
+	default:
+		return "-->"
+	}
+}
+
+// mermaidLabel returns s as a quoted Mermaid label, using Mermaid entity
+// codes for the characters that would otherwise break the syntax.
+func mermaidLabel(s string) string {
+	return "\"" + mermaidEscape(s) + "\""
+}
+
+// mermaidEscape replaces the characters that would break a quoted Mermaid
+// label with Mermaid entity codes.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(
+		"\"", "#quot;",
+		"<", "#lt;",
+		">", "#gt;",
+	).Replace(s)
+}
+
+// addMermaidUnusedStyles greys out the stages that none of the targets needs.
+func addMermaidUnusedStyles(b *strings.Builder, stages []Stage, layers bool) {
+	var unusedIDs []string
+	for stageIndex, stage := range stages {
+		if !stage.Unused {
+			continue
+		}
+		if layers {
+			fmt.Fprintf(
+				b, "%sstyle cluster_stage_%d stroke:%s,color:%s\n",
+				mermaidIndent, stageIndex, hexGrey60, hexGrey60,
+			)
+		} else {
+			unusedIDs = append(unusedIDs, fmt.Sprintf("stage_%d", stageIndex))
+		}
+	}
+	if len(unusedIDs) > 0 {
+		fmt.Fprintf(b, "%sclassDef unused stroke:%s,color:%s\n", mermaidIndent, hexGrey60, hexGrey60)
+		fmt.Fprintf(b, "%sclass %s unused\n", mermaidIndent, strings.Join(unusedIDs, ","))
+	}
+}
+
+// mermaidStageLabel returns the quoted label of a stage node, with the
+// badge of the stage in a smaller font below the name.
+func mermaidStageLabel(stages []Stage, stageIndex int, maxLabelLength int) string {
+	return mermaidBadgeLabel(getStageLabel(stages, stageIndex, maxLabelLength), getStageBadge(stages[stageIndex]))
+}
+
+// mermaidBadgeLabel returns a quoted label with the badge in a smaller font
+// below it, if there is a badge.
+func mermaidBadgeLabel(label, badge string) string {
+	label = mermaidEscape(label)
+	if badge != "" {
+		label += "<br><small>" + mermaidEscape(badge) + "</small>"
+	}
+	return "\"" + label + "\""
+}
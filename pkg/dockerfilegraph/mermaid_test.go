@@ -0,0 +1,137 @@
+package dockerfilegraph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildMermaidFile(t *testing.T) {
+	simplifiedDockerfile := SimplifiedDockerfile{
+		BeforeFirstStage: []Layer{{Label: "ARG VERSION=1"}},
+		ExternalImages: []ExternalImage{
+			{ID: "ubuntu", Name: "ubuntu"},
+			{ID: "buildcache", Name: "buildcache"},
+		},
+		Stages: []Stage{
+			{
+				Name: "base",
+				Layers: []Layer{{
+					Label:    "FROM ubuntu AS base",
+					WaitFors: []WaitFor{{ID: "ubuntu", Type: WaitForFrom}},
+				}},
+			},
+			{
+				Name:   "release",
+				Source: SourceRange{StartLine: 3, EndLine: 5},
+				Layers: []Layer{
+					{
+						Label:    "FROM base AS release",
+						WaitFors: []WaitFor{{ID: "base", Type: WaitForFrom}},
+						Source:   SourceRange{StartLine: 3, EndLine: 3},
+					},
+					{
+						Label:    "COPY --from=0 . .",
+						WaitFors: []WaitFor{{ID: "0", Type: WaitForCopy}},
+					},
+					{
+						Label:    "RUN --mount=from=buildcache \"quoted\"",
+						WaitFors: []WaitFor{{ID: "buildcache", Type: WaitForMount}},
+					},
+				},
+			},
+		},
+		Services: []Service{{Name: "web", Stage: 1}},
+	}
+
+	tests := []struct {
+		name         string
+		opts         BuildOptions
+		wantContains []string
+	}{
+		{
+			name: "stages",
+			opts: BuildOptions{EdgeStyle: "default", MaxLabelLength: 20},
+			wantContains: []string{
+				"flowchart LR\n",
+				`    external_image_0("ubuntu")` + "\n",
+				`    stage_0("base")` + "\n",
+				"    external_image_0 --> stage_0\n",
+				"    stage_0 --> stage_1\n",
+				"    stage_0 -.-> stage_1\n",
+				"    external_image_1 -.-o stage_1\n",
+				"    class external_image_0,external_image_1 externalImage\n",
+				"    class stage_1 defaultTarget\n",
+				`    service_0(["web"])` + "\n",
+				"    service_0 --> stage_1\n",
+				"    class service_0 service\n",
+			},
+		},
+		{
+			name: "layers with solid edges",
+			opts: BuildOptions{EdgeStyle: "solid", Layers: true, MaxLabelLength: 20},
+			wantContains: []string{
+				`    subgraph cluster_stage_1 ["release"]` + "\n",
+				`        stage_1_layer_2("RUN --mount=from=buildcache #quot;quoted#quot;")` + "\n",
+				"        stage_1_layer_0 --> stage_1_layer_1\n",
+				"    cluster_stage_0 --> stage_1_layer_1\n",
+				"    external_image_1 --o stage_1_layer_2\n",
+				`        before_first_stage_0("ARG VERSION=1")` + "\n",
+				"    style cluster_stage_1 fill:#e5e5e5\n",
+				"    service_0 --> cluster_stage_1\n",
+			},
+		},
+		{
+			name: "link prefix",
+			opts: BuildOptions{EdgeStyle: "default", LinkPrefix: "Dockerfile", MaxLabelLength: 20},
+			wantContains: []string{
+				`    click stage_1 href "Dockerfile#L3-L5"` + "\n",
+			},
+		},
+		{
+			name: "layers with link prefix",
+			opts: BuildOptions{EdgeStyle: "default", Layers: true, LinkPrefix: "Dockerfile", MaxLabelLength: 20},
+			wantContains: []string{
+				`        click stage_1_layer_0 href "Dockerfile#L3"` + "\n",
+			},
+		},
+		{
+			name: "legend",
+			opts: BuildOptions{EdgeStyle: "default", Legend: true, MaxLabelLength: 20},
+			wantContains: []string{
+				`    subgraph cluster_legend ["Legend"]` + "\n",
+				`        key_1[" "] -.->|"COPY --from=..."| key2_1[" "]` + "\n",
+				`    class key_0,key_1,key_2,key2_0,key2_1,key2_2 legendKey` + "\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildMermaidFile(simplifiedDockerfile, tt.opts)
+			if err != nil {
+				t.Fatalf("BuildMermaidFile() error = %v", err)
+			}
+			for _, want := range tt.wantContains {
+				if !strings.Contains(got, want) {
+					t.Errorf("BuildMermaidFile() = %v, did not contain %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildMermaidFileErrors(t *testing.T) {
+	_, err := BuildMermaidFile(
+		SimplifiedDockerfile{
+			Stages: []Stage{{
+				Layers: []Layer{{
+					Label:    "FROM scratch",
+					WaitFors: []WaitFor{{ID: "nonexistent", Type: WaitForFrom}},
+				}},
+			}},
+		},
+		BuildOptions{EdgeStyle: "default", MaxLabelLength: 20},
+	)
+	if err == nil {
+		t.Error("BuildMermaidFile() expected an error, got nil")
+	}
+}
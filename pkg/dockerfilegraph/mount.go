@@ -0,0 +1,117 @@
+package dockerfilegraph
+
+import (
+	"encoding/csv"
+	"errors"
+	"path"
+	"strings"
+)
+
+// Mount types of RUN --mount, see
+// https://docs.docker.com/reference/dockerfile/#run---mount
+const (
+	mountTypeBind   = "bind"
+	mountTypeCache  = "cache"
+	mountTypeSecret = "secret"
+	mountTypeSSH    = "ssh"
+	mountTypeTmpfs  = "tmpfs"
+)
+
+// parseMount parses the value of a --mount option, a comma-separated list
+// of key=value pairs. Like BuildKit, the type defaults to bind, the id of a
+// cache to its target, the id of a secret to the base name of its target and
+// the id of an SSH agent to default.
+func parseMount(value string) (Mount, error) {
+	fields, err := csv.NewReader(strings.NewReader(value)).Read()
+	if err != nil {
+		return Mount{}, err
+	}
+
+	mount := Mount{Type: mountTypeBind}
+	for _, field := range fields {
+		key, val, _ := strings.Cut(field, "=")
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "type":
+			mount.Type = strings.ToLower(val)
+		case "id":
+			mount.ID = val
+		case "target", "dst", "destination":
+			mount.Target = val
+		case "from":
+			mount.From = val
+		case "source", "src":
+			mount.Source = val
+		case "sharing":
+			mount.Sharing = strings.ToLower(val)
+		}
+	}
+
+	switch mount.Type {
+	case mountTypeBind, mountTypeTmpfs:
+	case mountTypeCache:
+		if mount.ID == "" {
+			mount.ID = mount.Target
+		}
+	case mountTypeSecret:
+		if mount.ID == "" && mount.Target != "" {
+			mount.ID = path.Base(mount.Target)
+		}
+	case mountTypeSSH:
+		if mount.ID == "" {
+			mount.ID = "default"
+		}
+	default:
+		return Mount{}, errors.New("unknown mount type " + mount.Type)
+	}
+
+	return mount, nil
+}
+
+// Prefixes of the IDs of the nodes for caches, secrets and SSH agents. They
+// are not valid image names, so they cannot clash with images.
+const (
+	cacheIDPrefix  = "type=cache,id="
+	secretIDPrefix = "type=secret,id="
+	sshIDPrefix    = "type=ssh,id="
+)
+
+// mountWaitForID returns the ID of the stage, image, cache, secret or SSH
+// agent that a mount waits for, or an empty string if it does not wait for
+// anything, like a tmpfs or a bind mount of the build context.
+func mountWaitForID(mount Mount) string {
+	switch mount.Type {
+	case mountTypeBind:
+		return mount.From
+	case mountTypeCache:
+		// A cache mount with from is seeded from the stage or image, so it
+		// depends on it like a bind mount.
+		if mount.From != "" {
+			return mount.From
+		}
+		return cacheIDPrefix + mount.ID
+	case mountTypeSecret:
+		if mount.ID == "" {
+			return ""
+		}
+		return secretIDPrefix + mount.ID
+	case mountTypeSSH:
+		return sshIDPrefix + mount.ID
+	default:
+		return ""
+	}
+}
+
+// mountSource returns the name and type of the node for the ID of a cache,
+// secret or SSH agent.
+func mountSource(id string) (string, ExternalImageType, bool) {
+	if name, ok := strings.CutPrefix(id, cacheIDPrefix); ok {
+		return name, ExternalImageCache, true
+	}
+	if name, ok := strings.CutPrefix(id, secretIDPrefix); ok {
+		return name, ExternalImageSecret, true
+	}
+	if name, ok := strings.CutPrefix(id, sshIDPrefix); ok {
+		return name, ExternalImageSSH, true
+	}
+	return "", ExternalImageRegistry, false
+}
@@ -0,0 +1,284 @@
+package dockerfilegraph
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// platform is an OS and architecture that images are built for, like
+// linux/arm64 or linux/arm/v7.
+type platform struct {
+	os      string
+	arch    string
+	variant string
+}
+
+func (p platform) String() string {
+	if p.variant == "" {
+		return p.os + "/" + p.arch
+	}
+	return p.os + "/" + p.arch + "/" + p.variant
+}
+
+// parsePlatform parses a platform in the format os/arch[/variant]. Like
+// BuildKit, common architecture aliases are normalized, 32-bit ARM defaults
+// to v7, and the v8 variant of arm64 is dropped.
+func parsePlatform(s string) (platform, error) {
+	parts := strings.Split(strings.ToLower(s), "/")
+	if len(parts) < 2 || len(parts) > 3 || slices.Contains(parts, "") {
+		return platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant], e.g. linux/arm64", s)
+	}
+
+	p := platform{os: parts[0], arch: parts[1]}
+	if len(parts) == 3 {
+		p.variant = parts[2]
+	}
+	switch p.arch {
+	case "x86_64", "x86-64":
+		p.arch = "amd64"
+	case "aarch64":
+		p.arch = "arm64"
+	case "armhf":
+		p.arch, p.variant = "arm", "v7"
+	case "armel":
+		p.arch, p.variant = "arm", "v6"
+	}
+	switch {
+	case p.arch == "arm64" && p.variant == "v8":
+		p.variant = ""
+	case p.arch == "arm" && p.variant == "":
+		p.variant = "v7"
+	}
+	return p, nil
+}
+
+// DefaultBuildPlatform returns the platform of the builder if
+// ParseOptions.BuildPlatform isn't set, which is Linux on the architecture of
+// this machine, like Docker Desktop.
+func DefaultBuildPlatform() string {
+	if runtime.GOARCH == "arm" {
+		return "linux/arm/v7"
+	}
+	return "linux/" + runtime.GOARCH
+}
+
+// platformArgs returns the automatic platform ARGs of BuildKit, see
+// https://docs.docker.com/reference/dockerfile/#automatic-platform-args-in-the-global-scope
+func platformArgs(targetPlatform, buildPlatform platform) map[string]string {
+	return map[string]string{
+		"TARGETPLATFORM": targetPlatform.String(),
+		"TARGETOS":       targetPlatform.os,
+		"TARGETARCH":     targetPlatform.arch,
+		"TARGETVARIANT":  targetPlatform.variant,
+		"BUILDPLATFORM":  buildPlatform.String(),
+		"BUILDOS":        buildPlatform.os,
+		"BUILDARCH":      buildPlatform.arch,
+		"BUILDVARIANT":   buildPlatform.variant,
+	}
+}
+
+// platformOptions returns the target and build platform of opts, or false
+// if no platform is set.
+func platformOptions(opts ParseOptions) (platform, platform, bool, error) {
+	if opts.Platform == "" {
+		return platform{}, platform{}, false, nil
+	}
+	targetPlatform, err := parsePlatform(opts.Platform)
+	if err != nil {
+		return platform{}, platform{}, false, err
+	}
+	buildPlatform, err := parsePlatform(cmp.Or(opts.BuildPlatform, DefaultBuildPlatform()))
+	if err != nil {
+		return platform{}, platform{}, false, err
+	}
+	return targetPlatform, buildPlatform, true, nil
+}
+
+// withPlatformArgs adds the automatic platform ARGs to the build args, so
+// that stages see them when they declare them. Like in BuildKit, they are
+// also defined in the global scope without a declaration.
+func withPlatformArgs(
+	buildArgs map[string]string, argReplacements []ArgReplacement, targetPlatform, buildPlatform platform,
+) (map[string]string, []ArgReplacement) {
+	args := platformArgs(targetPlatform, buildPlatform)
+	withArgs := make(map[string]string, len(args)+len(buildArgs))
+	maps.Copy(withArgs, args)
+	maps.Copy(withArgs, buildArgs)
+	for _, key := range slices.Sorted(maps.Keys(args)) {
+		argReplacements = append(argReplacements, ArgReplacement{Key: key, Value: withArgs[key]})
+	}
+	return withArgs, argReplacements
+}
+
+// stagePlatform returns the platform that a stage runs on. It is set by
+// FROM --platform, or inherited from the stage it is based on, and is the
+// target platform otherwise.
+func stagePlatform(
+	node *parser.Node, argReplacements []ArgReplacement, stages []Stage, targetPlatform platform,
+) string {
+	for _, flag := range node.Flags {
+		if value, ok := strings.CutPrefix(flag, "--platform="); ok {
+			value = replaceArgVars(value, argReplacements)
+			if p, err := parsePlatform(value); err == nil {
+				return p.String()
+			}
+			// An unknown variable, keep it as it is written
+			return value
+		}
+	}
+	if parentIndex, found := findStageIndex(stages, replaceArgVars(node.Next.Value, argReplacements)); found {
+		return stages[parentIndex].Platform
+	}
+	return targetPlatform.String()
+}
+
+// parsePlatformVariants parses the Dockerfile once for each platform of
+// ParseOptions.Platforms and merges the variants into one graph.
+func parsePlatformVariants(content []byte, opts ParseOptions) (SimplifiedDockerfile, error) {
+	variants := make([]SimplifiedDockerfile, 0, len(opts.Platforms))
+	platforms := make([]string, 0, len(opts.Platforms))
+	for _, targetPlatform := range opts.Platforms {
+		p, err := parsePlatform(targetPlatform)
+		if err != nil {
+			return SimplifiedDockerfile{}, err
+		}
+		variantOpts := opts
+		variantOpts.Platform = targetPlatform
+		variantOpts.Platforms = nil
+		variant, err := dockerfileToSimplifiedDockerfile(content, variantOpts)
+		if err != nil {
+			return SimplifiedDockerfile{}, err
+		}
+		variants = append(variants, variant)
+		platforms = append(platforms, p.String())
+	}
+	return mergePlatformVariants(variants, platforms, opts.Targets)
+}
+
+// mergePlatformVariants merges the graphs of the same Dockerfile for several
+// target platforms. All variants have the same stages and layers, because
+// they are parsed from the same instructions, so only the WaitFors differ,
+// e.g. for FROM base-${TARGETARCH}. Stages that are only built for some of
+// the platforms, and WaitFors that only exist for some of them, get the
+// list of these platforms. Stages are Emulated if they are emulated on all
+// of their platforms, and list the emulated ones otherwise.
+func mergePlatformVariants(
+	variants []SimplifiedDockerfile, platforms []string, targets []string,
+) (SimplifiedDockerfile, error) {
+	if len(variants) == 0 {
+		return SimplifiedDockerfile{}, nil
+	}
+
+	// The stages that each variant builds
+	built := make([]map[int]struct{}, len(variants))
+	for variantIndex, variant := range variants {
+		if len(variant.Stages) == 0 {
+			continue
+		}
+		targetIndices := []int{len(variant.Stages) - 1}
+		if len(targets) > 0 {
+			var err error
+			targetIndices, err = resolveTargetIndices(variant.Stages, targets)
+			if err != nil {
+				return SimplifiedDockerfile{}, err
+			}
+		}
+		built[variantIndex] = collectReachableIndices(variant.Stages, targetIndices)
+	}
+
+	merged := SimplifiedDockerfile{BeforeFirstStage: variants[0].BeforeFirstStage}
+	for stageIndex, stage := range variants[0].Stages {
+		var builtBy []int
+		for variantIndex := range variants {
+			if _, ok := built[variantIndex][stageIndex]; ok {
+				builtBy = append(builtBy, variantIndex)
+			}
+		}
+		if len(builtBy) > 0 && len(builtBy) < len(variants) {
+			stage.Platforms = selectPlatforms(platforms, builtBy)
+		}
+		if len(builtBy) == 0 {
+			// Not built at all, so all platforms are equally relevant
+			for variantIndex := range variants {
+				builtBy = append(builtBy, variantIndex)
+			}
+		}
+
+		// The platforms that the stage runs on, in the order of the variants
+		var stagePlatforms, emulatedPlatforms []string
+		for _, variantIndex := range builtBy {
+			variantStage := variants[variantIndex].Stages[stageIndex]
+			if slices.Contains(stagePlatforms, variantStage.Platform) {
+				continue
+			}
+			stagePlatforms = append(stagePlatforms, variantStage.Platform)
+			if variantStage.Emulated {
+				emulatedPlatforms = append(emulatedPlatforms, variantStage.Platform)
+			}
+		}
+		stage.Platform = strings.Join(stagePlatforms, ", ")
+		stage.Emulated = len(emulatedPlatforms) == len(stagePlatforms)
+		if !stage.Emulated && len(emulatedPlatforms) > 0 {
+			stage.EmulatedPlatforms = emulatedPlatforms
+		}
+
+		stage.Layers = slices.Clone(stage.Layers)
+		for layerIndex := range stage.Layers {
+			stage.Layers[layerIndex].WaitFors = mergeWaitFors(variants, platforms, stageIndex, layerIndex)
+		}
+		merged.Stages = append(merged.Stages, stage)
+	}
+
+	seen := make(map[string]struct{})
+	for _, variant := range variants {
+		for _, image := range variant.ExternalImages {
+			if _, ok := seen[image.ID]; !ok {
+				seen[image.ID] = struct{}{}
+				merged.ExternalImages = append(merged.ExternalImages, image)
+			}
+		}
+	}
+
+	return merged, nil
+}
+
+// mergeWaitFors returns the WaitFors of a layer in all variants. WaitFors
+// with the same ID and type are the same dependency.
+func mergeWaitFors(variants []SimplifiedDockerfile, platforms []string, stageIndex, layerIndex int) []WaitFor {
+	var waitFors []WaitFor
+	var foundIn [][]int
+	for variantIndex, variant := range variants {
+		for _, waitFor := range variant.Stages[stageIndex].Layers[layerIndex].WaitFors {
+			i := slices.IndexFunc(waitFors, func(w WaitFor) bool {
+				return w.ID == waitFor.ID && w.Type == waitFor.Type
+			})
+			if i < 0 {
+				waitFors = append(waitFors, waitFor)
+				foundIn = append(foundIn, nil)
+				i = len(waitFors) - 1
+			}
+			foundIn[i] = append(foundIn[i], variantIndex)
+		}
+	}
+	for i := range waitFors {
+		if len(foundIn[i]) < len(variants) {
+			waitFors[i].Platforms = selectPlatforms(platforms, foundIn[i])
+		}
+	}
+	return waitFors
+}
+
+// selectPlatforms returns the platforms of the given variants.
+func selectPlatforms(platforms []string, variantIndices []int) []string {
+	selected := make([]string, 0, len(variantIndices))
+	for _, variantIndex := range variantIndices {
+		selected = append(selected, platforms[variantIndex])
+	}
+	return selected
+}
@@ -0,0 +1,194 @@
+package dockerfilegraph
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func Test_parsePlatform(t *testing.T) {
+	tests := []struct {
+		platform string
+		want     string
+		wantErr  bool
+	}{
+		{platform: "linux/amd64", want: "linux/amd64"},
+		{platform: "linux/x86_64", want: "linux/amd64"},
+		{platform: "Linux/AArch64", want: "linux/arm64"},
+		{platform: "linux/arm64/v8", want: "linux/arm64"},
+		{platform: "linux/arm", want: "linux/arm/v7"},
+		{platform: "linux/arm/v6", want: "linux/arm/v6"},
+		{platform: "windows/amd64", want: "windows/amd64"},
+		{platform: "arm64", wantErr: true},
+		{platform: "linux/", wantErr: true},
+		{platform: "linux/arm/v7/extra", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			got, err := parsePlatform(tt.platform)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePlatform() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("parsePlatform() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDockerfilePlatforms(t *testing.T) {
+	dockerfile := `FROM --platform=$BUILDPLATFORM golang AS build
+FROM alpine AS base-amd64
+FROM alpine AS base-arm64
+FROM base-${TARGETARCH} AS release
+COPY --from=build /app /app
+FROM release AS test
+`
+	tests := []struct {
+		name          string
+		opts          ParseOptions
+		wantStages    []Stage
+		wantWaitFors  [][]WaitFor
+		wantImageIDs  []string
+		wantErrString string
+	}{
+		{
+			name: "two platforms",
+			opts: ParseOptions{
+				MaxLabelLength: 20, Platforms: []string{"linux/amd64", "linux/arm64"}, BuildPlatform: "linux/amd64",
+			},
+			wantStages: []Stage{
+				{Name: "build", Platform: "linux/amd64"},
+				{Name: "base-amd64", Platform: "linux/amd64", Platforms: []string{"linux/amd64"}},
+				{Name: "base-arm64", Platform: "linux/arm64", Emulated: true, Platforms: []string{"linux/arm64"}},
+				{Name: "release", Platform: "linux/amd64, linux/arm64", EmulatedPlatforms: []string{"linux/arm64"}},
+				{Name: "test", Platform: "linux/amd64, linux/arm64", EmulatedPlatforms: []string{"linux/arm64"}},
+			},
+			wantWaitFors: [][]WaitFor{
+				{{ID: "golang", Type: WaitForFrom}},
+				{{ID: "alpine", Type: WaitForFrom}},
+				{{ID: "alpine", Type: WaitForFrom}},
+				{
+					{ID: "base-amd64", Type: WaitForFrom, Platforms: []string{"linux/amd64"}},
+					{ID: "base-arm64", Type: WaitForFrom, Platforms: []string{"linux/arm64"}},
+				},
+				{{ID: "build", Type: WaitForCopy}},
+				{{ID: "release", Type: WaitForFrom}},
+			},
+			wantImageIDs: []string{"golang", "alpine"},
+		},
+		{
+			name: "two platforms with a target",
+			opts: ParseOptions{
+				MaxLabelLength: 20, Platforms: []string{"linux/arm64", "linux/arm/v7"}, BuildPlatform: "linux/arm64",
+				Targets: []string{"release"},
+			},
+			wantStages: []Stage{
+				{Name: "build", Platform: "linux/arm64"},
+				{Name: "base-arm64", Platform: "linux/arm64", Platforms: []string{"linux/arm64"}},
+				{Name: "release", Platform: "linux/arm64, linux/arm/v7", EmulatedPlatforms: []string{"linux/arm/v7"}},
+			},
+			wantWaitFors: [][]WaitFor{
+				{{ID: "golang", Type: WaitForFrom}},
+				{{ID: "alpine", Type: WaitForFrom}},
+				{
+					{ID: "base-arm64", Type: WaitForFrom, Platforms: []string{"linux/arm64"}},
+					{ID: "base-arm", Type: WaitForFrom, Platforms: []string{"linux/arm/v7"}},
+				},
+				{{ID: "build", Type: WaitForCopy}},
+			},
+			wantImageIDs: []string{"golang", "alpine", "base-arm"},
+		},
+		{
+			name:          "invalid platform",
+			opts:          ParseOptions{MaxLabelLength: 20, Platforms: []string{"linux/amd64", "arm64"}},
+			wantErrString: `invalid platform "arm64"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDockerfile(context.Background(), strings.NewReader(dockerfile), tt.opts)
+			if tt.wantErrString != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrString) {
+					t.Fatalf("ParseDockerfile() error = %v, want %q", err, tt.wantErrString)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDockerfile() error = %v", err)
+			}
+
+			var gotStages []Stage
+			var gotWaitFors [][]WaitFor
+			for _, stage := range got.Stages {
+				gotStages = append(gotStages, Stage{
+					Name: stage.Name, Platform: stage.Platform, Emulated: stage.Emulated, Platforms: stage.Platforms,
+					EmulatedPlatforms: stage.EmulatedPlatforms,
+				})
+				for _, layer := range stage.Layers {
+					gotWaitFors = append(gotWaitFors, layer.WaitFors)
+				}
+			}
+			var gotImageIDs []string
+			for _, image := range got.ExternalImages {
+				gotImageIDs = append(gotImageIDs, image.ID)
+			}
+
+			if diff := cmp.Diff(tt.wantStages, gotStages); diff != "" {
+				t.Errorf("Stages mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(
+				tt.wantWaitFors, gotWaitFors, cmpopts.IgnoreFields(WaitFor{}, "Copy"),
+			); diff != "" {
+				t.Errorf("WaitFors mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantImageIDs, gotImageIDs); diff != "" {
+				t.Errorf("ExternalImages mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_mergePlatformVariants(t *testing.T) {
+	variant := func(platform string, emulated bool) SimplifiedDockerfile {
+		return SimplifiedDockerfile{Stages: []Stage{
+			{Platform: platform, Emulated: emulated, Layers: []Layer{{Label: "FROM scratch"}}},
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		variants []SimplifiedDockerfile
+		want     Stage
+	}{
+		{
+			name:     "native and emulated",
+			variants: []SimplifiedDockerfile{variant("linux/amd64", false), variant("linux/arm64", true)},
+			want:     Stage{Platform: "linux/amd64, linux/arm64", EmulatedPlatforms: []string{"linux/arm64"}},
+		},
+		{
+			name:     "emulated on a fixed platform",
+			variants: []SimplifiedDockerfile{variant("linux/riscv64", true), variant("linux/riscv64", true)},
+			want:     Stage{Platform: "linux/riscv64", Emulated: true},
+		},
+		{
+			name:     "native on the build platform",
+			variants: []SimplifiedDockerfile{variant("linux/amd64", false), variant("linux/amd64", false)},
+			want:     Stage{Platform: "linux/amd64"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergePlatformVariants(tt.variants, []string{"linux/amd64", "linux/arm64"}, nil)
+			if err != nil {
+				t.Fatalf("mergePlatformVariants() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got.Stages[0], cmpopts.IgnoreFields(Stage{}, "Layers")); diff != "" {
+				t.Errorf("Stage mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
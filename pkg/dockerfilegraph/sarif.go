@@ -0,0 +1,165 @@
+package dockerfilegraph
+
+import (
+	"encoding/json"
+)
+
+// JSONLintReport is the root of the JSON document created by
+// BuildLintJSONFile.
+type JSONLintReport struct {
+	Findings []JSONFinding `json:"findings"`
+}
+
+// JSONFinding is a single problem found by Lint.
+type JSONFinding struct {
+	Rule    string           `json:"rule"`
+	Level   string           `json:"level"` // One of error or warning
+	Message string           `json:"message"`
+	File    string           `json:"file,omitempty"`
+	Source  *JSONSourceRange `json:"source,omitempty"`
+}
+
+// BuildLintJSONFile serializes the findings of Lint as an indented JSON
+// document, see JSONLintReport for the schema.
+func BuildLintJSONFile(findings []Finding) (string, error) {
+	report := JSONLintReport{Findings: make([]JSONFinding, 0, len(findings))}
+	for _, finding := range findings {
+		report.Findings = append(report.Findings, JSONFinding{
+			Rule:    finding.Rule,
+			Level:   LintRuleLevel(finding.Rule),
+			Message: finding.Message,
+			File:    finding.File,
+			Source:  jsonSourceRange(finding.Source),
+		})
+	}
+
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// LintRuleLevel returns the level of the rule with the given ID, or warning
+// for unknown rules.
+func LintRuleLevel(ruleID string) string {
+	for _, rule := range LintRules {
+		if rule.ID == ruleID {
+			return rule.Level
+		}
+	}
+	return "warning"
+}
+
+// The subset of SARIF 2.1.0 that BuildSARIFFile writes, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Version        string      `json:"version,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation *sarifArtifactLocation `json:"artifactLocation,omitempty"`
+	Region           *sarifRegion           `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// BuildSARIFFile serializes the findings of Lint as a SARIF 2.1.0 log, which
+// code scanning tools like the one of GitHub can show next to the code. The
+// version is the version of dockerfilegraph, and is omitted if it is empty.
+func BuildSARIFFile(findings []Finding, version string) (string, error) {
+	driver := sarifDriver{
+		Name:           "dockerfilegraph",
+		InformationURI: "https://github.com/patrickhoefler/dockerfilegraph",
+		Version:        version,
+	}
+	for _, rule := range LintRules {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   rule.ID,
+			ShortDescription:     sarifMessage{Text: rule.Description},
+			DefaultConfiguration: sarifConfiguration{Level: rule.Level},
+		})
+	}
+
+	run := sarifRun{Tool: sarifTool{Driver: driver}, Results: make([]sarifResult, 0, len(findings))}
+	for _, finding := range findings {
+		result := sarifResult{
+			RuleID:  finding.Rule,
+			Level:   LintRuleLevel(finding.Rule),
+			Message: sarifMessage{Text: finding.Message},
+		}
+		var location sarifPhysicalLocation
+		if finding.File != "" {
+			location.ArtifactLocation = &sarifArtifactLocation{URI: finding.File}
+		}
+		if finding.Source.StartLine > 0 {
+			location.Region = &sarifRegion{
+				StartLine: finding.Source.StartLine, EndLine: max(finding.Source.EndLine, finding.Source.StartLine),
+			}
+		}
+		if location != (sarifPhysicalLocation{}) {
+			result.Locations = []sarifLocation{{PhysicalLocation: location}}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	b, err := json.MarshalIndent(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
@@ -0,0 +1,285 @@
+package dockerfilegraph
+
+import "strconv"
+
+// SimplifiedDockerfile contains the parts of the Dockerfile
+// that are relevant for generating the multi-stage build graph.
+type SimplifiedDockerfile struct {
+	// Args set before the first stage, see
+	// https://docs.docker.com/engine/reference/builder/#understand-how-arg-and-from-interact
+	BeforeFirstStage []Layer
+	// Build stages
+	Stages []Stage
+	// External images
+	ExternalImages []ExternalImage
+	// Docker Compose services, only set by LoadComposeFile
+	Services []Service
+}
+
+// Stage represents a single build stage within the multi-stage Dockerfile or
+// an external image.
+type Stage struct {
+	Name   string      // The part after the AS in the FROM line
+	Layers []Layer     // The layers of the stage
+	Source SourceRange // The lines from the FROM line to the last instruction of the stage
+	File   string      // The Dockerfile or bake target that defines the stage, only set by CombineDockerfiles
+	Path   string      // The path of the Dockerfile, appended to BuildOptions.LinkPrefix for the links of the stage
+
+	Platform string // The platform the stage runs on, e.g. linux/arm64, only set with ParseOptions.Platform
+	Emulated bool   // Whether the platform differs from the build platform, so RUN instructions are emulated
+
+	// The target platforms whose build includes the stage, only set with
+	// ParseOptions.Platforms if it isn't built for all of them
+	Platforms []string
+
+	// The platforms of the stage that are emulated, only set with
+	// ParseOptions.Platforms if it runs natively on the others
+	EmulatedPlatforms []string
+
+	Unused bool // Whether none of the targets needs the stage, only set with ParseOptions.HighlightUnused
+}
+
+// Layer stores the changes compared to the image it's based on within a
+// multi-stage Dockerfile.
+type Layer struct {
+	Label    string      // The command and truncated args
+	WaitFors []WaitFor   // Stages or external images for which this layer needs to wait
+	Source   SourceRange // The lines of the instruction
+	Warnings []string    // Problems found in the instruction, e.g. a COPY source excluded by .dockerignore
+}
+
+// SourceRange holds the lines of the Dockerfile that an instruction or a
+// stage spans. Line numbers start at 1, the zero value means unknown.
+type SourceRange struct {
+	StartLine int
+	EndLine   int
+}
+
+// ExternalImage holds the name of an external image.
+type ExternalImage struct {
+	ID   string            // Unique identifier for this external image instance
+	Name string            // The original name of the external image, or the source of its named build context
+	Type ExternalImageType // What the name refers to
+
+	// The parts of the name of an image with a valid reference, e.g.
+	// docker.io, library/alpine, 3.23 and sha256:... for
+	// alpine:3.23@sha256:..., and empty otherwise. The registry and the
+	// repository are normalized, the tag and the digest are only set if the
+	// name contains them.
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// BuildContextID is the ID of the external image that stands for the build
+// context, see ParseOptions.ShowContext.
+const BuildContextID = "context:."
+
+// ExternalImageType represents what an external image refers to. Named build
+// contexts can replace an image with a local directory or a remote source.
+type ExternalImageType int
+
+// ExternalImageType values describe the source of an external image. Their
+// numeric values are part of the compatibility promise, see the package
+// documentation.
+const (
+	ExternalImageRegistry  ExternalImageType = iota // An image, e.g. FROM alpine or docker-image://alpine
+	ExternalImageDirectory                          // A local directory, e.g. ./src
+	ExternalImageURL                                // A remote file or tarball, e.g. https://example.com/app.tar.gz
+	ExternalImageGit                                // A Git repository, e.g. https://github.com/org/repo.git#v1.0
+	ExternalImageCache                              // A cache mount without from, shared by its id
+	ExternalImageSecret                             // A secret mount, e.g. --mount=type=secret,id=npmrc
+	ExternalImageSSH                                // An SSH agent socket, e.g. --mount=type=ssh
+)
+
+// String returns the readable name of the external image type.
+func (t ExternalImageType) String() string {
+	switch t {
+	case ExternalImageRegistry:
+		return "image"
+	case ExternalImageDirectory:
+		return "directory"
+	case ExternalImageURL:
+		return "url"
+	case ExternalImageGit:
+		return "git"
+	case ExternalImageCache:
+		return "cache"
+	case ExternalImageSecret:
+		return "secret"
+	case ExternalImageSSH:
+		return "ssh"
+	default:
+		return "unknown"
+	}
+}
+
+// Service is a Docker Compose service that is built from a stage.
+type Service struct {
+	Name  string
+	Stage int // The index of the stage that the service builds
+}
+
+// ScratchMode controls how scratch base images are rendered in the graph.
+type ScratchMode int
+
+// ScratchMode values control how scratch base images appear in the graph.
+const (
+	ScratchCollapsed ScratchMode = iota // All scratch references share a single node
+	ScratchSeparated                    // Each scratch reference gets its own node
+	ScratchHidden                       // Scratch references are omitted from the graph
+)
+
+// WaitForType represents the type of dependency between stages or images.
+type WaitForType int
+
+// WaitForType values describe why a layer has to wait for a stage or image.
+// Their numeric values are part of the compatibility promise, see the
+// package documentation.
+const (
+	WaitForCopy  WaitForType = iota // COPY dependency from another stage
+	WaitForFrom                     // FROM dependency on another stage or image
+	WaitForMount                    // RUN --mount dependency on a stage, image, cache, secret or SSH agent
+	WaitForAdd                      // ADD dependency on a remote file or Git repository
+)
+
+// String returns the readable name of the dependency type.
+func (t WaitForType) String() string {
+	switch t {
+	case WaitForCopy:
+		return "copy"
+	case WaitForFrom:
+		return "from"
+	case WaitForMount:
+		return "mount"
+	case WaitForAdd:
+		return "add"
+	default:
+		return "unknown"
+	}
+}
+
+// WaitFor holds the name of the stage or external image for which the builder
+// has to wait, and the type, i.e. the reason why it has to wait for it.
+type WaitFor struct {
+	ID      string      // The unique identifier of the stage or external image for which the builder has to wait
+	Type    WaitForType // The reason why it has to wait
+	Paths   []string    // The source paths of a COPY or ADD from the build context, only set with ShowContext
+	Ignored []string    // The .dockerignore patterns that exclude some files of the Paths
+
+	Checksum   string // The --checksum of an ADD from a remote source
+	KeepGitDir bool   // Whether an ADD from a Git repository keeps the .git directory
+
+	Mount *Mount       // The --mount option of a RUN instruction, only set for WaitForMount
+	Copy  *CopyOptions // The paths and flags of a COPY or ADD instruction, only set for WaitForCopy and WaitForAdd
+
+	// The target platforms for which the dependency exists, only set with
+	// ParseOptions.Platforms if it doesn't exist for all of them
+	Platforms []string
+}
+
+// CopyOptions holds the paths and flags of a COPY or ADD instruction.
+type CopyOptions struct {
+	Sources     []string // The source paths, as written in the instruction
+	Destination string
+	Link        bool // --link, the files are copied into an independent layer
+	Parents     bool // --parents, the parent directories of the sources are kept
+	Chown       string
+	Chmod       string
+	Exclude     []string // The --exclude patterns
+}
+
+// Mount is a parsed --mount option of a RUN instruction.
+type Mount struct {
+	Type    string // One of bind (the default), cache, secret, ssh and tmpfs
+	ID      string // The cache, secret or SSH agent, with the defaults of BuildKit
+	Target  string // Where it is mounted
+	From    string // The stage or image of a bind or cache mount
+	Source  string // The path in From
+	Sharing string // The sharing mode of a cache mount: shared, private or locked
+}
+
+// findStageIndex returns the index of the stage identified by nameOrID (a stage
+// name or a decimal numeric index string) and true if found. For a numeric
+// index that parses but is out of range, it returns that index and false. For
+// a non-numeric name that is not found, it returns -1 and false.
+//
+// NOTE: This function searches all stages regardless of definition order.
+// Docker only allows referencing previously-defined stages, so a stage name
+// that shadows an external image name could theoretically be misresolved.
+// In practice this is unlikely because stage aliases rarely collide with
+// base image names. A future improvement could accept a position limit.
+func findStageIndex(stages []Stage, nameOrID string) (int, bool) {
+	if idx, err := strconv.Atoi(nameOrID); err == nil {
+		if idx >= 0 && idx < len(stages) {
+			return idx, true
+		}
+		return idx, false
+	}
+	for i, s := range stages {
+		if s.Name == nameOrID {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// findWaitForStage returns the index of the stage that a WaitFor refers to
+// and true if there is one. In combined graphs, WaitFors refer to stages by
+// their index only, because stage names are only unique within a Dockerfile.
+func findWaitForStage(stages []Stage, id string) (int, bool) {
+	if len(stages) > 0 && stages[0].File != "" {
+		if _, err := strconv.Atoi(id); err != nil {
+			return -1, false
+		}
+	}
+	return findStageIndex(stages, id)
+}
+
+// ScratchModeFromString converts a validated string to a ScratchMode constant.
+// The empty string and any unrecognized value return ScratchCollapsed.
+func ScratchModeFromString(s string) ScratchMode {
+	switch s {
+	case "separated":
+		return ScratchSeparated
+	case "hidden":
+		return ScratchHidden
+	default:
+		return ScratchCollapsed
+	}
+}
+
+// ParseOptions controls how a Dockerfile is parsed into a SimplifiedDockerfile.
+type ParseOptions struct {
+	BuildArgs      map[string]string // Values for ARGs, overriding their defaults like docker build --build-arg
+	ContextDir     string            // The build context for .dockerignore, the directory of the Dockerfile by default
+	Contexts       map[string]string // Named build contexts that replace images, e.g. alpine=docker-image://alpine:3.20
+	MaxLabelLength int
+	Platform       string   // The target platform, e.g. linux/arm64, which defines the automatic platform ARGs
+	Platforms      []string // Several target platforms, whose graphs are merged into one
+	BuildPlatform  string   // The platform of the builder, Linux on the architecture of this machine by default
+	ScratchMode    ScratchMode
+	SeparateImages []string
+	ShowContext    bool // Add the build context as a source of COPY and ADD instructions without --from
+	Targets        []string
+
+	// Keep the stages that the targets don't need and mark them as Unused,
+	// instead of removing them
+	HighlightUnused bool
+}
+
+// BuildOptions controls how a SimplifiedDockerfile is rendered into a DOT file.
+type BuildOptions struct {
+	Concentrate    bool
+	CopyDetails    bool // Label COPY and ADD edges with their paths and flags
+	EdgeStyle      string
+	ImageDigest    string // How to show the digests of images: full (default), fingerprint or hide
+	ImageName      string // How to show the names of images: full (default) or short, without registry and path
+	Layers         bool
+	Legend         bool
+	LinkPrefix     string // Link nodes to their lines, e.g. https://github.com/org/repo/blob/main/Dockerfile
+	MaxLabelLength int
+	NodeSep        float64
+	RankSep        float64
+}
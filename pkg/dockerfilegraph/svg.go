@@ -0,0 +1,262 @@
+package dockerfilegraph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/patrickhoefler/dockerfilegraph/internal/layout"
+)
+
+// BuildSVGFile renders a simplified Dockerfile as an SVG document using the
+// built-in layout engine, so that Graphviz does not need to be installed.
+// The result mirrors the graph produced by BuildDotFile.
+func BuildSVGFile(
+	simplifiedDockerfile SimplifiedDockerfile,
+	opts BuildOptions,
+) (string, error) {
+	graph := &layout.Graph{NodeSep: opts.NodeSep, RankSep: opts.RankSep}
+
+	// Add the legend if requested
+	if opts.Legend {
+		addSVGLegend(graph, opts.EdgeStyle, hasWaitForType(simplifiedDockerfile, WaitForAdd))
+	}
+
+	nodes := make(map[string]*layout.Node)
+	clusters := make(map[string]*layout.Cluster)
+	addNode := func(node *layout.Node) {
+		nodes[node.ID] = node
+		graph.Nodes = append(graph.Nodes, node)
+	}
+
+	for externalImageIndex, externalImage := range simplifiedDockerfile.ExternalImages {
+		addNode(&layout.Node{
+			ID:        fmt.Sprintf("external_image_%d", externalImageIndex),
+			Label:     getExternalImageLabel(externalImage, opts),
+			Badge:     getDigestFingerprint(externalImage, opts.ImageDigest),
+			Width:     2,
+			Rounded:   externalImage.Type == ExternalImageRegistry,
+			Folder:    externalImage.Type == ExternalImageDirectory,
+			Note:      externalImage.Type == ExternalImageURL,
+			Component: externalImage.Type == ExternalImageGit,
+			Cylinder:  externalImage.Type == ExternalImageCache,
+			Hexagon:   externalImage.Type == ExternalImageSecret,
+			Trapezium: externalImage.Type == ExternalImageSSH,
+			Dashed:    true,
+			Color:     hexGrey20,
+			FontColor: hexGrey20,
+		})
+	}
+
+	// Group the stages of combined Dockerfiles by file. The layout engine
+	// does not nest clusters, so with layers the file is part of the label.
+	files, fileClusterIDs := fileClusters(simplifiedDockerfile.Stages)
+	fileClustersByName := make(map[string]*layout.Cluster, len(files))
+	if !opts.Layers {
+		for _, file := range files {
+			cluster := &layout.Cluster{ID: fileClusterIDs[file], Label: file, Margin: 16}
+			fileClustersByName[file] = cluster
+			graph.Clusters = append(graph.Clusters, cluster)
+		}
+	}
+
+	for stageIndex, stage := range simplifiedDockerfile.Stages {
+		defaultTarget := isDefaultTarget(simplifiedDockerfile.Stages, stageIndex)
+
+		// Grey out the stages that none of the targets needs.
+		var unusedColor string
+		if stage.Unused {
+			unusedColor = hexGrey60
+		}
+
+		// Add layers if requested
+		if opts.Layers {
+			label := getStageClusterLabel(simplifiedDockerfile.Stages, stageIndex)
+			if stage.File != "" {
+				label = stage.File + ": " + label
+			}
+			cluster := &layout.Cluster{
+				ID:     fmt.Sprintf("cluster_stage_%d", stageIndex),
+				Label:  label,
+				Color:  unusedColor,
+				Margin: 16,
+				URL:    getSourceLink(getStageLinkPrefix(opts.LinkPrefix, stage), stage.Source),
+			}
+			if defaultTarget {
+				cluster.FillColor = hexGrey90
+			}
+			clusters[cluster.ID] = cluster
+			graph.Clusters = append(graph.Clusters, cluster)
+
+			for layerIndex, layer := range stage.Layers {
+				addNode(&layout.Node{
+					ID:        fmt.Sprintf("stage_%d_layer_%d", stageIndex, layerIndex),
+					Label:     layer.Label,
+					Cluster:   cluster,
+					Width:     2,
+					Rounded:   true,
+					Filled:    true,
+					FillColor: "white",
+					Color:     unusedColor,
+					FontColor: unusedColor,
+					PenWidth:  0.5,
+					URL:       getSourceLink(getStageLinkPrefix(opts.LinkPrefix, stage), layer.Source),
+				})
+
+				// Add edges between layers to guarantee the correct order
+				if layerIndex > 0 {
+					graph.Edges = append(graph.Edges, &layout.Edge{
+						From: nodes[fmt.Sprintf("stage_%d_layer_%d", stageIndex, layerIndex-1)],
+						To:   nodes[fmt.Sprintf("stage_%d_layer_%d", stageIndex, layerIndex)],
+					})
+				}
+			}
+		} else {
+			// Color the last one, because it is the default build target.
+			addNode(&layout.Node{
+				ID:        fmt.Sprintf("stage_%d", stageIndex),
+				Label:     getStageLabel(simplifiedDockerfile.Stages, stageIndex, opts.MaxLabelLength),
+				Badge:     getStageBadge(stage),
+				Cluster:   fileClustersByName[stage.File],
+				Width:     2,
+				Rounded:   true,
+				Filled:    defaultTarget,
+				FillColor: hexGrey90,
+				Color:     unusedColor,
+				FontColor: unusedColor,
+				URL:       getSourceLink(getStageLinkPrefix(opts.LinkPrefix, stage), stage.Source),
+			})
+		}
+	}
+
+	// Add the edges after all nodes exist, because a COPY --from may refer
+	// to a stage by its index.
+	for stageIndex, stage := range simplifiedDockerfile.Stages {
+		for layerIndex, layer := range stage.Layers {
+			for _, waitFor := range layer.WaitFors {
+				sourceNodeID, attrs, err := getWaitForNodeID(
+					simplifiedDockerfile, waitFor.ID, opts.Layers,
+				)
+				if err != nil {
+					return "", err
+				}
+
+				targetNodeID := fmt.Sprintf("stage_%d", stageIndex)
+				if opts.Layers {
+					targetNodeID = targetNodeID + fmt.Sprintf("_layer_%d", layerIndex)
+				}
+
+				edge := svgEdge(waitFor, opts.EdgeStyle)
+				edge.From = nodes[sourceNodeID]
+				edge.To = nodes[targetNodeID]
+				edge.TailCluster = clusters[attrs["ltail"]]
+				edge.Label = getWaitForLabel(waitFor, opts.MaxLabelLength, opts.CopyDetails)
+				if opts.CopyDetails && waitFor.Copy != nil {
+					edge.Tooltip = getWaitForDetails(waitFor, opts.CopyDetails)
+				}
+				graph.Edges = append(graph.Edges, edge)
+			}
+		}
+	}
+
+	// Add the ARGS that appear before the first stage, if layers are requested
+	if opts.Layers && len(simplifiedDockerfile.BeforeFirstStage) > 0 {
+		cluster := &layout.Cluster{
+			ID:     "cluster_before_first_stage",
+			Label:  "Before First Stage",
+			Margin: 8,
+		}
+		graph.Clusters = append(graph.Clusters, cluster)
+		for argIndex, arg := range simplifiedDockerfile.BeforeFirstStage {
+			addNode(&layout.Node{
+				ID:      fmt.Sprintf("before_first_stage_%d", argIndex),
+				Label:   arg.Label,
+				Cluster: cluster,
+				Width:   2,
+				Rounded: true,
+				URL:     getSourceLink(opts.LinkPrefix, arg.Source),
+			})
+		}
+	}
+
+	// Add the Docker Compose services, with an edge to the stage that each
+	// of them builds
+	for serviceIndex, service := range simplifiedDockerfile.Services {
+		targetNodeID, attrs, err := getServiceTargetNodeID(simplifiedDockerfile, service, opts.Layers)
+		if err != nil {
+			return "", err
+		}
+		node := &layout.Node{
+			ID:       fmt.Sprintf("service_%d", serviceIndex),
+			Label:    service.Name,
+			Width:    2,
+			Rounded:  true,
+			PenWidth: 2,
+		}
+		addNode(node)
+		graph.Edges = append(graph.Edges, &layout.Edge{
+			From: node, To: nodes[targetNodeID], HeadCluster: clusters[attrs["lhead"]],
+		})
+	}
+
+	var b strings.Builder
+	if err := layout.WriteSVG(&b, graph); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func addSVGLegend(graph *layout.Graph, edgestyle string, withAdd bool) {
+	cluster := &layout.Cluster{ID: "cluster_legend", Margin: 8}
+	graph.Clusters = append(graph.Clusters, cluster)
+
+	for i, entry := range []struct {
+		label       string
+		waitForType WaitForType
+	}{
+		{"FROM ...", WaitForFrom},
+		{"COPY --from=...", WaitForCopy},
+		{"RUN --mount=...", WaitForMount},
+		{"ADD https://...", WaitForAdd},
+	} {
+		if entry.waitForType == WaitForAdd && !withAdd {
+			continue
+		}
+		key := &layout.Node{
+			ID:         fmt.Sprintf("key_%d", i),
+			Label:      entry.label,
+			Cluster:    cluster,
+			Plain:      true,
+			FontFamily: "monospace",
+			FontSize:   10,
+		}
+		key2 := &layout.Node{
+			ID:      fmt.Sprintf("key2_%d", i),
+			Cluster: cluster,
+			Plain:   true,
+		}
+		graph.Nodes = append(graph.Nodes, key, key2)
+
+		edge := svgEdge(WaitFor{Type: entry.waitForType}, edgestyle)
+		edge.From = key
+		edge.To = key2
+		graph.Edges = append(graph.Edges, edge)
+	}
+}
+
+// svgEdge returns an edge styled like the Graphviz edge for the given
+// dependency.
+func svgEdge(waitFor WaitFor, edgestyle string) *layout.Edge {
+	edge := &layout.Edge{Bold: waitFor.Copy != nil && waitFor.Copy.Link}
+	switch waitFor.Type {
+	case WaitForCopy:
+		edge.ArrowHead = "empty"
+		edge.Dashed = edgestyle == "default"
+	case WaitForMount:
+		edge.ArrowHead = "ediamond"
+		edge.Dotted = edgestyle == "default"
+	case WaitForAdd:
+		edge.ArrowHead = "odot"
+		edge.Dashed = edgestyle == "default"
+	}
+	return edge
+}
@@ -0,0 +1,100 @@
+package dockerfilegraph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildSVGFile(t *testing.T) {
+	simplifiedDockerfile := SimplifiedDockerfile{
+		BeforeFirstStage: []Layer{{Label: "ARG VERSION=1"}},
+		ExternalImages: []ExternalImage{
+			{ID: "ubuntu", Name: "ubuntu"},
+			{ID: "buildcache", Name: "buildcache"},
+		},
+		Stages: []Stage{
+			{
+				Name: "base",
+				Layers: []Layer{{
+					Label:    "FROM ubuntu AS base",
+					WaitFors: []WaitFor{{ID: "ubuntu", Type: WaitForFrom}},
+				}},
+			},
+			{
+				Name:   "release",
+				Source: SourceRange{StartLine: 3, EndLine: 5},
+				Layers: []Layer{
+					{
+						Label:    "FROM scratch",
+						WaitFors: []WaitFor{},
+					},
+					{
+						Label:    "COPY --from=base . .",
+						WaitFors: []WaitFor{{ID: "base", Type: WaitForCopy}},
+					},
+					{
+						Label:    "RUN --mount=from=buildcache",
+						WaitFors: []WaitFor{{ID: "buildcache", Type: WaitForMount}},
+					},
+				},
+			},
+		},
+		Services: []Service{{Name: "web", Stage: 1}},
+	}
+
+	tests := []struct {
+		name         string
+		opts         BuildOptions
+		wantContains []string
+	}{
+		{
+			name: "stages",
+			opts: BuildOptions{EdgeStyle: "default", MaxLabelLength: 20, NodeSep: 1, RankSep: 0.5},
+			wantContains: []string{
+				`<g id="external_image_0" class="node">`,
+				`<g id="stage_1" class="node">`,
+				`fill="#e5e5e5"`,
+				`<g id="stage_0&#45;&gt;stage_1" class="edge">`,
+				`stroke-dasharray="5,2" marker-end="url(#arrow-empty)"`,
+				`stroke-dasharray="1,5" marker-end="url(#arrow-ediamond)"`,
+				`<g id="service_0" class="node">`,
+				`<g id="service_0&#45;&gt;stage_1" class="edge">`,
+			},
+		},
+		{
+			name: "link prefix",
+			opts: BuildOptions{EdgeStyle: "default", LinkPrefix: "Dockerfile", MaxLabelLength: 20, NodeSep: 1, RankSep: 0.5},
+			wantContains: []string{
+				`<a xlink:href="Dockerfile#L3-L5" xlink:title="Dockerfile#L3-L5">`,
+			},
+		},
+		{
+			name: "layers and legend",
+			opts: BuildOptions{
+				EdgeStyle: "solid", Layers: true, Legend: true, MaxLabelLength: 20, NodeSep: 1, RankSep: 0.5,
+			},
+			wantContains: []string{
+				`<g id="cluster_legend" class="cluster">`,
+				`<g id="cluster_stage_1" class="cluster">`,
+				`<g id="cluster_before_first_stage" class="cluster">`,
+				`<g id="stage_0_layer_0&#45;&gt;stage_1_layer_1" class="edge">`,
+				`stroke="black" marker-end="url(#arrow-empty)"`,
+				`>RUN --mount=...</text>`,
+				`<g id="service_0&#45;&gt;stage_1_layer_0" class="edge">`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildSVGFile(simplifiedDockerfile, tt.opts)
+			if err != nil {
+				t.Fatalf("BuildSVGFile() error = %v", err)
+			}
+			for _, want := range tt.wantContains {
+				if !strings.Contains(got, want) {
+					t.Errorf("BuildSVGFile() = %v, did not contain %v", got, want)
+				}
+			}
+		})
+	}
+}